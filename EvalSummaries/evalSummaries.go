@@ -0,0 +1,363 @@
+package EvalSummaries
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"slack-tag-summariser/Models"
+	"slack-tag-summariser/SummarizeConversations"
+
+	"google.golang.org/genai"
+)
+
+type GenAiResponse = Models.GenAiResponse
+type ConversationResponseEntry = Models.ConversationResponseEntry
+
+// Fixture is a recorded conversation together with the labels a good summary should have.
+// Fixtures are JSON files in the fixtures directory, e.g.
+//
+//	{
+//	  "name": "billing-question",
+//	  "user_id": "U0123ABCD",
+//	  "conversation": {"MentionText": "...", "Messages": [{"Text": "...", "Timestamp": "..."}], ...},
+//	  "expected": {"actionable": "Yes", "priority": "P1", "key_facts": ["invoice", "refund"]}
+//	}
+type Fixture struct {
+	Name         string                    `json:"name"`
+	UserId       string                    `json:"user_id"`
+	Conversation ConversationResponseEntry `json:"conversation"`
+	Expected     ExpectedLabels            `json:"expected"`
+}
+
+type ExpectedLabels struct {
+	Actionable string `json:"actionable"`
+	Priority   string `json:"priority"`
+	// words or phrases that have to show up somewhere in the summary or the action items
+	KeyFacts []string `json:"key_facts"`
+}
+
+type fixtureResult struct {
+	fixture  Fixture
+	response GenAiResponse
+	err      error
+
+	actionableCorrect bool
+	priorityCorrect   bool
+	keyFactRecall     float64
+}
+
+type evalConfig struct {
+	name       string
+	promptPath string
+	model      string
+	provider   SummarizeConversations.GenAiProvider
+}
+
+type evalMetrics struct {
+	total              int
+	failed             int
+	actionableAccuracy float64
+	actionableKappa    float64
+	priorityAccuracy   float64
+	keyFactRecall      float64
+}
+
+func loadFixtures(fixturesDir string) ([]Fixture, error) {
+	fixturePaths, globError := filepath.Glob(filepath.Join(fixturesDir, "*.json"))
+	if globError != nil {
+		return nil, globError
+	}
+	sort.Strings(fixturePaths)
+
+	var fixtures []Fixture
+	for _, fixturePath := range fixturePaths {
+		fixtureContent, readError := os.ReadFile(fixturePath)
+		if readError != nil {
+			return nil, readError
+		}
+
+		var fixture Fixture
+		if jsonUnmarshallError := json.Unmarshal(fixtureContent, &fixture); jsonUnmarshallError != nil {
+			return nil, fmt.Errorf("%s: %w", fixturePath, jsonUnmarshallError)
+		}
+		if fixture.Name == "" {
+			fixture.Name = strings.TrimSuffix(filepath.Base(fixturePath), ".json")
+		}
+		fixtures = append(fixtures, fixture)
+	}
+
+	if len(fixtures) == 0 {
+		return nil, fmt.Errorf("no fixtures found in %s", fixturesDir)
+	}
+	return fixtures, nil
+}
+
+func scoreKeyFacts(response GenAiResponse, keyFacts []string) float64 {
+	if len(keyFacts) == 0 {
+		return 1
+	}
+
+	var responseText strings.Builder
+	for _, summaryText := range response.Summary {
+		responseText.WriteString(strings.ToLower(summaryText) + "\n")
+	}
+	for _, actionItem := range response.ActionRequired {
+		responseText.WriteString(strings.ToLower(actionItem.Description) + "\n")
+	}
+
+	found := 0
+	for _, keyFact := range keyFacts {
+		if strings.Contains(responseText.String(), strings.ToLower(keyFact)) {
+			found++
+		}
+	}
+	return float64(found) / float64(len(keyFacts))
+}
+
+func runFixtures(fixtures []Fixture, config evalConfig) []fixtureResult {
+	ctx := context.Background()
+	var results []fixtureResult
+
+	for _, fixture := range fixtures {
+		// no database, so the summary cache is skipped and every fixture hits the provider
+		summarizeOptions := SummarizeConversations.SummarizeOptions{
+			UserId:     fixture.UserId,
+			Model:      config.model,
+			PromptPath: config.promptPath,
+		}
+
+		response, summarizeError := SummarizeConversations.SummarizeSingleConversation(fixture.Conversation, config.provider, ctx, summarizeOptions)
+		result := fixtureResult{fixture: fixture, response: response, err: summarizeError}
+
+		if summarizeError == nil {
+			result.actionableCorrect = strings.EqualFold(response.Actionable, fixture.Expected.Actionable)
+			result.priorityCorrect = strings.EqualFold(response.Priority, fixture.Expected.Priority)
+			result.keyFactRecall = scoreKeyFacts(response, fixture.Expected.KeyFacts)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// cohensKappa measures how much the actionable labels agree with the expected ones beyond chance
+func cohensKappa(results []fixtureResult) float64 {
+	var total, agree, predictedYes, expectedYes float64
+	for _, result := range results {
+		if result.err != nil {
+			continue
+		}
+		total++
+		isPredictedYes := strings.EqualFold(result.response.Actionable, "yes")
+		isExpectedYes := strings.EqualFold(result.fixture.Expected.Actionable, "yes")
+		if isPredictedYes == isExpectedYes {
+			agree++
+		}
+		if isPredictedYes {
+			predictedYes++
+		}
+		if isExpectedYes {
+			expectedYes++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+
+	observedAgreement := agree / total
+	chanceAgreement := (predictedYes/total)*(expectedYes/total) + (1-predictedYes/total)*(1-expectedYes/total)
+	if chanceAgreement == 1 {
+		return 1
+	}
+	return (observedAgreement - chanceAgreement) / (1 - chanceAgreement)
+}
+
+func computeMetrics(results []fixtureResult) evalMetrics {
+	metrics := evalMetrics{total: len(results)}
+
+	var actionableCorrect, priorityCorrect, keyFactRecall float64
+	for _, result := range results {
+		if result.err != nil {
+			metrics.failed++
+			continue
+		}
+		if result.actionableCorrect {
+			actionableCorrect++
+		}
+		if result.priorityCorrect {
+			priorityCorrect++
+		}
+		keyFactRecall += result.keyFactRecall
+	}
+
+	// failed fixtures count as wrong, a config that errors out should not look accurate
+	if metrics.total > 0 {
+		metrics.actionableAccuracy = actionableCorrect / float64(metrics.total)
+		metrics.priorityAccuracy = priorityCorrect / float64(metrics.total)
+		metrics.keyFactRecall = keyFactRecall / float64(metrics.total)
+	}
+	metrics.actionableKappa = cohensKappa(results)
+	return metrics
+}
+
+func printMetrics(out io.Writer, name string, metrics evalMetrics) {
+	fmt.Fprintf(out, "%s\n", name)
+	fmt.Fprintf(out, "  fixtures:            %d (%d failed)\n", metrics.total, metrics.failed)
+	fmt.Fprintf(out, "  actionable accuracy: %.1f%%\n", metrics.actionableAccuracy*100)
+	fmt.Fprintf(out, "  actionable kappa:    %.2f\n", metrics.actionableKappa)
+	fmt.Fprintf(out, "  priority accuracy:   %.1f%%\n", metrics.priorityAccuracy*100)
+	fmt.Fprintf(out, "  key fact recall:     %.1f%%\n", metrics.keyFactRecall*100)
+}
+
+func describeResult(result fixtureResult) string {
+	if result.err != nil {
+		return "error: " + result.err.Error()
+	}
+	return fmt.Sprintf("actionable=%s priority=%s key facts=%.0f%%", result.response.Actionable, result.response.Priority, result.keyFactRecall*100)
+}
+
+func printFixtureResults(out io.Writer, results []fixtureResult) {
+	for _, result := range results {
+		status := "ok  "
+		if result.err != nil || !result.actionableCorrect || !result.priorityCorrect || result.keyFactRecall < 1 {
+			status = "MISS"
+		}
+		fmt.Fprintf(out, "  [%s] %s: %s (expected actionable=%s priority=%s)\n", status, result.fixture.Name,
+			describeResult(result), result.fixture.Expected.Actionable, result.fixture.Expected.Priority)
+	}
+}
+
+// printDiff lists the fixtures on which the two configs disagree and how often they agree overall
+func printDiff(out io.Writer, baselineResults []fixtureResult, candidateResults []fixtureResult) {
+	agreements := 0
+	var differences []string
+
+	for i := range candidateResults {
+		baseline, candidate := baselineResults[i], candidateResults[i]
+		sameLabels := baseline.err == nil && candidate.err == nil &&
+			strings.EqualFold(baseline.response.Actionable, candidate.response.Actionable) &&
+			strings.EqualFold(baseline.response.Priority, candidate.response.Priority)
+
+		if sameLabels {
+			agreements++
+		}
+		if !sameLabels || baseline.keyFactRecall != candidate.keyFactRecall {
+			differences = append(differences, fmt.Sprintf("  %s\n    baseline:  %s\n    candidate: %s",
+				candidate.fixture.Name, describeResult(baseline), describeResult(candidate)))
+		}
+	}
+
+	fmt.Fprintf(out, "\nagreement between baseline and candidate: %d/%d\n", agreements, len(candidateResults))
+	if len(differences) > 0 {
+		fmt.Fprintf(out, "differences:\n%s\n", strings.Join(differences, "\n"))
+	}
+}
+
+func newGeminiProvider() (SummarizeConversations.GenAiProvider, error) {
+	genAiClient, genAiError := genai.NewClient(context.Background(), &genai.ClientConfig{
+		APIKey:  os.Getenv("GEMINI_API_KEY"),
+		Backend: genai.BackendGeminiAPI,
+	})
+	if genAiError != nil {
+		return nil, genAiError
+	}
+	return genAiClient.Models, nil
+}
+
+func newProvider(providerName string, recordingsDir string) (SummarizeConversations.GenAiProvider, error) {
+	switch providerName {
+	case "replay":
+		return NewReplayProvider(recordingsDir), nil
+	case "record":
+		liveProvider, liveProviderError := newGeminiProvider()
+		if liveProviderError != nil {
+			return nil, liveProviderError
+		}
+		return NewRecordingProvider(recordingsDir, liveProvider), nil
+	case "gemini":
+		return newGeminiProvider()
+	}
+	return nil, fmt.Errorf("unknown provider %q, use replay, record or gemini", providerName)
+}
+
+// RunEvalCommand runs the fixtures through the summariser and prints the scores, when a baseline
+// prompt, model or provider is given both configs are run and their results are diffed.
+// It returns the exit code of the command.
+func RunEvalCommand(args []string, out io.Writer) int {
+	flags := flag.NewFlagSet("eval", flag.ContinueOnError)
+	flags.SetOutput(out)
+
+	fixturesDir := flags.String("fixtures", "evalFixtures", "directory with the fixture JSON files")
+	recordingsDir := flags.String("recordings", "", "directory with the recorded responses (default <fixtures>/recordings)")
+	promptPath := flags.String("prompt", "prompt.txt", "prompt file to evaluate")
+	model := flags.String("model", "", "model to evaluate (default GEMINI_MODEL)")
+	providerName := flags.String("provider", "replay", "replay reads the recorded responses from disk, record calls gemini and saves the responses, gemini calls gemini")
+	baselinePromptPath := flags.String("baseline-prompt", "", "prompt file to compare against")
+	baselineModel := flags.String("baseline-model", "", "model to compare against")
+	baselineProviderName := flags.String("baseline-provider", "", "provider to compare against")
+	minActionableAccuracy := flags.Float64("min-actionable-accuracy", 0, "fail when the actionable accuracy is below this value (0 to 1)")
+
+	if parseError := flags.Parse(args); parseError != nil {
+		return 2
+	}
+	if *recordingsDir == "" {
+		*recordingsDir = filepath.Join(*fixturesDir, "recordings")
+	}
+
+	fixtures, loadFixturesError := loadFixtures(*fixturesDir)
+	if loadFixturesError != nil {
+		fmt.Fprintln(out, "Failed to load fixtures:", loadFixturesError)
+		return 1
+	}
+
+	provider, providerError := newProvider(*providerName, *recordingsDir)
+	if providerError != nil {
+		fmt.Fprintln(out, "Failed to create provider:", providerError)
+		return 1
+	}
+
+	candidate := evalConfig{name: "candidate", promptPath: *promptPath, model: *model, provider: provider}
+	candidateResults := runFixtures(fixtures, candidate)
+	candidateMetrics := computeMetrics(candidateResults)
+
+	printMetrics(out, fmt.Sprintf("candidate (prompt=%s model=%s provider=%s)", *promptPath, *model, *providerName), candidateMetrics)
+	printFixtureResults(out, candidateResults)
+
+	hasBaseline := *baselinePromptPath != "" || *baselineModel != "" || *baselineProviderName != ""
+	if hasBaseline {
+		baseline := candidate
+		baseline.name = "baseline"
+		if *baselinePromptPath != "" {
+			baseline.promptPath = *baselinePromptPath
+		}
+		if *baselineModel != "" {
+			baseline.model = *baselineModel
+		}
+		baselineProvider := *providerName
+		if *baselineProviderName != "" {
+			baselineProvider = *baselineProviderName
+			baseline.provider, providerError = newProvider(baselineProvider, *recordingsDir)
+			if providerError != nil {
+				fmt.Fprintln(out, "Failed to create baseline provider:", providerError)
+				return 1
+			}
+		}
+
+		baselineResults := runFixtures(fixtures, baseline)
+		fmt.Fprintln(out)
+		printMetrics(out, fmt.Sprintf("baseline (prompt=%s model=%s provider=%s)", baseline.promptPath, baseline.model, baselineProvider), computeMetrics(baselineResults))
+		printDiff(out, baselineResults, candidateResults)
+	}
+
+	if candidateMetrics.actionableAccuracy < *minActionableAccuracy {
+		fmt.Fprintf(out, "\nactionable accuracy %.1f%% is below the minimum of %.1f%%\n", candidateMetrics.actionableAccuracy*100, *minActionableAccuracy*100)
+		return 1
+	}
+	return 0
+}
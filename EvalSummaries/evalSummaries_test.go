@@ -0,0 +1,104 @@
+package EvalSummaries
+
+import (
+	"strings"
+	"testing"
+
+	"slack-tag-summariser/Models"
+)
+
+// TestEvalReplaysRecordedFixtures runs the committed fixtures against their recordings, a change to the
+// prompt or to what is sent needs new recordings with `go run . eval -provider record`
+func TestEvalReplaysRecordedFixtures(t *testing.T) {
+	t.Setenv("GEMINI_MODEL", "")
+	t.Setenv("REDACTION_PATTERNS", "")
+
+	var out strings.Builder
+	exitCode := RunEvalCommand([]string{
+		"-fixtures", "../evalFixtures",
+		"-prompt", "../prompt.txt",
+		"-provider", "replay",
+		"-min-actionable-accuracy", "1",
+	}, &out)
+	if exitCode != 0 {
+		t.Fatalf("eval exited with %d:\n%s", exitCode, out.String())
+	}
+	if !strings.Contains(out.String(), "fixtures:            4 (0 failed)") {
+		t.Fatalf("expected all 4 fixtures to replay:\n%s", out.String())
+	}
+	t.Log(out.String())
+}
+
+// TestEvalReplayParsesActionItems makes sure the recordings follow the action_required schema of the prompt,
+// a field the parser does not know would silently come back empty
+func TestEvalReplayParsesActionItems(t *testing.T) {
+	t.Setenv("GEMINI_MODEL", "")
+	t.Setenv("REDACTION_PATTERNS", "")
+
+	fixtures, loadError := loadFixtures("../evalFixtures")
+	if loadError != nil {
+		t.Fatalf("loading the fixtures: %v", loadError)
+	}
+	results := runFixtures(fixtures, evalConfig{promptPath: "../prompt.txt", provider: NewReplayProvider("../evalFixtures/recordings")})
+
+	expectedActionItems := map[string]Models.ActionItem{
+		"billing-refund":  {OwnerUserId: "U0EVALUSER", RequesterUserId: "U0SUPPORT", DueText: "by Friday"},
+		"checkout-outage": {OwnerUserId: "U0EVALUSER", RequesterUserId: "U0ONCALL", DueText: "now"},
+		"design-review":   {OwnerUserId: "U0EVALUSER", RequesterUserId: "U0DESIGNER", DueText: "this week"},
+	}
+	for _, result := range results {
+		if result.err != nil {
+			t.Fatalf("%s: %v", result.fixture.Name, result.err)
+		}
+
+		expected, hasActionItem := expectedActionItems[result.fixture.Name]
+		if !hasActionItem {
+			if len(result.response.ActionRequired) != 0 {
+				t.Errorf("%s: expected no action items, got %+v", result.fixture.Name, result.response.ActionRequired)
+			}
+			continue
+		}
+		if len(result.response.ActionRequired) != 1 {
+			t.Fatalf("%s: expected 1 action item, got %+v", result.fixture.Name, result.response.ActionRequired)
+		}
+
+		actionItem := result.response.ActionRequired[0]
+		if actionItem.OwnerUserId != expected.OwnerUserId ||
+			actionItem.RequesterUserId != expected.RequesterUserId ||
+			actionItem.DueText != expected.DueText {
+			t.Errorf("%s: owner/requester/due = %q/%q/%q, want %q/%q/%q", result.fixture.Name,
+				actionItem.OwnerUserId, actionItem.RequesterUserId, actionItem.DueText,
+				expected.OwnerUserId, expected.RequesterUserId, expected.DueText)
+		}
+	}
+}
+
+func TestReplayProviderNamesTheRecordFlag(t *testing.T) {
+	t.Setenv("GEMINI_MODEL", "")
+
+	var out strings.Builder
+	RunEvalCommand([]string{
+		"-fixtures", "../evalFixtures",
+		"-recordings", t.TempDir(),
+		"-prompt", "../prompt.txt",
+		"-provider", "replay",
+	}, &out)
+	if !strings.Contains(out.String(), "run the eval with -provider record first") {
+		t.Fatalf("expected a missing recording to point at -provider record:\n%s", out.String())
+	}
+}
+
+func TestCohensKappa(t *testing.T) {
+	results := []fixtureResult{
+		{fixture: Fixture{Expected: ExpectedLabels{Actionable: "Yes"}}, response: GenAiResponse{Actionable: "Yes"}},
+		{fixture: Fixture{Expected: ExpectedLabels{Actionable: "No"}}, response: GenAiResponse{Actionable: "No"}},
+		{fixture: Fixture{Expected: ExpectedLabels{Actionable: "Yes"}}, response: GenAiResponse{Actionable: "No"}},
+		{fixture: Fixture{Expected: ExpectedLabels{Actionable: "No"}}, response: GenAiResponse{Actionable: "Yes"}},
+	}
+	if kappa := cohensKappa(results); kappa != 0 {
+		t.Fatalf("kappa = %.2f, want 0 for agreement at chance", kappa)
+	}
+	if kappa := cohensKappa(results[:2]); kappa != 1 {
+		t.Fatalf("kappa = %.2f, want 1 for full agreement", kappa)
+	}
+}
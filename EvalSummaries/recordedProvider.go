@@ -0,0 +1,92 @@
+package EvalSummaries
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"slack-tag-summariser/SummarizeConversations"
+
+	"google.golang.org/genai"
+)
+
+// RecordedProvider replays responses saved on disk so the eval runs offline,
+// with a live provider set it calls the live provider instead and records what it returns
+type RecordedProvider struct {
+	recordingsDir string
+	liveProvider  SummarizeConversations.GenAiProvider
+}
+
+func NewReplayProvider(recordingsDir string) *RecordedProvider {
+	return &RecordedProvider{recordingsDir: recordingsDir}
+}
+
+func NewRecordingProvider(recordingsDir string, liveProvider SummarizeConversations.GenAiProvider) *RecordedProvider {
+	return &RecordedProvider{recordingsDir: recordingsDir, liveProvider: liveProvider}
+}
+
+// the recording key covers everything that is sent, any change to the prompt needs a new recording
+func buildRecordingKey(model string, contents []*genai.Content, config *genai.GenerateContentConfig) (string, error) {
+	request, jsonMarshallError := json.Marshal(struct {
+		Model    string                       `json:"model"`
+		Contents []*genai.Content             `json:"contents"`
+		Config   *genai.GenerateContentConfig `json:"config"`
+	}{model, contents, config})
+	if jsonMarshallError != nil {
+		return "", jsonMarshallError
+	}
+
+	requestHash := sha256.Sum256(request)
+	return hex.EncodeToString(requestHash[:]), nil
+}
+
+func (p *RecordedProvider) GenerateContent(
+	ctx context.Context,
+	model string,
+	contents []*genai.Content,
+	config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error) {
+
+	recordingKey, recordingKeyError := buildRecordingKey(model, contents, config)
+	if recordingKeyError != nil {
+		return nil, recordingKeyError
+	}
+	recordingPath := filepath.Join(p.recordingsDir, recordingKey+".json")
+
+	if p.liveProvider == nil {
+		recording, readError := os.ReadFile(recordingPath)
+		if errors.Is(readError, os.ErrNotExist) {
+			return nil, fmt.Errorf("no recording for model %s (%s), run the eval with -provider record first", model, recordingKey)
+		}
+		if readError != nil {
+			return nil, readError
+		}
+
+		var genAiResult genai.GenerateContentResponse
+		if jsonUnmarshallError := json.Unmarshal(recording, &genAiResult); jsonUnmarshallError != nil {
+			return nil, jsonUnmarshallError
+		}
+		return &genAiResult, nil
+	}
+
+	genAiResult, genAiError := p.liveProvider.GenerateContent(ctx, model, contents, config)
+	if genAiError != nil {
+		return nil, genAiError
+	}
+
+	recording, jsonMarshallError := json.MarshalIndent(genAiResult, "", "  ")
+	if jsonMarshallError != nil {
+		return nil, jsonMarshallError
+	}
+	if mkdirError := os.MkdirAll(p.recordingsDir, 0o755); mkdirError != nil {
+		return nil, mkdirError
+	}
+	if writeError := os.WriteFile(recordingPath, recording, 0o644); writeError != nil {
+		return nil, writeError
+	}
+	return genAiResult, nil
+}
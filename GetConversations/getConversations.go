@@ -71,6 +71,8 @@ func GetConversation(SlackClient *slack.Client, mention slack.SearchMessage) Con
 	conversationEntry.MentionText = mention.Text
 	conversationEntry.MentionChannelId = channelId
 	conversationEntry.MentionTimestamp = threadTs
+	conversationEntry.MentionUserId = mention.User
+	conversationEntry.ThreadTimestamp = parentThreadTs
 
 	for _, threadConversation := range threadConversations {
 		threadConversationText := threadConversation.Msg.Text
@@ -79,8 +81,14 @@ func GetConversation(SlackClient *slack.Client, mention slack.SearchMessage) Con
 		threadConversationTextStruct := ThreadMessage{
 			Text:      threadConversationText,
 			Timestamp: threadConversationTimestamp,
+			User:      threadConversation.Msg.User,
 		}
 		conversationEntry.Messages = append(conversationEntry.Messages, threadConversationTextStruct)
+
+		// a mention brought back from an earlier digest is not a search result and has no text
+		if conversationEntry.MentionText == "" && threadConversationTimestamp == threadTs {
+			conversationEntry.MentionText = threadConversationText
+		}
 	}
 	return conversationEntry
 }
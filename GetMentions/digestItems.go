@@ -0,0 +1,52 @@
+package GetMentions
+
+import (
+	"time"
+
+	"slack-tag-summariser/Models"
+
+	"github.com/slack-go/slack"
+)
+
+type DigestItem = Models.DigestItem
+
+// ApplyDigestItems leaves out the mentions the user marked as done or not relevant and the ones
+// snoozed to a later digest, and adds back the snoozed mentions that are due even when they are
+// too old to be found by the search
+func ApplyDigestItems(mentions []slack.SearchMessage, items []DigestItem, now time.Time) []slack.SearchMessage {
+	itemsByMention := make(map[UniqueMention]DigestItem, len(items))
+	for _, item := range items {
+		itemsByMention[UniqueMention{Timestamp: item.MentionTimestamp, ChannelId: item.ChannelId}] = item
+	}
+
+	isDue := func(item DigestItem) bool {
+		return item.State == Models.DigestItemSnoozed && (item.SnoozedUntil == nil || !item.SnoozedUntil.After(now))
+	}
+
+	var appliedMentions []slack.SearchMessage
+	mentionsTaken := make(map[UniqueMention]struct{})
+	for _, mention := range mentions {
+		uniqueKey := UniqueMention{Timestamp: mention.Timestamp, ChannelId: mention.Channel.ID}
+		if item, exists := itemsByMention[uniqueKey]; exists && !isDue(item) {
+			continue
+		}
+		mentionsTaken[uniqueKey] = struct{}{}
+		appliedMentions = append(appliedMentions, mention)
+	}
+
+	for _, item := range items {
+		uniqueKey := UniqueMention{Timestamp: item.MentionTimestamp, ChannelId: item.ChannelId}
+		if _, taken := mentionsTaken[uniqueKey]; taken || !isDue(item) {
+			continue
+		}
+		// the text of the mention is read from its thread, see GetConversations.GetConversation
+		appliedMentions = append(appliedMentions, slack.SearchMessage{
+			Type:      "message",
+			Channel:   slack.CtxChannel{ID: item.ChannelId},
+			User:      item.MentionUserId,
+			Timestamp: item.MentionTimestamp,
+			Permalink: item.MentionPermalink,
+		})
+	}
+	return appliedMentions
+}
@@ -3,6 +3,8 @@ package GetMentions
 import (
 	"fmt"
 	"slack-tag-summariser/Models"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/slack-go/slack"
@@ -90,7 +92,31 @@ func GetMentions(slackClient *slack.Client, userId string) ([]slack.SearchMessag
 	yesterday := time.Now().AddDate(0, 0, -2).Format("2006-01-02")
 	today := time.Now().Format("2006-01-02")
 	query := fmt.Sprintf("<@%s> after:%s before:%s", userId, yesterday, today)
+	return searchMentions(slackClient, userId, query)
+}
+
+// GetMentionsSince returns the mentions of the user after the time, for the checks between two digests
+func GetMentionsSince(slackClient *slack.Client, userId string, since time.Time) ([]slack.SearchMessage, error) {
+	// the search only filters by day, "after" is exclusive so it starts the day before
+	query := fmt.Sprintf("<@%s> after:%s", userId, since.AddDate(0, 0, -1).Format("2006-01-02"))
+	mentions, searchError := searchMentions(slackClient, userId, query)
+	if searchError != nil {
+		return nil, searchError
+	}
+
+	var recentMentions []slack.SearchMessage
+	for _, mention := range mentions {
+		seconds, _, _ := strings.Cut(mention.Timestamp, ".")
+		unixSeconds, parseError := strconv.ParseInt(seconds, 10, 64)
+		if parseError != nil || time.Unix(unixSeconds, 0).Before(since) {
+			continue
+		}
+		recentMentions = append(recentMentions, mention)
+	}
+	return recentMentions, nil
+}
 
+func searchMentions(slackClient *slack.Client, userId string, query string) ([]slack.SearchMessage, error) {
 	params := slack.SearchParameters{
 		Sort:          "timestamp",
 		SortDirection: "desc",
@@ -0,0 +1,83 @@
+package Localisation
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// slack markup like <@U123>, <#C123|general> and links would only add noise to the detection
+var slackMarkupRegex = regexp.MustCompile(`<[^>]*>|:[a-z0-9_+-]+:`)
+
+// a handful of very common words is enough to tell the supported latin script languages apart
+var stopwords = map[string][]string{
+	"en": {"the", "and", "is", "are", "to", "of", "this", "that", "for", "with", "you", "can", "please", "it", "we"},
+	"es": {"el", "la", "los", "las", "que", "es", "por", "para", "con", "una", "del", "esto", "puedes", "pero", "está"},
+	"fr": {"le", "la", "les", "est", "et", "des", "une", "pour", "avec", "que", "pas", "vous", "ce", "sur", "dans"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "mit", "ein", "eine", "zu", "ich", "du", "bitte", "auf", "für"},
+	"pt": {"o", "os", "que", "não", "para", "com", "uma", "um", "do", "da", "você", "isso", "mas", "está", "por"},
+}
+
+// DetectLanguage guesses the dominant language of the texts, mixed threads resolve to
+// whatever language most of the words are in, and "" is returned when nothing matches
+func DetectLanguage(texts []string) string {
+	scores := make(map[string]int)
+
+	for _, text := range texts {
+		text = slackMarkupRegex.ReplaceAllString(text, " ")
+
+		// non latin scripts are identified by their characters
+		for _, r := range text {
+			switch {
+			case unicode.Is(unicode.Devanagari, r):
+				scores["hi"]++
+			case unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r):
+				scores["ja"] += 2
+			case unicode.Is(unicode.Han, r):
+				scores["ja"]++
+			}
+		}
+
+		for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r)
+		}) {
+			for language, words := range stopwords {
+				for _, stopword := range words {
+					if word == stopword {
+						scores[language]++
+					}
+				}
+			}
+		}
+	}
+
+	detectedLanguage := ""
+	bestScore := 0
+	// iterate in a fixed order so that ties always resolve the same way
+	for _, language := range SupportedLanguages() {
+		if scores[language] > bestScore {
+			detectedLanguage = language
+			bestScore = scores[language]
+		}
+	}
+	return detectedLanguage
+}
+
+// DominantLanguage picks the most common language of the summaries, used for the labels of a digest
+// when the user has no preference
+func DominantLanguage(languages []string) string {
+	counts := make(map[string]int)
+	for _, language := range languages {
+		counts[language]++
+	}
+
+	dominantLanguage := DefaultLanguage
+	bestCount := 0
+	for _, language := range SupportedLanguages() {
+		if counts[language] > bestCount {
+			dominantLanguage = language
+			bestCount = counts[language]
+		}
+	}
+	return dominantLanguage
+}
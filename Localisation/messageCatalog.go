@@ -0,0 +1,604 @@
+package Localisation
+
+import (
+	"fmt"
+	"strings"
+)
+
+const DefaultLanguage = "en"
+
+// languageNames are the languages the digest can be written in, keyed by ISO 639-1 code
+var languageNames = map[string]string{
+	"en": "English",
+	"es": "Spanish",
+	"fr": "French",
+	"de": "German",
+	"pt": "Portuguese",
+	"hi": "Hindi",
+	"ja": "Japanese",
+}
+
+// catalogs hold the fixed labels of the digest, english is the fallback for any missing key
+var catalogs = map[string]map[string]string{
+	"en": {
+		"mention_link":            "Mention Link",
+		"click_here":              "Click Here",
+		"actionable":              "Actionable",
+		"priority":                "Priority",
+		"yes":                     "Yes",
+		"no":                      "No",
+		"rank_score":              "Rank score",
+		"summary":                 "Summary",
+		"action_required":         "Action Required",
+		"asked_by":                "asked by %s",
+		"due":                     "due %s",
+		"source":                  "source",
+		"low_confidence":          "low confidence",
+		"today_at_a_glance":       "Today at a glance",
+		"overall_load":            "Overall load",
+		"mentions_actionable":     "%d mentions, %d actionable",
+		"top_things_to_do":        "Top things to do",
+		"thread":                  "thread",
+		"related_threads":         "Related threads",
+		"load_light":              "Light",
+		"load_moderate":           "Moderate",
+		"load_heavy":              "Heavy",
+		"injection_warning":       "Possible prompt injection in this thread, double-check the summary against the thread",
+		"grounding_warning":       "Some details of this summary could not be found in the thread, check it before acting on it",
+		"category":                "Category",
+		"category_question":       "Question",
+		"category_review_request": "Review request",
+		"category_approval":       "Approval",
+		"category_incident":       "Incident",
+		"category_decision":       "Decision",
+		"category_fyi":            "FYI",
+		"category_social":         "Social",
+		"category_other":          "Other",
+		"hidden_by_filter":        "%d mentions hidden by your category filter",
+		"why":                     "Why?",
+		"view_reply":              "view reply",
+		"digest_header":           "Your mentions digest",
+		"age":                     "%s ago",
+		"continued_in_thread":     "The %d mentions are in the thread below",
+		"button_done":             "Done",
+		"button_snooze_tomorrow":  "Snooze until tomorrow",
+		"button_snooze_week":      "Snooze a week",
+		"button_not_relevant":     "Not relevant",
+		"item_done":               "Marked as done",
+		"item_snoozed":            "Snoozed until %s",
+		"item_not_relevant":       "Marked as not relevant, mentions from this channel will rank lower",
+		"inbox_zero":              "Inbox zero! Nobody mentioned you since the last digest.",
+		"quiet_week_header":       "Your week in mentions",
+		"quiet_week_recap":        "Nothing new today. In the last 7 days you got %d digests with %d mentions.",
+		"quiet_week_none":         "No mentions in the last 7 days, enjoy the quiet week!",
+		"home_history":            "Previous digests",
+		"home_open_actions":       "Open action items",
+		"home_no_open_actions":    "Nothing is waiting on you 🎉",
+		"home_mentions":           "Mentions",
+		"home_more_mentions":      "%d more mentions are in the digest DM",
+		"home_no_digest":          "No digest yet, it is sent every morning.",
+		"home_settings":           "Settings",
+		"home_group_by_category":  "Group by category: %s",
+		"home_language":           "Digest language",
+		"home_language_auto":      "Language of each thread",
+		"home_empty_policy":       "Days without mentions",
+		"empty_policy_skip":       "Send nothing",
+		"empty_policy_inbox_zero": "Short inbox zero note",
+		"empty_policy_quiet_week": "Weekly recap",
+		"changes_since":           "Changes since %s",
+		"changes_removed":         "%d mentions are no longer in the digest",
+		"urgent_header":           "Needs your attention now",
+		"home_batched":            "Held back from your digest",
+		"carry_over":              "Still waiting on you",
+		"new_replies":             "%d new replies",
+		"in_digest_since":         "in your digest since %s",
+		"extractive_notice":       "Possible prompt injection detected, showing the original messages instead of an AI summary",
+		"extractive_mention":      "Mention: %s",
+		"extractive_latest_reply": "Latest reply: %s",
+		"extractive_action":       "Review the thread yourself, it could not be summarised safely",
+	},
+	"es": {
+		"mention_link":            "Enlace a la mención",
+		"click_here":              "Haz clic aquí",
+		"actionable":              "Requiere acción",
+		"priority":                "Prioridad",
+		"yes":                     "Sí",
+		"no":                      "No",
+		"rank_score":              "Puntuación",
+		"summary":                 "Resumen",
+		"action_required":         "Acción requerida",
+		"asked_by":                "pedido por %s",
+		"due":                     "vence %s",
+		"source":                  "origen",
+		"low_confidence":          "confianza baja",
+		"today_at_a_glance":       "Hoy de un vistazo",
+		"overall_load":            "Carga general",
+		"mentions_actionable":     "%d menciones, %d requieren acción",
+		"top_things_to_do":        "Lo más importante",
+		"thread":                  "hilo",
+		"related_threads":         "Hilos relacionados",
+		"load_light":              "Ligera",
+		"load_moderate":           "Moderada",
+		"load_heavy":              "Alta",
+		"injection_warning":       "Posible inyección de instrucciones en este hilo, revisa el resumen con el hilo original",
+		"grounding_warning":       "Algunos detalles de este resumen no aparecen en el hilo, revísalo antes de actuar",
+		"category":                "Categoría",
+		"category_question":       "Pregunta",
+		"category_review_request": "Solicitud de revisión",
+		"category_approval":       "Aprobación",
+		"category_incident":       "Incidente",
+		"category_decision":       "Decisión",
+		"category_fyi":            "Informativo",
+		"category_social":         "Social",
+		"category_other":          "Otros",
+		"hidden_by_filter":        "%d menciones ocultas por tu filtro de categorías",
+		"why":                     "¿Por qué?",
+		"view_reply":              "ver respuesta",
+		"digest_header":           "Tu resumen de menciones",
+		"age":                     "hace %s",
+		"continued_in_thread":     "Las %d menciones están en el hilo de abajo",
+		"button_done":             "Hecho",
+		"button_snooze_tomorrow":  "Posponer hasta mañana",
+		"button_snooze_week":      "Posponer una semana",
+		"button_not_relevant":     "No relevante",
+		"item_done":               "Marcado como hecho",
+		"item_snoozed":            "Pospuesto hasta el %s",
+		"item_not_relevant":       "Marcado como no relevante, las menciones de este canal bajarán en el orden",
+		"inbox_zero":              "¡Bandeja a cero! Nadie te ha mencionado desde el último resumen.",
+		"quiet_week_header":       "Tu semana en menciones",
+		"quiet_week_recap":        "Nada nuevo hoy. En los últimos 7 días recibiste %d resúmenes con %d menciones.",
+		"quiet_week_none":         "Sin menciones en los últimos 7 días, ¡disfruta de la semana tranquila!",
+		"home_history":            "Resúmenes anteriores",
+		"home_open_actions":       "Acciones pendientes",
+		"home_no_open_actions":    "No tienes nada pendiente 🎉",
+		"home_mentions":           "Menciones",
+		"home_more_mentions":      "%d menciones más en el mensaje directo del resumen",
+		"home_no_digest":          "Todavía no hay resumen, se envía cada mañana.",
+		"home_settings":           "Ajustes",
+		"home_group_by_category":  "Agrupar por categoría: %s",
+		"home_language":           "Idioma del resumen",
+		"home_language_auto":      "Idioma de cada hilo",
+		"home_empty_policy":       "Días sin menciones",
+		"empty_policy_skip":       "No enviar nada",
+		"empty_policy_inbox_zero": "Nota breve de bandeja a cero",
+		"empty_policy_quiet_week": "Resumen semanal",
+		"changes_since":           "Cambios desde las %s",
+		"changes_removed":         "%d menciones ya no están en el resumen",
+		"urgent_header":           "Necesita tu atención ahora",
+		"home_batched":            "Retenido fuera de tu resumen",
+		"carry_over":              "Todavía te están esperando",
+		"new_replies":             "%d respuestas nuevas",
+		"in_digest_since":         "en tu resumen desde el %s",
+		"extractive_notice":       "Posible inyección de instrucciones detectada, se muestran los mensajes originales en lugar de un resumen de IA",
+		"extractive_mention":      "Mención: %s",
+		"extractive_latest_reply": "Última respuesta: %s",
+		"extractive_action":       "Revisa el hilo tú mismo, no se pudo resumir de forma segura",
+	},
+	"fr": {
+		"mention_link":            "Lien de la mention",
+		"click_here":              "Cliquez ici",
+		"actionable":              "Action requise",
+		"priority":                "Priorité",
+		"yes":                     "Oui",
+		"no":                      "Non",
+		"rank_score":              "Score",
+		"summary":                 "Résumé",
+		"action_required":         "Actions à faire",
+		"asked_by":                "demandé par %s",
+		"due":                     "échéance %s",
+		"source":                  "source",
+		"low_confidence":          "confiance faible",
+		"today_at_a_glance":       "Aujourd'hui en bref",
+		"overall_load":            "Charge globale",
+		"mentions_actionable":     "%d mentions, %d à traiter",
+		"top_things_to_do":        "À faire en priorité",
+		"thread":                  "fil",
+		"related_threads":         "Fils liés",
+		"load_light":              "Légère",
+		"load_moderate":           "Modérée",
+		"load_heavy":              "Élevée",
+		"injection_warning":       "Possible injection d'instructions dans ce fil, vérifiez le résumé avec le fil d'origine",
+		"grounding_warning":       "Certains détails de ce résumé sont introuvables dans le fil, vérifiez-le avant d'agir",
+		"category":                "Catégorie",
+		"category_question":       "Question",
+		"category_review_request": "Demande de revue",
+		"category_approval":       "Approbation",
+		"category_incident":       "Incident",
+		"category_decision":       "Décision",
+		"category_fyi":            "Pour info",
+		"category_social":         "Social",
+		"category_other":          "Autre",
+		"hidden_by_filter":        "%d mentions masquées par votre filtre de catégories",
+		"why":                     "Pourquoi ?",
+		"view_reply":              "voir la réponse",
+		"digest_header":           "Votre résumé des mentions",
+		"age":                     "il y a %s",
+		"continued_in_thread":     "Les %d mentions sont dans le fil ci-dessous",
+		"button_done":             "Terminé",
+		"button_snooze_tomorrow":  "Reporter à demain",
+		"button_snooze_week":      "Reporter d'une semaine",
+		"button_not_relevant":     "Pas pertinent",
+		"item_done":               "Marqué comme terminé",
+		"item_snoozed":            "Reporté jusqu'au %s",
+		"item_not_relevant":       "Marqué comme non pertinent, les mentions de ce canal seront classées plus bas",
+		"inbox_zero":              "Boîte vide ! Personne ne vous a mentionné depuis le dernier résumé.",
+		"quiet_week_header":       "Votre semaine en mentions",
+		"quiet_week_recap":        "Rien de nouveau aujourd'hui. Ces 7 derniers jours, vous avez reçu %d résumés avec %d mentions.",
+		"quiet_week_none":         "Aucune mention ces 7 derniers jours, profitez de cette semaine calme !",
+		"home_history":            "Résumés précédents",
+		"home_open_actions":       "Actions en attente",
+		"home_no_open_actions":    "Rien ne vous attend 🎉",
+		"home_mentions":           "Mentions",
+		"home_more_mentions":      "%d autres mentions dans le message direct du résumé",
+		"home_no_digest":          "Pas encore de résumé, il est envoyé chaque matin.",
+		"home_settings":           "Paramètres",
+		"home_group_by_category":  "Grouper par catégorie : %s",
+		"home_language":           "Langue du résumé",
+		"home_language_auto":      "Langue de chaque fil",
+		"home_empty_policy":       "Jours sans mentions",
+		"empty_policy_skip":       "Ne rien envoyer",
+		"empty_policy_inbox_zero": "Courte note boîte vide",
+		"empty_policy_quiet_week": "Récapitulatif hebdomadaire",
+		"changes_since":           "Changements depuis %s",
+		"changes_removed":         "%d mentions ne sont plus dans le résumé",
+		"urgent_header":           "Demande votre attention maintenant",
+		"home_batched":            "Mis de côté hors de votre résumé",
+		"carry_over":              "On attend toujours votre réponse",
+		"new_replies":             "%d nouvelles réponses",
+		"in_digest_since":         "dans votre résumé depuis le %s",
+		"extractive_notice":       "Injection de prompt possible détectée, les messages d'origine sont affichés à la place d'un résumé IA",
+		"extractive_mention":      "Mention : %s",
+		"extractive_latest_reply": "Dernière réponse : %s",
+		"extractive_action":       "Consultez le fil vous-même, il n'a pas pu être résumé en toute sécurité",
+	},
+	"de": {
+		"mention_link":            "Link zur Erwähnung",
+		"click_here":              "Hier klicken",
+		"actionable":              "Handlungsbedarf",
+		"priority":                "Priorität",
+		"yes":                     "Ja",
+		"no":                      "Nein",
+		"rank_score":              "Bewertung",
+		"summary":                 "Zusammenfassung",
+		"action_required":         "Erforderliche Aktionen",
+		"asked_by":                "angefragt von %s",
+		"due":                     "fällig %s",
+		"source":                  "Quelle",
+		"low_confidence":          "geringe Sicherheit",
+		"today_at_a_glance":       "Heute auf einen Blick",
+		"overall_load":            "Gesamtlast",
+		"mentions_actionable":     "%d Erwähnungen, %d mit Handlungsbedarf",
+		"top_things_to_do":        "Wichtigste Aufgaben",
+		"thread":                  "Thread",
+		"related_threads":         "Zusammenhängende Threads",
+		"load_light":              "Gering",
+		"load_moderate":           "Mittel",
+		"load_heavy":              "Hoch",
+		"injection_warning":       "Möglicher Prompt-Injection-Versuch in diesem Thread, prüfe die Zusammenfassung anhand des Threads",
+		"grounding_warning":       "Einige Details dieser Zusammenfassung stehen nicht im Thread, prüfe sie vor dem Handeln",
+		"category":                "Kategorie",
+		"category_question":       "Frage",
+		"category_review_request": "Review-Anfrage",
+		"category_approval":       "Freigabe",
+		"category_incident":       "Störung",
+		"category_decision":       "Entscheidung",
+		"category_fyi":            "Zur Info",
+		"category_social":         "Sozial",
+		"category_other":          "Sonstiges",
+		"hidden_by_filter":        "%d Erwähnungen durch deinen Kategoriefilter ausgeblendet",
+		"why":                     "Warum?",
+		"view_reply":              "Antwort ansehen",
+		"digest_header":           "Deine Erwähnungen im Überblick",
+		"age":                     "vor %s",
+		"continued_in_thread":     "Die %d Erwähnungen stehen im Thread unten",
+		"button_done":             "Erledigt",
+		"button_snooze_tomorrow":  "Bis morgen zurückstellen",
+		"button_snooze_week":      "Eine Woche zurückstellen",
+		"button_not_relevant":     "Nicht relevant",
+		"item_done":               "Als erledigt markiert",
+		"item_snoozed":            "Zurückgestellt bis %s",
+		"item_not_relevant":       "Als nicht relevant markiert, Erwähnungen aus diesem Kanal werden niedriger eingestuft",
+		"inbox_zero":              "Posteingang leer! Seit der letzten Zusammenfassung hat dich niemand erwähnt.",
+		"quiet_week_header":       "Deine Woche in Erwähnungen",
+		"quiet_week_recap":        "Heute nichts Neues. In den letzten 7 Tagen hast du %d Zusammenfassungen mit %d Erwähnungen erhalten.",
+		"quiet_week_none":         "Keine Erwähnungen in den letzten 7 Tagen, genieße die ruhige Woche!",
+		"home_history":            "Frühere Zusammenfassungen",
+		"home_open_actions":       "Offene Aufgaben",
+		"home_no_open_actions":    "Nichts wartet auf dich 🎉",
+		"home_mentions":           "Erwähnungen",
+		"home_more_mentions":      "%d weitere Erwähnungen in der Direktnachricht",
+		"home_no_digest":          "Noch keine Zusammenfassung, sie kommt jeden Morgen.",
+		"home_settings":           "Einstellungen",
+		"home_group_by_category":  "Nach Kategorie gruppieren: %s",
+		"home_language":           "Sprache der Zusammenfassung",
+		"home_language_auto":      "Sprache des jeweiligen Threads",
+		"home_empty_policy":       "Tage ohne Erwähnungen",
+		"empty_policy_skip":       "Nichts senden",
+		"empty_policy_inbox_zero": "Kurze Posteingang-leer-Notiz",
+		"empty_policy_quiet_week": "Wöchentlicher Rückblick",
+		"changes_since":           "Änderungen seit %s",
+		"changes_removed":         "%d Erwähnungen sind nicht mehr in der Zusammenfassung",
+		"urgent_header":           "Braucht jetzt deine Aufmerksamkeit",
+		"home_batched":            "Aus deiner Zusammenfassung zurückgehalten",
+		"carry_over":              "Wartet noch auf dich",
+		"new_replies":             "%d neue Antworten",
+		"in_digest_since":         "in deiner Zusammenfassung seit %s",
+		"extractive_notice":       "Mögliche Prompt-Injection erkannt, statt einer KI-Zusammenfassung werden die Originalnachrichten angezeigt",
+		"extractive_mention":      "Erwähnung: %s",
+		"extractive_latest_reply": "Letzte Antwort: %s",
+		"extractive_action":       "Sieh dir den Thread selbst an, er konnte nicht sicher zusammengefasst werden",
+	},
+	"pt": {
+		"mention_link":            "Link da menção",
+		"click_here":              "Clique aqui",
+		"actionable":              "Requer ação",
+		"priority":                "Prioridade",
+		"yes":                     "Sim",
+		"no":                      "Não",
+		"rank_score":              "Pontuação",
+		"summary":                 "Resumo",
+		"action_required":         "Ação necessária",
+		"asked_by":                "pedido por %s",
+		"due":                     "prazo %s",
+		"source":                  "origem",
+		"low_confidence":          "baixa confiança",
+		"today_at_a_glance":       "Hoje num relance",
+		"overall_load":            "Carga geral",
+		"mentions_actionable":     "%d menções, %d requerem ação",
+		"top_things_to_do":        "Principais tarefas",
+		"thread":                  "thread",
+		"related_threads":         "Threads relacionadas",
+		"load_light":              "Leve",
+		"load_moderate":           "Moderada",
+		"load_heavy":              "Pesada",
+		"injection_warning":       "Possível injeção de instruções nesta thread, confira o resumo com a thread original",
+		"grounding_warning":       "Alguns detalhes deste resumo não aparecem na thread, confira antes de agir",
+		"category":                "Categoria",
+		"category_question":       "Pergunta",
+		"category_review_request": "Pedido de revisão",
+		"category_approval":       "Aprovação",
+		"category_incident":       "Incidente",
+		"category_decision":       "Decisão",
+		"category_fyi":            "Informativo",
+		"category_social":         "Social",
+		"category_other":          "Outros",
+		"hidden_by_filter":        "%d menções ocultadas pelo seu filtro de categorias",
+		"why":                     "Por quê?",
+		"view_reply":              "ver resposta",
+		"digest_header":           "Seu resumo de menções",
+		"age":                     "há %s",
+		"continued_in_thread":     "As %d menções estão na thread abaixo",
+		"button_done":             "Feito",
+		"button_snooze_tomorrow":  "Adiar até amanhã",
+		"button_snooze_week":      "Adiar uma semana",
+		"button_not_relevant":     "Não relevante",
+		"item_done":               "Marcado como feito",
+		"item_snoozed":            "Adiado até %s",
+		"item_not_relevant":       "Marcado como não relevante, menções deste canal ficarão mais abaixo",
+		"inbox_zero":              "Caixa zerada! Ninguém mencionou você desde o último resumo.",
+		"quiet_week_header":       "Sua semana em menções",
+		"quiet_week_recap":        "Nada de novo hoje. Nos últimos 7 dias você recebeu %d resumos com %d menções.",
+		"quiet_week_none":         "Nenhuma menção nos últimos 7 dias, aproveite a semana tranquila!",
+		"home_history":            "Resumos anteriores",
+		"home_open_actions":       "Ações pendentes",
+		"home_no_open_actions":    "Nada esperando por você 🎉",
+		"home_mentions":           "Menções",
+		"home_more_mentions":      "Mais %d menções na mensagem direta do resumo",
+		"home_no_digest":          "Ainda não há resumo, ele é enviado toda manhã.",
+		"home_settings":           "Configurações",
+		"home_group_by_category":  "Agrupar por categoria: %s",
+		"home_language":           "Idioma do resumo",
+		"home_language_auto":      "Idioma de cada thread",
+		"home_empty_policy":       "Dias sem menções",
+		"empty_policy_skip":       "Não enviar nada",
+		"empty_policy_inbox_zero": "Nota curta de caixa zerada",
+		"empty_policy_quiet_week": "Resumo semanal",
+		"changes_since":           "Alterações desde as %s",
+		"changes_removed":         "%d menções já não estão no resumo",
+		"urgent_header":           "Precisa da sua atenção agora",
+		"home_batched":            "Retido fora do seu resumo",
+		"carry_over":              "Ainda esperando por você",
+		"new_replies":             "%d novas respostas",
+		"in_digest_since":         "no seu resumo desde %s",
+		"extractive_notice":       "Possível injeção de prompt detectada, mostrando as mensagens originais em vez de um resumo de IA",
+		"extractive_mention":      "Menção: %s",
+		"extractive_latest_reply": "Última resposta: %s",
+		"extractive_action":       "Revise a conversa você mesmo, ela não pôde ser resumida com segurança",
+	},
+	"hi": {
+		"mention_link":            "मेंशन लिंक",
+		"click_here":              "यहाँ क्लिक करें",
+		"actionable":              "कार्रवाई आवश्यक",
+		"priority":                "प्राथमिकता",
+		"yes":                     "हाँ",
+		"no":                      "नहीं",
+		"rank_score":              "रैंक स्कोर",
+		"summary":                 "सारांश",
+		"action_required":         "आवश्यक कार्रवाई",
+		"asked_by":                "%s द्वारा पूछा गया",
+		"due":                     "नियत %s",
+		"source":                  "स्रोत",
+		"low_confidence":          "कम विश्वसनीयता",
+		"today_at_a_glance":       "आज एक नज़र में",
+		"overall_load":            "कुल कार्यभार",
+		"mentions_actionable":     "%d मेंशन, %d पर कार्रवाई आवश्यक",
+		"top_things_to_do":        "सबसे ज़रूरी काम",
+		"thread":                  "थ्रेड",
+		"related_threads":         "संबंधित थ्रेड",
+		"load_light":              "हल्का",
+		"load_moderate":           "मध्यम",
+		"load_heavy":              "भारी",
+		"injection_warning":       "इस थ्रेड में संभावित प्रॉम्प्ट इंजेक्शन, सारांश को थ्रेड से मिलाकर जाँचें",
+		"grounding_warning":       "इस सारांश के कुछ विवरण थ्रेड में नहीं मिले, कार्रवाई से पहले जाँच लें",
+		"category":                "श्रेणी",
+		"category_question":       "प्रश्न",
+		"category_review_request": "समीक्षा अनुरोध",
+		"category_approval":       "स्वीकृति",
+		"category_incident":       "घटना",
+		"category_decision":       "निर्णय",
+		"category_fyi":            "सूचना",
+		"category_social":         "सामाजिक",
+		"category_other":          "अन्य",
+		"hidden_by_filter":        "आपके श्रेणी फ़िल्टर से %d उल्लेख छिपाए गए",
+		"why":                     "क्यों?",
+		"view_reply":              "जवाब देखें",
+		"digest_header":           "आपके उल्लेखों का सारांश",
+		"age":                     "%s पहले",
+		"continued_in_thread":     "सभी %d उल्लेख नीचे थ्रेड में हैं",
+		"button_done":             "हो गया",
+		"button_snooze_tomorrow":  "कल तक टालें",
+		"button_snooze_week":      "एक सप्ताह टालें",
+		"button_not_relevant":     "प्रासंगिक नहीं",
+		"item_done":               "हो गया के रूप में चिह्नित",
+		"item_snoozed":            "%s तक टाला गया",
+		"item_not_relevant":       "प्रासंगिक नहीं के रूप में चिह्नित, इस चैनल के उल्लेख नीचे रखे जाएंगे",
+		"inbox_zero":              "इनबॉक्स ज़ीरो! पिछले डाइजेस्ट के बाद किसी ने आपका उल्लेख नहीं किया।",
+		"quiet_week_header":       "उल्लेखों में आपका सप्ताह",
+		"quiet_week_recap":        "आज कुछ नया नहीं। पिछले 7 दिनों में आपको %d डाइजेस्ट में %d उल्लेख मिले।",
+		"quiet_week_none":         "पिछले 7 दिनों में कोई उल्लेख नहीं, शांत सप्ताह का आनंद लें!",
+		"home_history":            "पिछले डाइजेस्ट",
+		"home_open_actions":       "लंबित कार्य",
+		"home_no_open_actions":    "आपके लिए कुछ भी लंबित नहीं 🎉",
+		"home_mentions":           "उल्लेख",
+		"home_more_mentions":      "डाइजेस्ट DM में %d और उल्लेख हैं",
+		"home_no_digest":          "अभी कोई डाइजेस्ट नहीं, यह हर सुबह भेजा जाता है।",
+		"home_settings":           "सेटिंग्स",
+		"home_group_by_category":  "श्रेणी के अनुसार समूह: %s",
+		"home_language":           "डाइजेस्ट की भाषा",
+		"home_language_auto":      "हर थ्रेड की भाषा",
+		"home_empty_policy":       "बिना उल्लेख वाले दिन",
+		"empty_policy_skip":       "कुछ न भेजें",
+		"empty_policy_inbox_zero": "छोटा इनबॉक्स ज़ीरो नोट",
+		"empty_policy_quiet_week": "साप्ताहिक सारांश",
+		"changes_since":           "%s के बाद के बदलाव",
+		"changes_removed":         "%d उल्लेख अब सारांश में नहीं हैं",
+		"urgent_header":           "अभी आपके ध्यान की ज़रूरत है",
+		"home_batched":            "आपके सारांश से रोके गए",
+		"carry_over":              "अब भी आपका इंतज़ार है",
+		"new_replies":             "%d नए जवाब",
+		"in_digest_since":         "%s से आपके सारांश में",
+		"extractive_notice":       "संभावित प्रॉम्प्ट इंजेक्शन मिला, AI सारांश के बजाय मूल संदेश दिखाए जा रहे हैं",
+		"extractive_mention":      "उल्लेख: %s",
+		"extractive_latest_reply": "नवीनतम उत्तर: %s",
+		"extractive_action":       "थ्रेड को स्वयं देखें, इसे सुरक्षित रूप से सारांशित नहीं किया जा सका",
+	},
+	"ja": {
+		"mention_link":            "メンションへのリンク",
+		"click_here":              "こちら",
+		"actionable":              "要対応",
+		"priority":                "優先度",
+		"yes":                     "はい",
+		"no":                      "いいえ",
+		"rank_score":              "スコア",
+		"summary":                 "概要",
+		"action_required":         "必要な対応",
+		"asked_by":                "依頼者 %s",
+		"due":                     "期限 %s",
+		"source":                  "元のメッセージ",
+		"low_confidence":          "確度低",
+		"today_at_a_glance":       "今日のまとめ",
+		"overall_load":            "全体の負荷",
+		"mentions_actionable":     "メンション %d 件、要対応 %d 件",
+		"top_things_to_do":        "優先してやること",
+		"thread":                  "スレッド",
+		"related_threads":         "関連するスレッド",
+		"load_light":              "軽い",
+		"load_moderate":           "普通",
+		"load_heavy":              "重い",
+		"injection_warning":       "このスレッドにプロンプトインジェクションの可能性があります。概要を元のスレッドで確認してください",
+		"grounding_warning":       "この概要の一部はスレッド内に見つかりませんでした。対応する前に確認してください",
+		"category":                "カテゴリ",
+		"category_question":       "質問",
+		"category_review_request": "レビュー依頼",
+		"category_approval":       "承認",
+		"category_incident":       "インシデント",
+		"category_decision":       "決定",
+		"category_fyi":            "共有",
+		"category_social":         "雑談",
+		"category_other":          "その他",
+		"hidden_by_filter":        "カテゴリフィルターにより%d件のメンションを非表示にしました",
+		"why":                     "理由",
+		"view_reply":              "返信を見る",
+		"digest_header":           "メンションのダイジェスト",
+		"age":                     "%s前",
+		"continued_in_thread":     "%d件のメンションは下のスレッドにあります",
+		"button_done":             "完了",
+		"button_snooze_tomorrow":  "明日まで保留",
+		"button_snooze_week":      "1週間保留",
+		"button_not_relevant":     "関係なし",
+		"item_done":               "完了にしました",
+		"item_snoozed":            "%sまで保留しました",
+		"item_not_relevant":       "関係なしにしました。このチャンネルのメンションは下位に表示されます",
+		"inbox_zero":              "インボックスゼロ！前回のダイジェスト以降、メンションはありません。",
+		"quiet_week_header":       "今週のメンション",
+		"quiet_week_recap":        "今日は新しいメンションはありません。過去7日間に%d件のダイジェストで%d件のメンションがありました。",
+		"quiet_week_none":         "過去7日間メンションはありませんでした。静かな一週間をお過ごしください！",
+		"home_history":            "過去のダイジェスト",
+		"home_open_actions":       "未対応のアクション",
+		"home_no_open_actions":    "対応待ちはありません 🎉",
+		"home_mentions":           "メンション",
+		"home_more_mentions":      "ほか%d件のメンションはダイジェストのDMにあります",
+		"home_no_digest":          "まだダイジェストはありません。毎朝送信されます。",
+		"home_settings":           "設定",
+		"home_group_by_category":  "カテゴリでグループ化: %s",
+		"home_language":           "ダイジェストの言語",
+		"home_language_auto":      "各スレッドの言語",
+		"home_empty_policy":       "メンションがない日",
+		"empty_policy_skip":       "何も送らない",
+		"empty_policy_inbox_zero": "インボックスゼロの短いお知らせ",
+		"empty_policy_quiet_week": "週間まとめ",
+		"changes_since":           "%s 以降の変更",
+		"changes_removed":         "%d 件のメンションがダイジェストから外れました",
+		"urgent_header":           "今すぐ対応が必要です",
+		"home_batched":            "ダイジェストから保留中",
+		"carry_over":              "まだあなたの対応待ち",
+		"new_replies":             "新しい返信 %d 件",
+		"in_digest_since":         "%s からダイジェストに掲載",
+		"extractive_notice":       "プロンプトインジェクションの可能性を検出したため、AI による要約の代わりに元のメッセージを表示しています",
+		"extractive_mention":      "メンション: %s",
+		"extractive_latest_reply": "最新の返信: %s",
+		"extractive_action":       "安全に要約できなかったため、スレッドを直接確認してください",
+	},
+}
+
+// NormaliseLanguage maps user input like "ES" or "es-MX" to a supported code, "" when unsupported
+func NormaliseLanguage(language string) string {
+	language = strings.ToLower(strings.TrimSpace(language))
+	language, _, _ = strings.Cut(strings.ReplaceAll(language, "_", "-"), "-")
+	if _, supported := languageNames[language]; supported {
+		return language
+	}
+	for code, name := range languageNames {
+		if strings.EqualFold(language, name) {
+			return code
+		}
+	}
+	return ""
+}
+
+func LanguageName(language string) string {
+	if name, supported := languageNames[language]; supported {
+		return name
+	}
+	return languageNames[DefaultLanguage]
+}
+
+func SupportedLanguages() []string {
+	return []string{"en", "es", "fr", "de", "pt", "hi", "ja"}
+}
+
+// T looks up a label in the catalog of the language, falling back to english
+func T(language string, key string, args ...interface{}) string {
+	message, found := catalogs[language][key]
+	if !found {
+		message, found = catalogs[DefaultLanguage][key]
+	}
+	if !found {
+		message = key
+	}
+
+	if len(args) > 0 {
+		return fmt.Sprintf(message, args...)
+	}
+	return message
+}
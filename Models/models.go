@@ -1,5 +1,7 @@
 package Models
 
+import "time"
+
 type UniqueMention struct {
 	Timestamp string
 	ChannelId string
@@ -15,21 +17,314 @@ type ConversationsResponse struct {
 type ThreadMessage struct {
 	Text      string
 	Timestamp string
+	// slack user ID of the author
+	User string
 }
 type ConversationResponseEntry struct {
 	MentionPermalink string
 	MentionText      string
 	MentionChannelId string
 	MentionTimestamp string
-	Messages         []ThreadMessage
+	// slack user ID of whoever wrote the mention
+	MentionUserId string
+	// timestamp of the parent message of the thread the mention belongs to
+	ThreadTimestamp string
+	Messages        []ThreadMessage
+}
+
+type ActionItem struct {
+	Description     string `json:"description"`
+	OwnerUserId     string `json:"owner_user_id"`
+	RequesterUserId string `json:"requester_user_id"`
+	// the deadline exactly as it was phrased in the thread e.g. "by EOD Friday"
+	DueText string `json:"due_text"`
+	// resolved from DueText relative to the source message, nil when there is no deadline
+	DueDate                *time.Time `json:"due_date,omitempty"`
+	SourceMessageTimestamp string     `json:"source_message_ts"`
+	SourcePermalink        string     `json:"source_permalink"`
+	// 0 to 1, how sure the model is that this is really an action for the owner
+	Confidence float64 `json:"confidence"`
 }
 
+// EvidenceQuote is an excerpt of a thread message backing the priority of a summary
+type EvidenceQuote struct {
+	// copied verbatim from the message, checked against the thread
+	Quote                  string `json:"quote"`
+	SourceMessageTimestamp string `json:"source_message_ts"`
+	SourcePermalink        string `json:"source_permalink"`
+}
+
+// SummaryCategories are the values of GenAiResponse.Category, in the order a grouped digest shows them
+var SummaryCategories = []string{"incident", "review_request", "approval", "question", "decision", "fyi", "social"}
+
 type GenAiResponse struct {
 	MentionPermalink string
-	Summary          []string `json:"summary"`
-	Actionable       string   `json:"actionable"`
-	ActionRequired   []string `json:"action_required"`
-	Priority         string   `json:"priority"`
+	MentionChannelId string
+	MentionTimestamp string
+	MentionUserId    string
+	// the mention asks the user something instead of only cc-ing them
+	AskedDirectly  bool
+	Summary        []string     `json:"summary"`
+	Actionable     string       `json:"actionable"`
+	ActionRequired []ActionItem `json:"action_required"`
+	Priority       string       `json:"priority"`
+	// one of SummaryCategories, empty when the model gave none of them
+	Category string `json:"category"`
+	// short lower case topics of the thread e.g. "billing"
+	Tags []string `json:"tags"`
+	// why the model chose the priority and the actionable value
+	Rationale string          `json:"rationale"`
+	Evidence  []EvidenceQuote `json:"evidence"`
+	// language the summary was written in
+	Language string
+	// the thread looks like it tries to steer the model, see InjectionReasons
+	InjectionSuspected bool
+	InjectionReasons   []string
+	// 0 to 1, how well the summary is grounded in the thread, see GroundingIssues
+	Confidence      float64 `json:"confidence"`
+	GroundingIssues []string
+	// filled in by RankSummaries, higher is more important
+	RankingScore float64
+	// human readable contributions to RankingScore
+	RankingReasons []string
+}
+
+type OverviewAction struct {
+	Action string `json:"action"`
+	// index of the GenAiResponse in the digest the action comes from
+	ThreadIndex      int `json:"thread"`
+	MentionPermalink string
+}
+
+type RelatedThreads struct {
+	Topic             string `json:"topic"`
+	ThreadIndexes     []int  `json:"threads"`
+	MentionPermalinks []string
+}
+
+type DigestOverview struct {
+	Headline       string           `json:"headline"`
+	TopActions     []OverviewAction `json:"top_actions"`
+	OverallLoad    string           `json:"overall_load"`
+	RelatedThreads []RelatedThreads `json:"related_threads"`
+}
+
+type SummaryCacheEntry struct {
+	CacheKey        string
+	UserID          string
+	ChannelId       string
+	ThreadTimestamp string
+	// the summaries of the mentions in the same thread are cached apart
+	MentionTimestamp string
+	Model            string
+	Response         GenAiResponse
+}
+
+type UserPreferences struct {
+	UserID string
+	// ISO 639-1 code the digest is written in, empty means detect it from the threads
+	Language string
+	// free text layered on top of the base prompt e.g. "keep summaries to two bullets"
+	CustomInstructions string
+	// show the digest in one section per category
+	GroupByCategory bool
+	// only these categories are shown in the digest, empty shows all of them
+	CategoryFilter []string
+	// what happens on a day without mentions, one of EmptyDigestPolicies, empty means DefaultEmptyDigestPolicy
+	EmptyDigestPolicy string
+	// where the digest is delivered e.g. "slack_dm" or "email:someone@example.com", empty means the slack DM
+	DeliveryTargets []string
+	// how each priority is delivered e.g. "P2:weekly", the priorities that are not listed use the defaults
+	PriorityRoutes []string
+}
+
+// kinds of delivery targets, a target is the kind followed by the channel ID, address or URL e.g.
+// "slack_channel:C123", only the slack DM has nothing after it
+const (
+	DeliveryTargetSlackDm      = "slack_dm"
+	DeliveryTargetSlackChannel = "slack_channel"
+	DeliveryTargetEmail        = "email"
+	DeliveryTargetWebhook      = "webhook"
+)
+
+// values of UserPreferences.EmptyDigestPolicy
+const (
+	// nothing is sent
+	EmptyDigestSkip = "skip"
+	// a short note that there was nothing to catch up on
+	EmptyDigestInboxZero = "inbox_zero"
+	// nothing is sent, except for a recap of the last 7 days once a week
+	EmptyDigestQuietWeek = "quiet_week"
+)
+
+var EmptyDigestPolicies = []string{EmptyDigestSkip, EmptyDigestInboxZero, EmptyDigestQuietWeek}
+
+// DefaultEmptyDigestPolicy applies until the user picks a policy, a day without mentions stays as quiet
+// as it was before the policies existed
+const DefaultEmptyDigestPolicy = EmptyDigestSkip
+
+// routes of a priority, see UserPreferences.PriorityRoutes
+const (
+	// an alert of its own as soon as the mention is found, actionable mentions only, the others are
+	// left in the digest. The mention is in the next digest as well.
+	PriorityRouteImmediate = "immediate"
+	// the daily digest
+	PriorityRouteDigest = "digest"
+	// left out of the digest, only listed in the App Home
+	PriorityRouteSilent = "silent"
+	// left out of the digest until the weekly one, on the day of the quiet week recap
+	PriorityRouteWeekly = "weekly"
+)
+
+var PriorityRoutes = []string{PriorityRouteImmediate, PriorityRouteDigest, PriorityRouteSilent, PriorityRouteWeekly}
+
+// Priorities are the values of GenAiResponse.Priority, most urgent first
+var Priorities = []string{"P0", "P1", "P2", "P3"}
+
+// LlmUsage is one LLM call, the prompt and candidate tokens are what the call is billed on
+type LlmUsage struct {
+	RunId       string
+	WorkspaceId string
+	UserId      string
+	// channel:thread_ts of every conversation the call summarised, empty for the digest overview
+	ConversationKeys []string
+	// "summary", "batch" or "overview"
+	Purpose string
+	Model   string
+	// candidate tokens include the thinking tokens as both are billed as output
+	PromptTokens    int
+	CandidateTokens int
+	TotalTokens     int
+	Latency         time.Duration
+	CostUsd         float64
+}
+
+type LlmUsageReportRow struct {
+	// value of the column the report is grouped by e.g. the user ID
+	Key             string  `json:"key"`
+	Calls           int64   `json:"calls"`
+	PromptTokens    int64   `json:"prompt_tokens"`
+	CandidateTokens int64   `json:"candidate_tokens"`
+	TotalTokens     int64   `json:"total_tokens"`
+	CostUsd         float64 `json:"cost_usd"`
+	AvgLatencyMs    float64 `json:"avg_latency_ms"`
+}
+
+// DigestDelivery is one message of a digest that was posted to slack
+type DigestDelivery struct {
+	UserID string
+	// the day the digest is for, YYYY-MM-DD in the digest timezone
+	DigestDate string
+	// the slack delivery target the message was posted for, see DeliveryTargetSlackDm
+	Target string
+	// 0 is the first message of the digest, the replies in its thread follow in order
+	PartIndex        int
+	ChannelId        string
+	MessageTimestamp string
+	// hash of what was posted, a re-run only updates the message when it changed
+	ContentHash string
+}
+
+// states of a DigestItem, an item the user did not act on stays open
+const (
+	DigestItemOpen        = "open"
+	DigestItemDone        = "done"
+	DigestItemSnoozed     = "snoozed"
+	DigestItemNotRelevant = "not_relevant"
+)
+
+// DigestItem is a mention that was shown in a digest and what the user did with it
+type DigestItem struct {
+	UserID           string
+	ChannelId        string
+	MentionTimestamp string
+	MentionPermalink string
+	MentionUserId    string
+	// one of the DigestItem* states
+	State string
+	// a snoozed item comes back in the first digest after this time
+	SnoozedUntil *time.Time
+}
+
+// outcomes of a DigestRun
+const (
+	DigestRunSent    = "sent"
+	DigestRunSkipped = "skipped"
+	DigestRunFailed  = "failed"
+)
+
+// DigestRun is the outcome of the daily digest for one user
+type DigestRun struct {
+	RunId  string `json:"run_id"`
+	UserID string `json:"user_id"`
+	// YYYY-MM-DD in the digest timezone
+	DigestDate string `json:"digest_date"`
+	// one of the DigestRun* outcomes
+	Outcome string `json:"outcome"`
+	// what was sent e.g. "digest" or "inbox_zero", why it was skipped, or the error when it failed
+	Detail       string    `json:"detail"`
+	MentionCount int       `json:"mention_count"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// DigestRunTotals sums the digests sent to a user over a period
+type DigestRunTotals struct {
+	Digests  int
+	Mentions int
+}
+
+// outcomes of a DigestPublication
+const (
+	DigestPublicationSent   = "sent"
+	DigestPublicationFailed = "failed"
+)
+
+// DigestPublication is the delivery of the digest of a day to one of the targets of the user
+type DigestPublication struct {
+	UserID     string `json:"user_id"`
+	DigestDate string `json:"digest_date"`
+	Target     string `json:"target"`
+	// one of the DigestPublication* outcomes
+	Status string `json:"status"`
+	// empty when the digest was sent
+	Error     string    `json:"error"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// StoredDigest is the digest of a day as it was sent, kept so it can be shown again without re-running the pipeline
+type StoredDigest struct {
+	UserID     string
+	DigestDate string
+	// the language the fixed labels were rendered in
+	Language    string
+	Overview    *DigestOverview
+	Responses   []GenAiResponse
+	HiddenCount int
+	// the mentions left out of the digest by the priority routes of the user, silent or weekly
+	Batched []GenAiResponse
+	// the actionable mentions of earlier digests that are still open, shown as "still waiting on you"
+	CarryOver []CarryOverItem
+	CreatedAt time.Time
+}
+
+// CarryOverItem is an actionable mention of an earlier digest the user neither acted on nor answered in
+// its thread
+type CarryOverItem struct {
+	// the mention as it was last summarised
+	Response GenAiResponse
+	// the day of the first digest the mention was in
+	FirstDigestDate string
+	// replies in the thread since the mention was last in a digest
+	NewReplies int
+}
+
+// UrgentAlert is a mention that was sent to the user on its own, see PriorityRouteImmediate
+type UrgentAlert struct {
+	UserID           string
+	ChannelId        string
+	MentionTimestamp string
+	MessageTimestamp string
+	SentAt           time.Time
 }
 
 type User struct {
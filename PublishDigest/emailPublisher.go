@@ -0,0 +1,115 @@
+package PublishDigest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"time"
+
+	"slack-tag-summariser/Models"
+)
+
+// SmtpConfig is read from SMTP_HOST, SMTP_PORT (587 by default), SMTP_USERNAME, SMTP_PASSWORD and
+// SMTP_FROM, the credentials are optional for a relay that does not need them
+type SmtpConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func GetSmtpConfig() SmtpConfig {
+	smtpPort := os.Getenv("SMTP_PORT")
+	if smtpPort == "" {
+		smtpPort = "587"
+	}
+	return SmtpConfig{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     smtpPort,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+	}
+}
+
+// EmailPublisher sends the digest as a multipart email with a plain text and an HTML body
+type EmailPublisher struct {
+	Address string
+	Config  SmtpConfig
+}
+
+func (publisher EmailPublisher) Target() string {
+	return Models.DeliveryTargetEmail + ":" + publisher.Address
+}
+
+func writeMimePart(writer *multipart.Writer, contentType string, body string) error {
+	partWriter, createPartError := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType + "; charset=UTF-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if createPartError != nil {
+		return createPartError
+	}
+	encoder := quotedprintable.NewWriter(partWriter)
+	if _, writeError := encoder.Write([]byte(body)); writeError != nil {
+		return writeError
+	}
+	return encoder.Close()
+}
+
+// buildEmailMessage returns the whole message as it is sent over SMTP, headers included
+func buildEmailMessage(from string, to string, subject string, textBody string, htmlBody string, now time.Time) ([]byte, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	// the last alternative is the preferred one
+	if writeError := writeMimePart(writer, "text/plain", textBody); writeError != nil {
+		return nil, writeError
+	}
+	if writeError := writeMimePart(writer, "text/html", htmlBody); writeError != nil {
+		return nil, writeError
+	}
+	if closeError := writer.Close(); closeError != nil {
+		return nil, closeError
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", from)
+	fmt.Fprintf(&message, "To: %s\r\n", to)
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", subject))
+	fmt.Fprintf(&message, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", writer.Boundary())
+	message.Write(body.Bytes())
+	return message.Bytes(), nil
+}
+
+func (publisher EmailPublisher) Publish(_ context.Context, digest Digest) error {
+	config := publisher.Config
+	if config.Host == "" || config.From == "" {
+		return fmt.Errorf("email delivery is not configured, set SMTP_HOST and SMTP_FROM")
+	}
+
+	subject, textBody, htmlBody, renderError := renderEmail(digest)
+	if renderError != nil {
+		return renderError
+	}
+	message, buildMessageError := buildEmailMessage(config.From, publisher.Address, subject, textBody, htmlBody, time.Now())
+	if buildMessageError != nil {
+		return buildMessageError
+	}
+
+	// net/smtp upgrades to TLS when the server offers it and only sends the credentials over TLS or to localhost
+	var auth smtp.Auth
+	if config.Username != "" {
+		auth = smtp.PlainAuth("", config.Username, config.Password, config.Host)
+	}
+	return smtp.SendMail(net.JoinHostPort(config.Host, config.Port), auth, config.From, []string{publisher.Address}, message)
+}
@@ -0,0 +1,171 @@
+package PublishDigest
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"slack-tag-summariser/PublishToSlack"
+)
+
+// smtpStandIn accepts a single message on the loopback, with just enough of SMTP for net/smtp
+type smtpStandIn struct {
+	listener net.Listener
+	from     string
+	to       []string
+	messages chan string
+}
+
+func newSmtpStandIn(t *testing.T) *smtpStandIn {
+	t.Helper()
+	listener, listenError := net.Listen("tcp", "127.0.0.1:0")
+	if listenError != nil {
+		t.Fatal(listenError)
+	}
+	standIn := &smtpStandIn{listener: listener, messages: make(chan string, 1)}
+	t.Cleanup(func() { listener.Close() })
+	go standIn.serve()
+	return standIn
+}
+
+func (standIn *smtpStandIn) serve() {
+	conn, acceptError := standIn.listener.Accept()
+	if acceptError != nil {
+		return
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	reply := func(line string) {
+		io.WriteString(conn, line+"\r\n")
+	}
+	reply("220 localhost ESMTP stand-in")
+	for {
+		line, readError := reader.ReadString('\n')
+		if readError != nil {
+			return
+		}
+		command := strings.TrimSpace(line)
+		switch verb := strings.ToUpper(strings.SplitN(command, " ", 2)[0]); {
+		case verb == "EHLO" || verb == "HELO":
+			reply("250 localhost")
+		case strings.HasPrefix(strings.ToUpper(command), "MAIL FROM:"):
+			standIn.from = strings.Trim(command[len("MAIL FROM:"):], "<>")
+			reply("250 OK")
+		case strings.HasPrefix(strings.ToUpper(command), "RCPT TO:"):
+			standIn.to = append(standIn.to, strings.Trim(command[len("RCPT TO:"):], "<>"))
+			reply("250 OK")
+		case verb == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var message strings.Builder
+			for {
+				dataLine, dataError := reader.ReadString('\n')
+				if dataError != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				message.WriteString(strings.TrimPrefix(dataLine, "."))
+			}
+			standIn.messages <- message.String()
+			reply("250 OK")
+		case verb == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestEmailPublisherSendsMultipartAlternative(t *testing.T) {
+	standIn := newSmtpStandIn(t)
+	host, port, _ := net.SplitHostPort(standIn.listener.Addr().String())
+
+	publisher := EmailPublisher{
+		Address: "someone@example.com",
+		Config:  SmtpConfig{Host: host, Port: port, From: "digest@example.com"},
+	}
+	if publishError := publisher.Publish(context.Background(), newTestDigest()); publishError != nil {
+		t.Fatal(publishError)
+	}
+	rawMessage := <-standIn.messages
+
+	if standIn.from != "digest@example.com" || len(standIn.to) != 1 || standIn.to[0] != "someone@example.com" {
+		t.Errorf("envelope from %q to %v, want digest@example.com to someone@example.com", standIn.from, standIn.to)
+	}
+
+	message, readMessageError := mail.ReadMessage(strings.NewReader(rawMessage))
+	if readMessageError != nil {
+		t.Fatal(readMessageError)
+	}
+	if to := message.Header.Get("To"); to != "someone@example.com" {
+		t.Errorf("To = %q, want someone@example.com", to)
+	}
+	mediaType, params, parseMediaError := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if parseMediaError != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, want multipart/alternative", message.Header.Get("Content-Type"))
+	}
+
+	// the plain text comes first and the HTML last, as the last alternative is the preferred one
+	bodies := make(map[string]string)
+	var contentTypes []string
+	partReader := multipart.NewReader(message.Body, params["boundary"])
+	for {
+		part, nextPartError := partReader.NextPart()
+		if nextPartError == io.EOF {
+			break
+		}
+		if nextPartError != nil {
+			t.Fatal(nextPartError)
+		}
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		// the multipart reader decodes quoted-printable on its own
+		body, _ := io.ReadAll(part)
+		contentTypes = append(contentTypes, partType)
+		bodies[partType] = string(body)
+	}
+	if strings.Join(contentTypes, ",") != "text/plain,text/html" {
+		t.Fatalf("parts = %v, want text/plain then text/html", contentTypes)
+	}
+	for partType, body := range bodies {
+		if !strings.Contains(body, "Issue the refund of invoice 4711") {
+			t.Errorf("the %s part does not have the action item:\n%s", partType, body)
+		}
+	}
+	if !strings.Contains(bodies["text/html"], "<html") {
+		t.Errorf("the text/html part is not HTML:\n%s", bodies["text/html"])
+	}
+}
+
+func TestEmailPublisherNeedsSmtpConfig(t *testing.T) {
+	publisher := EmailPublisher{Address: "someone@example.com"}
+	if publishError := publisher.Publish(context.Background(), newTestDigest()); publishError == nil {
+		t.Error("publishing without SMTP_HOST and SMTP_FROM did not fail")
+	}
+}
+
+func TestRenderEmailOfANote(t *testing.T) {
+	digest := newTestDigest()
+	digest.Responses = nil
+	note := PublishToSlack.QuietWeekRecapNote("en", PublishToSlack.DigestRunTotals{Digests: 3, Mentions: 7})
+	digest.Note = &note
+
+	subject, textBody, htmlBody, renderError := renderEmail(digest)
+	if renderError != nil {
+		t.Fatal(renderError)
+	}
+	if !strings.HasSuffix(subject, "2023-11-15") {
+		t.Errorf("subject = %q, want the day of the note", subject)
+	}
+	if !strings.Contains(textBody, "🌿") || !strings.Contains(htmlBody, "<p>🌿") {
+		t.Errorf("the bodies do not have the note:\n%s\n%s", textBody, htmlBody)
+	}
+}
@@ -0,0 +1,227 @@
+package PublishDigest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"slack-tag-summariser/Models"
+	"slack-tag-summariser/PublishToSlack"
+	"slack-tag-summariser/Repo"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/slack-go/slack"
+)
+
+type GenAiResponse = Models.GenAiResponse
+type DigestOverview = Models.DigestOverview
+
+// Digest is everything a publisher needs to render the digest of a user
+type Digest struct {
+	UserID    string
+	Options   PublishToSlack.DigestOptions
+	Overview  *DigestOverview
+	Responses []GenAiResponse
+	// sent instead of the mentions on a day without any, see PublishToSlack.DigestNote
+	Note *PublishToSlack.DigestNote
+}
+
+// Publisher delivers the digest to one target
+type Publisher interface {
+	// Target is the delivery target the publisher was made for e.g. "email:someone@example.com"
+	Target() string
+	Publish(ctx context.Context, digest Digest) error
+}
+
+// InPlacePublisher is a publisher that can update what it already sent today instead of sending it again,
+// those get the digest on every re-run
+type InPlacePublisher interface {
+	Publisher
+	UpdatesInPlace() bool
+}
+
+func updatesInPlace(publisher Publisher) bool {
+	inPlacePublisher, ok := publisher.(InPlacePublisher)
+	return ok && inPlacePublisher.UpdatesInPlace()
+}
+
+// slack escapes channels as "<#C123|name>", links as "<https://...>" and addresses as "<mailto:a@b.c|a@b.c>"
+var slackChannelReferenceRegex = regexp.MustCompile(`^<#([CG][A-Z0-9]+)(?:\|[^>]*)?>$`)
+var slackChannelIdRegex = regexp.MustCompile(`^[CG][A-Z0-9]+$`)
+
+func unescapeSlackLink(text string) string {
+	if !strings.HasPrefix(text, "<") || !strings.HasSuffix(text, ">") {
+		return text
+	}
+	link, _, _ := strings.Cut(strings.TrimSuffix(strings.TrimPrefix(text, "<"), ">"), "|")
+	return strings.TrimPrefix(link, "mailto:")
+}
+
+// isInternalAddress tells whether the address is on the loopback, a private network or link-local,
+// any workspace user can add a webhook so it must not reach the services next to the app
+func isInternalAddress(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified()
+}
+
+// validateWebhookUrl only accepts https to a host that resolves to public addresses, the addresses are
+// checked again when the webhook is called, see newWebhookHttpClient
+func validateWebhookUrl(rawUrl string) error {
+	webhookUrl, parseError := url.Parse(rawUrl)
+	if parseError != nil || webhookUrl.Host == "" {
+		return fmt.Errorf("%q is not a URL", rawUrl)
+	}
+	if webhookUrl.Scheme != "https" {
+		return fmt.Errorf("webhook %q has to use https", rawUrl)
+	}
+
+	ctx, cancelLookup := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancelLookup()
+	addresses, lookupError := net.DefaultResolver.LookupIPAddr(ctx, webhookUrl.Hostname())
+	if lookupError != nil {
+		return fmt.Errorf("the host of webhook %q cannot be resolved: %w", rawUrl, lookupError)
+	}
+	for _, address := range addresses {
+		if isInternalAddress(address.IP) {
+			return fmt.Errorf("webhook %q points at the internal address %s", rawUrl, address.IP)
+		}
+	}
+	return nil
+}
+
+// ParseDeliveryTarget normalises a target the way it is typed in slack: "dm", a channel like "#general",
+// an email address or a webhook URL, each optionally prefixed with its kind e.g. "email:someone@example.com"
+func ParseDeliveryTarget(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if strings.EqualFold(text, "dm") || strings.EqualFold(text, Models.DeliveryTargetSlackDm) {
+		return Models.DeliveryTargetSlackDm, nil
+	}
+	if match := slackChannelReferenceRegex.FindStringSubmatch(text); match != nil {
+		return Models.DeliveryTargetSlackChannel + ":" + match[1], nil
+	}
+
+	kind, value, hasKind := strings.Cut(text, ":")
+	switch {
+	case hasKind && (strings.EqualFold(kind, "channel") || strings.EqualFold(kind, Models.DeliveryTargetSlackChannel)):
+		if match := slackChannelReferenceRegex.FindStringSubmatch(value); match != nil {
+			value = match[1]
+		}
+		if !slackChannelIdRegex.MatchString(value) {
+			return "", fmt.Errorf("%q is not a channel ID", value)
+		}
+		return Models.DeliveryTargetSlackChannel + ":" + value, nil
+
+	case hasKind && strings.EqualFold(kind, Models.DeliveryTargetWebhook):
+		webhookUrl := unescapeSlackLink(value)
+		if validateError := validateWebhookUrl(webhookUrl); validateError != nil {
+			return "", validateError
+		}
+		return Models.DeliveryTargetWebhook + ":" + webhookUrl, nil
+
+	case hasKind && strings.EqualFold(kind, Models.DeliveryTargetEmail):
+		text = value
+	}
+
+	text = unescapeSlackLink(text)
+	if strings.HasPrefix(text, "https://") || strings.HasPrefix(text, "http://") {
+		if validateError := validateWebhookUrl(text); validateError != nil {
+			return "", validateError
+		}
+		return Models.DeliveryTargetWebhook + ":" + text, nil
+	}
+	address, parseAddressError := mail.ParseAddress(text)
+	if parseAddressError != nil {
+		return "", fmt.Errorf("%q is not a channel, an email address or a webhook URL", text)
+	}
+	return Models.DeliveryTargetEmail + ":" + address.Address, nil
+}
+
+// NewPublisher makes the publisher of a target saved in the preferences of the user
+func NewPublisher(target string, slackBotApi *slack.Client) (Publisher, error) {
+	kind, value, _ := strings.Cut(target, ":")
+	switch kind {
+	case Models.DeliveryTargetSlackDm:
+		return SlackDmPublisher{SlackClient: slackBotApi}, nil
+	case Models.DeliveryTargetSlackChannel:
+		return SlackChannelPublisher{SlackClient: slackBotApi, ChannelId: value}, nil
+	case Models.DeliveryTargetEmail:
+		return EmailPublisher{Address: value, Config: GetSmtpConfig()}, nil
+	case Models.DeliveryTargetWebhook:
+		return NewWebhookPublisher(value), nil
+	}
+	return nil, fmt.Errorf("unknown delivery target %q", target)
+}
+
+// NewPublishers makes the publishers of the targets of the user, without any the digest goes to the slack DM
+func NewPublishers(targets []string, slackBotApi *slack.Client) []Publisher {
+	var publishers []Publisher
+	for _, target := range targets {
+		publisher, newPublisherError := NewPublisher(target, slackBotApi)
+		if newPublisherError != nil {
+			log.Printf("PublishDigest:NewPublishers#Skipping target: %s", newPublisherError.Error())
+			continue
+		}
+		publishers = append(publishers, publisher)
+	}
+	if len(publishers) == 0 {
+		publishers = append(publishers, SlackDmPublisher{SlackClient: slackBotApi})
+	}
+	return publishers
+}
+
+// PublishToTargets publishes the digest to every target that did not get it yet today, or that updates it
+// in place, and records each attempt on its own. It returns how many targets have the digest and the errors
+// of the ones that failed.
+func PublishToTargets(ctx context.Context, publishers []Publisher, digest Digest, dbPool *pgxpool.Pool) (int, error) {
+	digestDate := digest.Options.DigestDate
+	if dbPool == nil || digestDate == "" {
+		return publishToTargets(ctx, publishers, digest, nil, nil)
+	}
+
+	previousPublications, getPublicationsError := Repo.GetDigestPublications(digest.UserID, digestDate, dbPool)
+	if getPublicationsError != nil {
+		log.Printf("PublishDigest:PublishToTargets#Error reading the publications of %s: %s", digest.UserID, getPublicationsError.Error())
+		previousPublications = nil
+	}
+	return publishToTargets(ctx, publishers, digest, previousPublications, func(publication Models.DigestPublication) {
+		if savePublicationError := Repo.SaveDigestPublication(publication, dbPool); savePublicationError != nil {
+			log.Printf("PublishDigest:PublishToTargets#Error saving the publication to %s: %s", publication.Target, savePublicationError.Error())
+		}
+	})
+}
+
+// publishToTargets skips the targets the previous publications already sent the digest to and hands every
+// attempt to record, nil when the publications are not recorded
+func publishToTargets(ctx context.Context, publishers []Publisher, digest Digest, previousPublications map[string]Models.DigestPublication, record func(Models.DigestPublication)) (int, error) {
+	digestDate := digest.Options.DigestDate
+
+	sentCount := 0
+	var publishErrors []error
+	for _, publisher := range publishers {
+		target := publisher.Target()
+		if previousPublications[target].Status == Models.DigestPublicationSent && !updatesInPlace(publisher) {
+			log.Printf("PublishDigest:PublishToTargets#The digest of %s for %s was already published to %s", digestDate, digest.UserID, target)
+			sentCount++
+			continue
+		}
+
+		publication := Models.DigestPublication{UserID: digest.UserID, DigestDate: digestDate, Target: target, Status: Models.DigestPublicationSent}
+		if publishError := publisher.Publish(ctx, digest); publishError != nil {
+			publication.Status = Models.DigestPublicationFailed
+			publication.Error = publishError.Error()
+			publishErrors = append(publishErrors, fmt.Errorf("%s: %w", target, publishError))
+		} else {
+			sentCount++
+		}
+
+		if record != nil {
+			record(publication)
+		}
+	}
+	return sentCount, errors.Join(publishErrors...)
+}
@@ -0,0 +1,124 @@
+package PublishDigest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"slack-tag-summariser/Models"
+	"slack-tag-summariser/PublishToSlack"
+)
+
+// fakePublisher publishes nothing and fails with publishError when it is set
+type fakePublisher struct {
+	target       string
+	publishError error
+	published    *int
+}
+
+func (publisher fakePublisher) Target() string {
+	return publisher.target
+}
+
+func (publisher fakePublisher) Publish(_ context.Context, _ Digest) error {
+	*publisher.published++
+	return publisher.publishError
+}
+
+func newTestDigest() Digest {
+	return Digest{
+		UserID:  "U0EVALUSER",
+		Options: PublishToSlack.DigestOptions{Language: "en", DigestDate: "2023-11-15"},
+		Responses: []GenAiResponse{{
+			MentionPermalink: "https://example.slack.com/archives/C0BILLING/p1700000000000100",
+			MentionChannelId: "C0BILLING",
+			MentionTimestamp: "1700000000.000100",
+			Summary:          []string{"<@U0SUPPORT> asks why invoice 4711 was charged twice"},
+			Actionable:       "Yes",
+			ActionRequired:   []Models.ActionItem{{Description: "Issue the refund of invoice 4711", OwnerUserId: "U0EVALUSER"}},
+			Priority:         "P1",
+			Category:         "question",
+		}},
+	}
+}
+
+func TestPublishToTargetsRecordsEveryTarget(t *testing.T) {
+	var published int
+	publishers := []Publisher{
+		fakePublisher{target: "email:someone@example.com", published: &published},
+		fakePublisher{target: "webhook:https://example.com/hook", publishError: errors.New("webhook answered 500"), published: &published},
+		fakePublisher{target: "slack_channel:C0DIGEST", published: &published},
+	}
+	previousPublications := map[string]Models.DigestPublication{
+		"slack_channel:C0DIGEST": {Target: "slack_channel:C0DIGEST", Status: Models.DigestPublicationSent},
+	}
+
+	var recorded []Models.DigestPublication
+	sentCount, publishError := publishToTargets(context.Background(), publishers, newTestDigest(), previousPublications, func(publication Models.DigestPublication) {
+		recorded = append(recorded, publication)
+	})
+
+	if sentCount != 2 {
+		t.Errorf("sentCount = %d, want 2 as the channel already had the digest", sentCount)
+	}
+	if published != 2 {
+		t.Errorf("published %d times, want 2 as the channel is not sent again", published)
+	}
+	if publishError == nil || !strings.Contains(publishError.Error(), "webhook:https://example.com/hook: webhook answered 500") {
+		t.Errorf("publishError = %v, want the error of the webhook", publishError)
+	}
+
+	if len(recorded) != 2 {
+		t.Fatalf("recorded %d publications, want 2: %+v", len(recorded), recorded)
+	}
+	if recorded[0].Target != "email:someone@example.com" || recorded[0].Status != Models.DigestPublicationSent || recorded[0].Error != "" {
+		t.Errorf("email publication = %+v, want it sent", recorded[0])
+	}
+	if recorded[1].Target != "webhook:https://example.com/hook" || recorded[1].Status != Models.DigestPublicationFailed || recorded[1].Error != "webhook answered 500" {
+		t.Errorf("webhook publication = %+v, want it failed with its error", recorded[1])
+	}
+	for _, publication := range recorded {
+		if publication.UserID != "U0EVALUSER" || publication.DigestDate != "2023-11-15" {
+			t.Errorf("publication = %+v, want the user and the day of the digest", publication)
+		}
+	}
+}
+
+func TestValidateWebhookUrl(t *testing.T) {
+	tests := []struct {
+		url       string
+		wantValid bool
+	}{
+		{"https://93.184.216.34/hook", true},
+		{"http://localhost:8080/hook", false},
+		{"https://localhost:8080/hook", false},
+		{"http://127.0.0.1:8080/hook", false},
+		{"https://127.0.0.1:8080/hook", false},
+		{"https://[::1]:8080/hook", false},
+		{"http://93.184.216.34/hook", false},
+		{"https://127.0.0.2/hook", false},
+		{"https://10.0.0.5/hook", false},
+		{"https://192.168.1.10/hook", false},
+		{"https://172.16.0.1/hook", false},
+		{"https://169.254.169.254/latest/meta-data", false},
+		{"https://[fe80::1]/hook", false},
+		{"https://[fd00::1]/hook", false},
+		{"https://0.0.0.0/hook", false},
+		{"not a url", false},
+	}
+	for _, test := range tests {
+		validateError := validateWebhookUrl(test.url)
+		if (validateError == nil) != test.wantValid {
+			t.Errorf("validateWebhookUrl(%q) = %v, want valid %v", test.url, validateError, test.wantValid)
+		}
+	}
+}
+
+func TestParseDeliveryTargetRefusesLocalWebhooks(t *testing.T) {
+	for _, text := range []string{"webhook:http://localhost:8080/hook", "<http://127.0.0.1:8080/hook>", "webhook:https://[::1]/hook"} {
+		if target, parseError := ParseDeliveryTarget(text); parseError == nil {
+			t.Errorf("ParseDeliveryTarget(%q) = %q, want the local webhook to be refused", text, target)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package PublishDigest
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+	textTemplate "text/template"
+	"time"
+
+	"slack-tag-summariser/Localisation"
+	"slack-tag-summariser/Models"
+	"slack-tag-summariser/RenderDigest"
+)
+
+type emailActionItem struct {
+	Description string
+	Details     string
+}
+
+type emailMention struct {
+	Permalink      string
+	Priority       string
+	Actionable     string
+	Category       string
+	Summary        []string
+	ActionRequired []emailActionItem
+}
+
+// emailDigest holds the translated labels and the plain text of the digest for the plain text part
+type emailDigest struct {
+	Title         string
+	Headline      string
+	TopActions    []string
+	CarryOver     []string
+	HiddenText    string
+	Labels        map[string]string
+	Mentions      []emailMention
+	MentionsCount string
+}
+
+func newEmailDigest(digest Digest) emailDigest {
+	language := digest.Options.Language
+	view := emailDigest{
+		Title:  Localisation.T(language, "digest_header"),
+		Labels: make(map[string]string),
+	}
+	for _, key := range []string{"today_at_a_glance", "top_things_to_do", "carry_over", "priority", "actionable", "category", "summary", "action_required", "mention_link"} {
+		view.Labels[key] = Localisation.T(language, key)
+	}
+
+	actionableCount := 0
+	for _, r := range digest.Responses {
+		mention := emailMention{
+			Permalink:  r.MentionPermalink,
+			Priority:   r.Priority,
+			Actionable: r.Actionable,
+			Category:   RenderDigest.CategoryLabel(r.Category, language),
+		}
+		switch strings.ToLower(r.Actionable) {
+		case "yes":
+			actionableCount++
+			mention.Actionable = Localisation.T(language, "yes")
+		case "no":
+			mention.Actionable = Localisation.T(language, "no")
+		}
+		for _, s := range r.Summary {
+			mention.Summary = append(mention.Summary, RenderDigest.PlainTextFromMrkdwn(s))
+		}
+		for _, a := range r.ActionRequired {
+			var details []string
+			if a.OwnerUserId != "" {
+				details = append(details, "@"+a.OwnerUserId)
+			}
+			if a.DueDate != nil {
+				details = append(details, Localisation.T(language, "due", a.DueDate.Format("2006-01-02 15:04")))
+			} else if a.DueText != "" {
+				details = append(details, a.DueText)
+			}
+			mention.ActionRequired = append(mention.ActionRequired, emailActionItem{
+				Description: RenderDigest.PlainTextFromMrkdwn(a.Description),
+				Details:     strings.Join(details, " · "),
+			})
+		}
+		view.Mentions = append(view.Mentions, mention)
+	}
+	view.MentionsCount = Localisation.T(language, "mentions_actionable", len(digest.Responses), actionableCount)
+
+	if digest.Overview != nil {
+		view.Headline = RenderDigest.PlainTextFromMrkdwn(digest.Overview.Headline)
+		for _, a := range digest.Overview.TopActions {
+			view.TopActions = append(view.TopActions, RenderDigest.PlainTextFromMrkdwn(a.Action))
+		}
+	}
+	for i, carried := range digest.Options.CarryOver {
+		item := RenderDigest.NewCarryOverData(carried, i, language, time.Now())
+		line := fmt.Sprintf("%s %s", carried.Response.Priority, RenderDigest.PlainTextFromMrkdwn(item.Task()))
+		var details []string
+		if item.Age != "" {
+			details = append(details, Localisation.T(language, "age", item.Age))
+		}
+		if item.NewReplies > 0 {
+			details = append(details, Localisation.T(language, "new_replies", item.NewReplies))
+		}
+		if len(details) > 0 {
+			line += " (" + strings.Join(details, " · ") + ")"
+		}
+		view.CarryOver = append(view.CarryOver, line+" "+carried.Response.MentionPermalink)
+	}
+	if digest.Options.HiddenCount > 0 {
+		view.HiddenText = Localisation.T(language, "hidden_by_filter", digest.Options.HiddenCount)
+	}
+	return view
+}
+
+var emailTextTemplate = textTemplate.Must(textTemplate.New("email.txt").Parse(`{{.Title}}
+{{.MentionsCount}}
+{{if .Headline}}
+{{.Labels.today_at_a_glance}}: {{.Headline}}
+{{end}}{{if .TopActions}}
+{{.Labels.top_things_to_do}}:
+{{range .TopActions}}  - {{.}}
+{{end}}{{end}}{{if .CarryOver}}
+{{.Labels.carry_over}}:
+{{range .CarryOver}}  - {{.}}
+{{end}}{{end}}{{range .Mentions}}
+----------------------------------------
+{{$.Labels.priority}}: {{.Priority}} | {{$.Labels.actionable}}: {{.Actionable}} | {{$.Labels.category}}: {{.Category}}
+{{range .Summary}}- {{.}}
+{{end}}{{if .ActionRequired}}{{$.Labels.action_required}}:
+{{range .ActionRequired}}  * {{.Description}}{{if .Details}} ({{.Details}}){{end}}
+{{end}}{{end}}{{$.Labels.mention_link}}: {{.Permalink}}
+{{end}}{{if .HiddenText}}
+{{.HiddenText}}
+{{end}}`))
+
+// renderEmail returns the subject and the plain text and HTML bodies of the digest, the HTML is the
+// HTML export of RenderDigest with the template overrides of the workspace
+func renderEmail(digest Digest) (string, string, string, error) {
+	if digest.Note != nil {
+		subject, textBody, htmlBody := renderEmailNote(digest)
+		return subject, textBody, htmlBody, nil
+	}
+
+	view := newEmailDigest(digest)
+	subject := fmt.Sprintf("%s %s: %s", view.Title, digest.Options.DigestDate, view.MentionsCount)
+
+	var textBody bytes.Buffer
+	if renderError := emailTextTemplate.Execute(&textBody, view); renderError != nil {
+		return "", "", "", renderError
+	}
+
+	htmlRenderer, rendererError := RenderDigest.NewRenderer(RenderDigest.FormatHtml, digest.Options.WorkspaceId)
+	if rendererError != nil {
+		return "", "", "", rendererError
+	}
+	htmlBody, renderError := htmlRenderer.Render(RenderDigest.TemplateDigest, RenderDigest.NewDigestData(Models.StoredDigest{
+		Language:    digest.Options.Language,
+		DigestDate:  digest.Options.DigestDate,
+		Overview:    digest.Overview,
+		Responses:   digest.Responses,
+		HiddenCount: digest.Options.HiddenCount,
+		CarryOver:   digest.Options.CarryOver,
+	}, digest.Options.GroupByCategory, time.Now()))
+	if renderError != nil {
+		return "", "", "", renderError
+	}
+	return subject, textBody.String(), htmlBody, nil
+}
+
+// renderEmailNote returns the subject and the bodies of a note, it is too short for the digest templates
+func renderEmailNote(digest Digest) (string, string, string) {
+	header := Localisation.T(digest.Options.Language, digest.Note.HeaderKey)
+	text := RenderDigest.PlainTextFromMrkdwn(digest.Note.Text)
+	subject := fmt.Sprintf("%s %s", header, digest.Options.DigestDate)
+	htmlBody := fmt.Sprintf("<!DOCTYPE html>\n<html lang=\"%s\">\n<body>\n<h1>%s</h1>\n<p>%s</p>\n</body>\n</html>\n",
+		html.EscapeString(digest.Options.Language), html.EscapeString(header), html.EscapeString(text))
+	return subject, header + "\n\n" + text + "\n", htmlBody
+}
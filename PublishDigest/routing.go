@@ -0,0 +1,126 @@
+package PublishDigest
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"slack-tag-summariser/Models"
+)
+
+// defaultPriorityRoutes only interrupts the user for what cannot wait, the routes of the user replace
+// these one priority at a time. Anything without a known priority goes to the digest.
+var defaultPriorityRoutes = map[string]string{
+	"P0": Models.PriorityRouteImmediate,
+	"P1": Models.PriorityRouteDigest,
+	"P2": Models.PriorityRouteSilent,
+	"P3": Models.PriorityRouteSilent,
+}
+
+// RoutingPolicy says how the mentions of each priority reach the user
+type RoutingPolicy struct {
+	routes map[string]string
+}
+
+// ParsePriorityRoute normalises a route the way it is typed in slack e.g. "p2 weekly" or "P2:weekly"
+func ParsePriorityRoute(priority string, route string) (string, error) {
+	priority = strings.ToUpper(strings.TrimSpace(priority))
+	if !slices.Contains(Models.Priorities, priority) {
+		return "", fmt.Errorf("unknown priority %q, use one of %s", priority, strings.Join(Models.Priorities, ", "))
+	}
+	route = strings.ToLower(strings.TrimSpace(route))
+	if !slices.Contains(Models.PriorityRoutes, route) {
+		return "", fmt.Errorf("unknown route %q, use one of %s", route, strings.Join(Models.PriorityRoutes, ", "))
+	}
+	return priority + ":" + route, nil
+}
+
+// NewRoutingPolicy applies the routes saved in the preferences of the user over the defaults, a route
+// that is not valid anymore is skipped
+func NewRoutingPolicy(priorityRoutes []string) RoutingPolicy {
+	policy := RoutingPolicy{routes: make(map[string]string, len(defaultPriorityRoutes))}
+	for priority, route := range defaultPriorityRoutes {
+		policy.routes[priority] = route
+	}
+	for _, priorityRoute := range priorityRoutes {
+		priority, route, _ := strings.Cut(priorityRoute, ":")
+		normalised, parseError := ParsePriorityRoute(priority, route)
+		if parseError != nil {
+			log.Printf("PublishDigest:NewRoutingPolicy#Skipping route %q: %s", priorityRoute, parseError.Error())
+			continue
+		}
+		priority, route, _ = strings.Cut(normalised, ":")
+		policy.routes[priority] = route
+	}
+	return policy
+}
+
+// PriorityRoute is the route of a priority, the digest for an unknown one
+func (policy RoutingPolicy) PriorityRoute(priority string) string {
+	if route, exists := policy.routes[strings.ToUpper(strings.TrimSpace(priority))]; exists {
+		return route
+	}
+	return Models.PriorityRouteDigest
+}
+
+// Route is the route of a mention, only actionable mentions are sent on their own
+func (policy RoutingPolicy) Route(r GenAiResponse) string {
+	route := policy.PriorityRoute(r.Priority)
+	if route == Models.PriorityRouteImmediate && strings.ToLower(r.Actionable) != "yes" {
+		return Models.PriorityRouteDigest
+	}
+	return route
+}
+
+// HasImmediate tells whether any priority is sent on its own, the urgent checks skip the user otherwise
+func (policy RoutingPolicy) HasImmediate() bool {
+	for _, route := range policy.routes {
+		if route == Models.PriorityRouteImmediate {
+			return true
+		}
+	}
+	return false
+}
+
+// Routes lists the route of every priority in order e.g. "P0:immediate"
+func (policy RoutingPolicy) Routes() []string {
+	var routes []string
+	for _, priority := range Models.Priorities {
+		routes = append(routes, priority+":"+policy.PriorityRoute(priority))
+	}
+	return routes
+}
+
+// Immediate returns the mentions that are sent on their own
+func (policy RoutingPolicy) Immediate(responses []GenAiResponse) []GenAiResponse {
+	var immediate []GenAiResponse
+	for _, r := range responses {
+		if policy.Route(r) == Models.PriorityRouteImmediate {
+			immediate = append(immediate, r)
+		}
+	}
+	return immediate
+}
+
+// SplitDigest separates the mentions of the digest from the ones that are batched, in the same order.
+// The mentions sent on their own are in the digest as well, and on the day of the weekly digest the
+// weekly mentions are too.
+func (policy RoutingPolicy) SplitDigest(responses []GenAiResponse, weeklyDigest bool) ([]GenAiResponse, []GenAiResponse) {
+	var digestResponses, batched []GenAiResponse
+	for _, r := range responses {
+		switch policy.Route(r) {
+		case Models.PriorityRouteSilent:
+			batched = append(batched, r)
+		case Models.PriorityRouteWeekly:
+			if weeklyDigest {
+				digestResponses = append(digestResponses, r)
+			} else {
+				batched = append(batched, r)
+			}
+		default:
+			digestResponses = append(digestResponses, r)
+		}
+	}
+	return digestResponses, batched
+}
@@ -0,0 +1,53 @@
+package PublishDigest
+
+import (
+	"context"
+
+	"slack-tag-summariser/Models"
+	"slack-tag-summariser/PublishToSlack"
+
+	"github.com/slack-go/slack"
+)
+
+// SlackDmPublisher sends the digest as a DM from the bot, the only target with the item buttons
+type SlackDmPublisher struct {
+	SlackClient *slack.Client
+}
+
+func (publisher SlackDmPublisher) Target() string {
+	return Models.DeliveryTargetSlackDm
+}
+
+// UpdatesInPlace is true as the messages of the day are remembered and updated on a re-run
+func (publisher SlackDmPublisher) UpdatesInPlace() bool {
+	return true
+}
+
+func (publisher SlackDmPublisher) Publish(_ context.Context, digest Digest) error {
+	if digest.Note != nil {
+		return PublishToSlack.SendNote(publisher.SlackClient, digest.UserID, publisher.Target(), digest.UserID, digest.Options, *digest.Note)
+	}
+	_, sendSlackDmError := PublishToSlack.SendSlackDm(publisher.SlackClient, digest.UserID, digest.Options, digest.Overview, digest.Responses)
+	return sendSlackDmError
+}
+
+// SlackChannelPublisher posts the digest in a channel, the bot has to be a member of it
+type SlackChannelPublisher struct {
+	SlackClient *slack.Client
+	ChannelId   string
+}
+
+func (publisher SlackChannelPublisher) Target() string {
+	return Models.DeliveryTargetSlackChannel + ":" + publisher.ChannelId
+}
+
+func (publisher SlackChannelPublisher) UpdatesInPlace() bool {
+	return true
+}
+
+func (publisher SlackChannelPublisher) Publish(_ context.Context, digest Digest) error {
+	if digest.Note != nil {
+		return PublishToSlack.SendNote(publisher.SlackClient, digest.UserID, publisher.Target(), publisher.ChannelId, digest.Options, *digest.Note)
+	}
+	return PublishToSlack.SendSlackChannel(publisher.SlackClient, digest.UserID, publisher.ChannelId, digest.Options, digest.Overview, digest.Responses)
+}
@@ -0,0 +1,41 @@
+package PublishDigest
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"slack-tag-summariser/Models"
+	"slack-tag-summariser/PublishToSlack"
+	"slack-tag-summariser/Repo"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/slack-go/slack"
+)
+
+// PublishUrgentAlerts sends every mention as a slack DM of its own and records it so it is not sent
+// again. The alerts always go to the DM, wherever the digest is delivered, as the DM is what notifies
+// the user. It returns how many were sent and the errors of the ones that failed.
+func PublishUrgentAlerts(slackBotApi *slack.Client, userId string, digestOptions PublishToSlack.DigestOptions, responses []GenAiResponse, dbPool *pgxpool.Pool) (int, error) {
+	sentCount := 0
+	var alertErrors []error
+	for _, r := range responses {
+		messageTimestamp, sendAlertError := PublishToSlack.SendUrgentAlert(slackBotApi, userId, digestOptions, r)
+		if sendAlertError != nil {
+			alertErrors = append(alertErrors, fmt.Errorf("%s: %w", r.MentionPermalink, sendAlertError))
+			continue
+		}
+		sentCount++
+
+		saveAlertError := Repo.SaveUrgentAlert(Models.UrgentAlert{
+			UserID:           userId,
+			ChannelId:        r.MentionChannelId,
+			MentionTimestamp: r.MentionTimestamp,
+			MessageTimestamp: messageTimestamp,
+		}, dbPool)
+		if saveAlertError != nil {
+			log.Printf("PublishDigest:PublishUrgentAlerts#Error saving the alert for %s: %s", r.MentionPermalink, saveAlertError.Error())
+		}
+	}
+	return sentCount, errors.Join(alertErrors...)
+}
@@ -0,0 +1,202 @@
+package PublishDigest
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"slack-tag-summariser/Localisation"
+	"slack-tag-summariser/Models"
+	"slack-tag-summariser/RenderDigest"
+)
+
+const webhookTimeout = 10 * time.Second
+
+// WebhookPublisher posts the digest as JSON. Every request is signed like the requests of slack: the
+// X-Digest-Signature header is "v1=" and the hex HMAC-SHA256 of "v1:<X-Digest-Timestamp>:<body>" with
+// the DIGEST_WEBHOOK_SECRET as the key.
+type WebhookPublisher struct {
+	Url        string
+	Secret     string
+	HttpClient *http.Client
+}
+
+func NewWebhookPublisher(webhookUrl string) WebhookPublisher {
+	return WebhookPublisher{
+		Url:        webhookUrl,
+		Secret:     os.Getenv("DIGEST_WEBHOOK_SECRET"),
+		HttpClient: newWebhookHttpClient(),
+	}
+}
+
+// newWebhookHttpClient refuses to connect to internal addresses, the host of a webhook can resolve to
+// another address than when it was saved and a redirect can point anywhere
+func newWebhookHttpClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: webhookTimeout,
+		Control: func(_ string, address string, _ syscall.RawConn) error {
+			host, _, splitError := net.SplitHostPort(address)
+			if splitError != nil {
+				return splitError
+			}
+			ip := net.ParseIP(host)
+			if ip == nil {
+				return fmt.Errorf("webhook address %s is not an IP", host)
+			}
+			if isInternalAddress(ip) {
+				return fmt.Errorf("webhook address %s is internal", ip)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// the address check has to see the webhook itself and not a proxy in between
+	transport.Proxy = nil
+	return &http.Client{Timeout: webhookTimeout, Transport: transport}
+}
+
+func (publisher WebhookPublisher) Target() string {
+	return Models.DeliveryTargetWebhook + ":" + publisher.Url
+}
+
+type webhookMention struct {
+	Permalink      string                 `json:"permalink"`
+	ChannelId      string                 `json:"channel_id"`
+	MentionTs      string                 `json:"mention_ts"`
+	Priority       string                 `json:"priority"`
+	Actionable     bool                   `json:"actionable"`
+	Category       string                 `json:"category"`
+	Tags           []string               `json:"tags"`
+	Summary        []string               `json:"summary"`
+	ActionRequired []Models.ActionItem    `json:"action_required"`
+	Rationale      string                 `json:"rationale"`
+	Evidence       []Models.EvidenceQuote `json:"evidence"`
+	Confidence     float64                `json:"confidence"`
+	RankingScore   float64                `json:"ranking_score"`
+}
+
+// webhookCarryOver is an open mention of an earlier digest
+type webhookCarryOver struct {
+	webhookMention
+	FirstDigestDate string `json:"first_digest_date"`
+	NewReplies      int    `json:"new_replies"`
+}
+
+type webhookPayload struct {
+	UserId      string           `json:"user_id"`
+	DigestDate  string           `json:"digest_date"`
+	Language    string           `json:"language"`
+	Overview    *DigestOverview  `json:"overview"`
+	Mentions    []webhookMention `json:"mentions"`
+	HiddenCount int              `json:"hidden_count"`
+	// empty when nothing of the earlier digests is still open
+	CarryOver []webhookCarryOver `json:"carry_over"`
+	// only set on a day without mentions, the mentions are empty then
+	Note *webhookNote `json:"note,omitempty"`
+}
+
+type webhookNote struct {
+	Header string `json:"header"`
+	Text   string `json:"text"`
+}
+
+func newWebhookMention(r GenAiResponse) webhookMention {
+	return webhookMention{
+		Permalink:      r.MentionPermalink,
+		ChannelId:      r.MentionChannelId,
+		MentionTs:      r.MentionTimestamp,
+		Priority:       r.Priority,
+		Actionable:     strings.EqualFold(r.Actionable, "yes"),
+		Category:       r.Category,
+		Tags:           r.Tags,
+		Summary:        r.Summary,
+		ActionRequired: r.ActionRequired,
+		Rationale:      r.Rationale,
+		Evidence:       r.Evidence,
+		Confidence:     r.Confidence,
+		RankingScore:   r.RankingScore,
+	}
+}
+
+func newWebhookPayload(digest Digest) webhookPayload {
+	payload := webhookPayload{
+		UserId:      digest.UserID,
+		DigestDate:  digest.Options.DigestDate,
+		Language:    digest.Options.Language,
+		Overview:    digest.Overview,
+		Mentions:    []webhookMention{},
+		HiddenCount: digest.Options.HiddenCount,
+		CarryOver:   []webhookCarryOver{},
+	}
+	if digest.Note != nil {
+		payload.Note = &webhookNote{
+			Header: Localisation.T(digest.Options.Language, digest.Note.HeaderKey),
+			Text:   RenderDigest.PlainTextFromMrkdwn(digest.Note.Text),
+		}
+	}
+	for _, r := range digest.Responses {
+		payload.Mentions = append(payload.Mentions, newWebhookMention(r))
+	}
+	for _, carried := range digest.Options.CarryOver {
+		payload.CarryOver = append(payload.CarryOver, webhookCarryOver{
+			webhookMention:  newWebhookMention(carried.Response),
+			FirstDigestDate: carried.FirstDigestDate,
+			NewReplies:      carried.NewReplies,
+		})
+	}
+	return payload
+}
+
+// SignWebhookBody returns the X-Digest-Signature of a body sent at the given unix timestamp
+func SignWebhookBody(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v1:" + timestamp + ":"))
+	mac.Write(body)
+	return "v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (publisher WebhookPublisher) Publish(ctx context.Context, digest Digest) error {
+	// an unsigned digest could be forged by anyone who knows the URL, so nothing is sent without the secret
+	if publisher.Secret == "" {
+		return fmt.Errorf("webhook delivery is not configured, set DIGEST_WEBHOOK_SECRET")
+	}
+
+	body, marshalError := json.Marshal(newWebhookPayload(digest))
+	if marshalError != nil {
+		return marshalError
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	request, newRequestError := http.NewRequestWithContext(ctx, http.MethodPost, publisher.Url, bytes.NewReader(body))
+	if newRequestError != nil {
+		return newRequestError
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Digest-Timestamp", timestamp)
+	request.Header.Set("X-Digest-Signature", SignWebhookBody(publisher.Secret, timestamp, body))
+
+	response, postError := publisher.HttpClient.Do(request)
+	if postError != nil {
+		return postError
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, response.Body)
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered %s", response.Status)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package PublishDigest
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"slack-tag-summariser/PublishToSlack"
+)
+
+func TestWebhookPublisherSignsTheDigest(t *testing.T) {
+	var requestHeader http.Header
+	var requestBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestHeader = r.Header.Clone()
+		requestBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	// the production client refuses the loopback, the test server is reached with its own client
+	publisher := WebhookPublisher{Url: server.URL + "/digest", Secret: "test-secret", HttpClient: server.Client()}
+	if publishError := publisher.Publish(context.Background(), newTestDigest()); publishError != nil {
+		t.Fatal(publishError)
+	}
+
+	timestamp := requestHeader.Get("X-Digest-Timestamp")
+	if timestamp == "" {
+		t.Fatal("the request has no X-Digest-Timestamp")
+	}
+	if signature := requestHeader.Get("X-Digest-Signature"); signature != SignWebhookBody("test-secret", timestamp, requestBody) {
+		t.Errorf("X-Digest-Signature = %q, want the signature of the body", signature)
+	}
+	if SignWebhookBody("another-secret", timestamp, requestBody) == requestHeader.Get("X-Digest-Signature") {
+		t.Error("the signature does not depend on the secret")
+	}
+	if contentType := requestHeader.Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", contentType)
+	}
+
+	var payload webhookPayload
+	if jsonUnmarshallError := json.Unmarshal(requestBody, &payload); jsonUnmarshallError != nil {
+		t.Fatal(jsonUnmarshallError)
+	}
+	if payload.UserId != "U0EVALUSER" || payload.DigestDate != "2023-11-15" || len(payload.Mentions) != 1 || !payload.Mentions[0].Actionable {
+		t.Errorf("payload = %+v, want the digest of the user", payload)
+	}
+}
+
+func TestWebhookPublisherFailsOnErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	publisher := WebhookPublisher{Url: server.URL, Secret: "test-secret", HttpClient: server.Client()}
+	publishError := publisher.Publish(context.Background(), newTestDigest())
+	if publishError == nil || !strings.Contains(publishError.Error(), "500") {
+		t.Errorf("publishError = %v, want the status of the webhook", publishError)
+	}
+}
+
+func TestWebhookPublisherRefusesInternalAddresses(t *testing.T) {
+	t.Setenv("DIGEST_WEBHOOK_SECRET", "test-secret")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the internal address was called")
+	}))
+	defer server.Close()
+
+	// a host that resolved to a public address when it was saved can resolve to the loopback later on
+	publisher := NewWebhookPublisher("https://hooks.example.com/digest")
+	publisher.Url = server.URL
+	if publishError := publisher.Publish(context.Background(), newTestDigest()); publishError == nil || !strings.Contains(publishError.Error(), "internal") {
+		t.Errorf("publishError = %v, want the internal address to be refused", publishError)
+	}
+}
+
+func TestWebhookPayloadOfANote(t *testing.T) {
+	note := PublishToSlack.InboxZeroNote("en")
+	payload := newWebhookPayload(Digest{
+		UserID:  "U0EVALUSER",
+		Options: PublishToSlack.DigestOptions{Language: "en", DigestDate: "2023-11-15"},
+		Note:    &note,
+	})
+	if payload.Note == nil || payload.Note.Header == "" || !strings.Contains(payload.Note.Text, "🎉") {
+		t.Errorf("note = %+v, want the header and the text of the note", payload.Note)
+	}
+	if payload.Mentions == nil || len(payload.Mentions) != 0 {
+		t.Errorf("mentions = %v, want an empty list", payload.Mentions)
+	}
+}
@@ -0,0 +1,301 @@
+package PublishToSlack
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"slack-tag-summariser/Localisation"
+	"slack-tag-summariser/Models"
+	"slack-tag-summariser/RenderDigest"
+
+	"github.com/slack-go/slack"
+)
+
+// action IDs of the App Home, see HandleSlackInteraction
+const (
+	ActionHomeSelectDate  = "home_select_date"
+	ActionHomeToggleGroup = "home_toggle_group"
+	ActionHomeLanguage    = "home_language"
+	ActionHomeEmptyPolicy = "home_empty_policy"
+)
+
+// slack rejects a home view with more than 100 blocks, these keep it well below
+const (
+	maxHomeOpenActions = 15
+	maxHomeMentions    = 20
+	maxHomeBatched     = 10
+)
+
+// languageAuto is the value of the language option that detects the language of each thread
+const languageAuto = "auto"
+
+// AppHome is what the App Home of a user is rendered from, all of it is read from the database
+type AppHome struct {
+	Preferences Models.UserPreferences
+	// nil before the first digest of the user
+	Digest *Models.StoredDigest
+	// the days with a digest, newest first
+	DigestDates []string
+	// what the user did with the mentions, keyed by DigestItemKey
+	ItemStates map[string]Models.DigestItem
+	Location   *time.Location
+}
+
+// DigestItemKey identifies a mention across digests, it is also the value of the item buttons
+func DigestItemKey(channelId string, mentionTimestamp string) string {
+	return channelId + ":" + mentionTimestamp
+}
+
+func (home AppHome) language() string {
+	switch {
+	case home.Preferences.Language != "":
+		return home.Preferences.Language
+	case home.Digest != nil && home.Digest.Language != "":
+		return home.Digest.Language
+	}
+	return Localisation.DefaultLanguage
+}
+
+func (home AppHome) itemState(r GenAiResponse) Models.DigestItem {
+	if item, exists := home.ItemStates[DigestItemKey(r.MentionChannelId, r.MentionTimestamp)]; exists {
+		return item
+	}
+	return Models.DigestItem{State: Models.DigestItemOpen}
+}
+
+func formatHomeItemState(item Models.DigestItem, language string, location *time.Location) string {
+	switch item.State {
+	case Models.DigestItemDone:
+		return "✅ " + Localisation.T(language, "button_done")
+	case Models.DigestItemNotRelevant:
+		return "🙈 " + Localisation.T(language, "button_not_relevant")
+	case Models.DigestItemSnoozed:
+		return formatDigestItemConfirmation(item, language, location)
+	}
+	return ""
+}
+
+func newHomeOption(value string, label string) *slack.OptionBlockObject {
+	return slack.NewOptionBlockObject(value, newPlainText(label, maxButtonTextLength), nil)
+}
+
+func buildHomeHistoryBlock(home AppHome, language string) slack.Block {
+	var options []*slack.OptionBlockObject
+	var selected *slack.OptionBlockObject
+	for _, digestDate := range home.DigestDates {
+		option := newHomeOption(digestDate, digestDate)
+		if home.Digest != nil && digestDate == home.Digest.DigestDate {
+			selected = option
+		}
+		options = append(options, option)
+	}
+	historySelect := slack.NewOptionsSelectBlockElement(slack.OptTypeStatic,
+		newPlainText(Localisation.T(language, "home_history"), maxButtonTextLength), ActionHomeSelectDate, options...)
+	if selected != nil {
+		historySelect.WithInitialOption(selected)
+	}
+	return slack.NewActionBlock("home_history", historySelect)
+}
+
+// buildHomeOpenActionBlocks lists the actionable mentions of the digest the user did not close yet
+func buildHomeOpenActionBlocks(home AppHome, language string) []slack.Block {
+	blocks := []slack.Block{slack.NewHeaderBlock(newPlainText("🎯 "+Localisation.T(language, "home_open_actions"), maxHeaderTextLength),
+		slack.HeaderBlockOptionBlockID("home_open_actions"))}
+
+	// the mentions carried over from earlier digests are still to do as well
+	openResponses := slices.Clone(home.Digest.Responses)
+	for _, carried := range home.Digest.CarryOver {
+		openResponses = append(openResponses, carried.Response)
+	}
+
+	openCount := 0
+	for i, r := range openResponses {
+		item := home.itemState(r)
+		if strings.ToLower(r.Actionable) != "yes" || item.State == Models.DigestItemDone || item.State == Models.DigestItemNotRelevant {
+			continue
+		}
+		if openCount == maxHomeOpenActions {
+			break
+		}
+		openCount++
+
+		var text strings.Builder
+		text.WriteString(fmt.Sprintf("%s `%s` *<%s|%s>*", RenderDigest.PriorityEmoji(r.Priority), r.Priority, r.MentionPermalink, Localisation.T(language, "mention_link")))
+		if stateText := formatHomeItemState(item, language, home.Location); stateText != "" {
+			text.WriteString(" · _" + stateText + "_")
+		}
+		for _, a := range r.ActionRequired {
+			text.WriteString("\n• " + formatActionItem(a, language))
+		}
+		if len(r.ActionRequired) == 0 && len(r.Summary) > 0 {
+			text.WriteString("\n" + r.Summary[0])
+		}
+
+		var doneButton *slack.Accessory
+		if r.MentionChannelId != "" && r.MentionTimestamp != "" {
+			doneButton = slack.NewAccessory(newDigestItemButton(ActionDigestItemDone, "✅ "+Localisation.T(language, "button_done"),
+				DigestItemKey(r.MentionChannelId, r.MentionTimestamp)))
+		}
+		blocks = append(blocks, slack.NewSectionBlock(newMrkdwnText(text.String(), maxSectionTextLength), nil, doneButton,
+			slack.SectionBlockOptionBlockID(fmt.Sprintf("home_open_%d", i))))
+	}
+
+	if openCount == 0 {
+		blocks = append(blocks, newContextBlock("home_no_open_actions", Localisation.T(language, "home_no_open_actions")))
+	}
+	return blocks
+}
+
+func buildHomeMentionBlocks(home AppHome, language string) []slack.Block {
+	blocks := []slack.Block{slack.NewHeaderBlock(newPlainText("📝 "+Localisation.T(language, "home_mentions"), maxHeaderTextLength),
+		slack.HeaderBlockOptionBlockID("home_mentions"))}
+
+	for i, r := range home.Digest.Responses {
+		if i == maxHomeMentions {
+			blocks = append(blocks, newContextBlock("home_more_mentions", Localisation.T(language, "home_more_mentions", len(home.Digest.Responses)-maxHomeMentions)))
+			break
+		}
+
+		var text strings.Builder
+		text.WriteString(fmt.Sprintf("%s `%s` *<%s|%s>* · %s", RenderDigest.PriorityEmoji(r.Priority), r.Priority, r.MentionPermalink,
+			Localisation.T(language, "mention_link"), RenderDigest.CategoryLabel(r.Category, language)))
+		if stateText := formatHomeItemState(home.itemState(r), language, home.Location); stateText != "" {
+			text.WriteString(" · _" + stateText + "_")
+		}
+		for j, s := range r.Summary {
+			text.WriteString(fmt.Sprintf("\n%d. %s", j+1, s))
+		}
+		blocks = append(blocks, slack.NewSectionBlock(newMrkdwnText(text.String(), maxSectionTextLength), nil, nil,
+			slack.SectionBlockOptionBlockID(fmt.Sprintf("home_mention_%d", i))))
+	}
+	return blocks
+}
+
+// buildHomeBatchedBlocks lists the mentions the priority routes of the user kept out of the digest, the
+// App Home is the only place the silent ones are shown
+func buildHomeBatchedBlocks(home AppHome, language string) []slack.Block {
+	blocks := []slack.Block{slack.NewHeaderBlock(newPlainText("🔕 "+Localisation.T(language, "home_batched"), maxHeaderTextLength),
+		slack.HeaderBlockOptionBlockID("home_batched"))}
+
+	for i, r := range home.Digest.Batched {
+		if i == maxHomeBatched {
+			blocks = append(blocks, newContextBlock("home_more_batched", Localisation.T(language, "home_more_mentions", len(home.Digest.Batched)-maxHomeBatched)))
+			break
+		}
+
+		var text strings.Builder
+		text.WriteString(fmt.Sprintf("%s `%s` *<%s|%s>* · %s", RenderDigest.PriorityEmoji(r.Priority), r.Priority, r.MentionPermalink,
+			Localisation.T(language, "mention_link"), RenderDigest.CategoryLabel(r.Category, language)))
+		if stateText := formatHomeItemState(home.itemState(r), language, home.Location); stateText != "" {
+			text.WriteString(" · _" + stateText + "_")
+		}
+		if len(r.Summary) > 0 {
+			text.WriteString("\n" + r.Summary[0])
+		}
+		blocks = append(blocks, slack.NewSectionBlock(newMrkdwnText(text.String(), maxSectionTextLength), nil, nil,
+			slack.SectionBlockOptionBlockID(fmt.Sprintf("home_batched_%d", i))))
+	}
+	return blocks
+}
+
+// buildHomeSettingsBlocks shows each setting as a section with its control next to it
+func buildHomeSettingsBlocks(home AppHome, language string) []slack.Block {
+	groupValue := Localisation.T(language, "no")
+	if home.Preferences.GroupByCategory {
+		groupValue = Localisation.T(language, "yes")
+	}
+	groupButton := newDigestItemButton(ActionHomeToggleGroup, "📂 "+Localisation.T(language, "home_group_by_category", groupValue), "toggle")
+
+	languageOptions := []*slack.OptionBlockObject{newHomeOption(languageAuto, Localisation.T(language, "home_language_auto"))}
+	selectedLanguage := languageOptions[0]
+	for _, supportedLanguage := range Localisation.SupportedLanguages() {
+		option := newHomeOption(supportedLanguage, Localisation.LanguageName(supportedLanguage))
+		if supportedLanguage == home.Preferences.Language {
+			selectedLanguage = option
+		}
+		languageOptions = append(languageOptions, option)
+	}
+	languageSelect := slack.NewOptionsSelectBlockElement(slack.OptTypeStatic,
+		newPlainText(Localisation.T(language, "home_language"), maxButtonTextLength), ActionHomeLanguage, languageOptions...).
+		WithInitialOption(selectedLanguage)
+
+	emptyDigestPolicy := home.Preferences.EmptyDigestPolicy
+	if emptyDigestPolicy == "" {
+		emptyDigestPolicy = Models.DefaultEmptyDigestPolicy
+	}
+	var policyOptions []*slack.OptionBlockObject
+	var selectedPolicy *slack.OptionBlockObject
+	for _, policy := range Models.EmptyDigestPolicies {
+		option := newHomeOption(policy, Localisation.T(language, "empty_policy_"+policy))
+		if policy == emptyDigestPolicy {
+			selectedPolicy = option
+		}
+		policyOptions = append(policyOptions, option)
+	}
+	policySelect := slack.NewOptionsSelectBlockElement(slack.OptTypeStatic,
+		newPlainText(Localisation.T(language, "home_empty_policy"), maxButtonTextLength), ActionHomeEmptyPolicy, policyOptions...).
+		WithInitialOption(selectedPolicy)
+
+	return []slack.Block{
+		slack.NewHeaderBlock(newPlainText("⚙️ "+Localisation.T(language, "home_settings"), maxHeaderTextLength),
+			slack.HeaderBlockOptionBlockID("home_settings")),
+		slack.NewSectionBlock(newMrkdwnText("*"+Localisation.T(language, "category")+"*", maxSectionTextLength), nil,
+			slack.NewAccessory(groupButton), slack.SectionBlockOptionBlockID("home_setting_group")),
+		slack.NewSectionBlock(newMrkdwnText("*"+Localisation.T(language, "home_language")+"*", maxSectionTextLength), nil,
+			slack.NewAccessory(languageSelect), slack.SectionBlockOptionBlockID("home_setting_language")),
+		slack.NewSectionBlock(newMrkdwnText("*"+Localisation.T(language, "home_empty_policy")+"*", maxSectionTextLength), nil,
+			slack.NewAccessory(policySelect), slack.SectionBlockOptionBlockID("home_setting_empty_policy")),
+	}
+}
+
+// BuildAppHomeView renders the App Home: the selected digest, its open action items, the history and the settings
+func BuildAppHomeView(home AppHome) slack.HomeTabViewRequest {
+	language := home.language()
+
+	blocks := []slack.Block{slack.NewHeaderBlock(newPlainText("📬 "+Localisation.T(language, "digest_header"), maxHeaderTextLength),
+		slack.HeaderBlockOptionBlockID("home_header"))}
+
+	if home.Digest == nil {
+		blocks = append(blocks, newContextBlock("home_no_digest", Localisation.T(language, "home_no_digest")))
+	} else {
+		blocks = append(blocks, newContextBlock("home_digest_summary",
+			"🗓️ "+home.Digest.DigestDate, Localisation.T(language, "mentions_actionable", len(home.Digest.Responses), countActionable(home.Digest.Responses))))
+		if len(home.DigestDates) > 1 {
+			blocks = append(blocks, buildHomeHistoryBlock(home, language))
+		}
+		if home.Digest.Overview != nil && home.Digest.Overview.Headline != "" {
+			blocks = append(blocks, slack.NewSectionBlock(newMrkdwnText(home.Digest.Overview.Headline, maxSectionTextLength), nil, nil,
+				slack.SectionBlockOptionBlockID("home_headline")))
+		}
+		blocks = append(blocks, slack.NewDividerBlock())
+		blocks = append(blocks, buildHomeOpenActionBlocks(home, language)...)
+		blocks = append(blocks, slack.NewDividerBlock())
+		blocks = append(blocks, buildHomeMentionBlocks(home, language)...)
+		if len(home.Digest.Batched) > 0 {
+			blocks = append(blocks, slack.NewDividerBlock())
+			blocks = append(blocks, buildHomeBatchedBlocks(home, language)...)
+		}
+	}
+
+	blocks = append(blocks, slack.NewDividerBlock())
+	blocks = append(blocks, buildHomeSettingsBlocks(home, language)...)
+
+	view := slack.HomeTabViewRequest{
+		Type:   slack.VTHomeTab,
+		Blocks: slack.Blocks{BlockSet: blocks},
+	}
+	// the interactions of the view keep showing the same day
+	if home.Digest != nil {
+		view.PrivateMetadata = home.Digest.DigestDate
+	}
+	return view
+}
+
+// PublishAppHome replaces the App Home of the user with the view
+func PublishAppHome(slackClient *slack.Client, userId string, view slack.HomeTabViewRequest) error {
+	_, publishViewError := slackClient.PublishViewContext(context.Background(), slack.PublishViewContextRequest{UserID: userId, View: view})
+	return publishViewError
+}
@@ -0,0 +1,169 @@
+package PublishToSlack
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"slack-tag-summariser/Localisation"
+	"slack-tag-summariser/RenderDigest"
+
+	"github.com/slack-go/slack"
+)
+
+// limits of the slack Block Kit API, longer values make the whole message fail
+const (
+	maxHeaderTextLength  = 150
+	maxSectionTextLength = 3000
+	maxFieldTextLength   = 2000
+	maxContextElements   = 10
+)
+
+func truncateBlockText(text string, maxLength int) string {
+	runes := []rune(text)
+	if len(runes) <= maxLength {
+		return text
+	}
+	return string(runes[:maxLength-1]) + "…"
+}
+
+func newMrkdwnText(text string, maxLength int) *slack.TextBlockObject {
+	return slack.NewTextBlockObject(slack.MarkdownType, truncateBlockText(text, maxLength), false, false)
+}
+
+func newPlainText(text string, maxLength int) *slack.TextBlockObject {
+	return slack.NewTextBlockObject(slack.PlainTextType, truncateBlockText(text, maxLength), true, false)
+}
+
+// newContextBlock drops empty elements and keeps at most maxContextElements of them
+func newContextBlock(blockId string, texts ...string) *slack.ContextBlock {
+	var elements []slack.MixedElement
+	for _, text := range texts {
+		if text == "" || len(elements) == maxContextElements {
+			continue
+		}
+		elements = append(elements, newMrkdwnText(text, maxSectionTextLength))
+	}
+	return slack.NewContextBlock(blockId, elements...)
+}
+
+// slackRenderers render every unit of the digest twice, as blocks and as the mrkdwn text of the
+// messages sent without blocks
+type slackRenderers struct {
+	text   RenderDigest.Renderer
+	blocks RenderDigest.Renderer
+}
+
+func newSlackRenderers(workspaceId string) (slackRenderers, error) {
+	textRenderer, textRendererError := RenderDigest.NewRenderer(RenderDigest.FormatMrkdwn, workspaceId)
+	if textRendererError != nil {
+		return slackRenderers{}, fmt.Errorf("mrkdwn templates: %w", textRendererError)
+	}
+	blocksRenderer, blocksRendererError := RenderDigest.NewRenderer(RenderDigest.FormatBlockKit, workspaceId)
+	if blocksRendererError != nil {
+		return slackRenderers{}, fmt.Errorf("Block Kit templates: %w", blocksRendererError)
+	}
+	return slackRenderers{text: textRenderer, blocks: blocksRenderer}, nil
+}
+
+func (renderers slackRenderers) render(templateName string, data any) (digestUnit, error) {
+	text, renderError := renderers.text.Render(templateName, data)
+	if renderError != nil {
+		return digestUnit{}, fmt.Errorf("rendering %s as mrkdwn: %w", templateName, renderError)
+	}
+	blocksJson, renderError := renderers.blocks.Render(templateName, data)
+	if renderError != nil {
+		return digestUnit{}, fmt.Errorf("rendering %s as blocks: %w", templateName, renderError)
+	}
+
+	// the Block Kit templates render the blocks without the surrounding array
+	var blocks slack.Blocks
+	if unmarshalError := json.Unmarshal([]byte("["+blocksJson+"]"), &blocks); unmarshalError != nil {
+		return digestUnit{}, fmt.Errorf("the blocks of %s are not valid JSON: %w", templateName, unmarshalError)
+	}
+	return digestUnit{blocks: limitBlocks(blocks.BlockSet), text: text}, nil
+}
+
+// renderMention renders a single mention and adds the done, snooze and not relevant buttons, the
+// buttons are swapped for a confirmation once one is clicked
+func (renderers slackRenderers) renderMention(mention RenderDigest.MentionData, digestOptions DigestOptions) (digestUnit, error) {
+	unit, renderError := renderers.render(RenderDigest.TemplateMention, mention)
+	if renderError != nil {
+		return digestUnit{}, renderError
+	}
+	r := mention.Mention
+	if !digestOptions.NoItemButtons && r.MentionChannelId != "" && r.MentionTimestamp != "" {
+		unit.blocks = append(unit.blocks, buildDigestItemButtons(r, fmt.Sprintf("mention_%d_buttons", mention.Index), mention.Language))
+	}
+	return unit, nil
+}
+
+// renderCarryOver renders the open mentions of earlier digests as a single unit under their heading, each
+// with the same buttons as a mention
+func (renderers slackRenderers) renderCarryOver(data RenderDigest.DigestData, digestOptions DigestOptions) (digestUnit, error) {
+	unit, renderError := renderers.render(RenderDigest.TemplateCarryOver, data)
+	if renderError != nil {
+		return digestUnit{}, renderError
+	}
+	unit.text += "\n"
+	for _, item := range data.CarryOver {
+		itemUnit, renderError := renderers.render(RenderDigest.TemplateCarryOverItem, item)
+		if renderError != nil {
+			return digestUnit{}, renderError
+		}
+		unit.blocks = append(unit.blocks, itemUnit.blocks...)
+		unit.text += "\n" + itemUnit.text
+		r := item.Mention
+		if !digestOptions.NoItemButtons && r.MentionChannelId != "" && r.MentionTimestamp != "" {
+			unit.blocks = append(unit.blocks, buildDigestItemButtons(r, fmt.Sprintf("carry_over_%d_buttons", item.Index), item.Language))
+		}
+	}
+	return unit, nil
+}
+
+// limitBlocks keeps the rendered blocks within the limits of the Block Kit API whatever the templates
+// render: long texts are truncated and empty context elements are left out, slack rejects a context
+// block without elements
+func limitBlocks(blocks []slack.Block) []slack.Block {
+	var limited []slack.Block
+	for _, block := range blocks {
+		switch b := block.(type) {
+		case *slack.HeaderBlock:
+			if b.Text != nil {
+				b.Text.Text = truncateBlockText(b.Text.Text, maxHeaderTextLength)
+			}
+		case *slack.SectionBlock:
+			if b.Text != nil {
+				b.Text.Text = truncateBlockText(b.Text.Text, maxSectionTextLength)
+			}
+			for _, field := range b.Fields {
+				field.Text = truncateBlockText(field.Text, maxFieldTextLength)
+			}
+		case *slack.ContextBlock:
+			var elements []slack.MixedElement
+			for _, element := range b.ContextElements.Elements {
+				if len(elements) == maxContextElements {
+					break
+				}
+				if text, ok := element.(*slack.TextBlockObject); ok {
+					if text.Text == "" {
+						continue
+					}
+					text.Text = truncateBlockText(text.Text, maxSectionTextLength)
+				}
+				elements = append(elements, element)
+			}
+			if len(elements) == 0 {
+				continue
+			}
+			b.ContextElements.Elements = elements
+		}
+		limited = append(limited, block)
+	}
+	return limited
+}
+
+// buildNotificationText is the plain text of the message, slack shows it in notifications
+// and in clients that cannot render blocks
+func buildNotificationText(responses []GenAiResponse, language string) string {
+	return fmt.Sprintf("%s: %s", Localisation.T(language, "digest_header"), Localisation.T(language, "mentions_actionable", len(responses), countActionable(responses)))
+}
@@ -0,0 +1,159 @@
+package PublishToSlack
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"slack-tag-summariser/Models"
+	"slack-tag-summariser/RenderDigest"
+
+	"github.com/slack-go/slack"
+)
+
+// go test ./PublishToSlack -update rewrites the golden files from the current templates
+var updateGolden = flag.Bool("update", false, "rewrite the golden files")
+
+var goldenNow = time.Date(2023, time.November, 15, 9, 0, 0, 0, time.UTC)
+
+func assertGolden(t *testing.T, name string, value any) {
+	t.Helper()
+	got, jsonMarshallError := json.MarshalIndent(value, "", "  ")
+	if jsonMarshallError != nil {
+		t.Fatalf("marshalling %s: %s", name, jsonMarshallError)
+	}
+	got = append(got, '\n')
+
+	goldenPath := filepath.Join("testdata", name+".golden")
+	if *updateGolden {
+		if writeError := os.WriteFile(goldenPath, got, 0o644); writeError != nil {
+			t.Fatal(writeError)
+		}
+		return
+	}
+	want, readError := os.ReadFile(goldenPath)
+	if readError != nil {
+		t.Fatalf("reading %s, run the tests with -update to create it: %s", goldenPath, readError)
+	}
+	if string(got) != string(want) {
+		t.Errorf("the Block Kit JSON of %s changed, run the tests with -update if that is intended\ngot:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+func newTestRenderers(t *testing.T) slackRenderers {
+	t.Helper()
+	t.Setenv("DIGEST_TEMPLATES_DIR", "")
+	renderers, renderersError := newSlackRenderers("")
+	if renderersError != nil {
+		t.Fatal(renderersError)
+	}
+	return renderers
+}
+
+// newTestMention has every field the mention card shows
+func newTestMention(index int, category string, priority string) GenAiResponse {
+	mentionTimestamp := fmt.Sprintf("%d.000100", goldenNow.Add(-time.Duration(index+2)*time.Hour).Unix())
+	return GenAiResponse{
+		MentionPermalink: "https://example.slack.com/archives/C0BILLING/p" + fmt.Sprint(1700000000+index),
+		MentionChannelId: "C0BILLING",
+		MentionTimestamp: mentionTimestamp,
+		MentionUserId:    "U0SUPPORT",
+		Summary: []string{
+			fmt.Sprintf("<@U0SUPPORT> asks why invoice %d was charged twice", 4700+index),
+			"The customer opened a second ticket about it",
+		},
+		Actionable: "Yes",
+		ActionRequired: []Models.ActionItem{{
+			Description:            fmt.Sprintf("Issue the refund of invoice %d", 4700+index),
+			OwnerUserId:            "U0EVALUSER",
+			RequesterUserId:        "U0SUPPORT",
+			DueText:                "by Friday",
+			SourceMessageTimestamp: mentionTimestamp,
+			SourcePermalink:        "https://example.slack.com/archives/C0BILLING/p1700000060",
+			Confidence:             0.9,
+		}},
+		Priority:       priority,
+		Category:       category,
+		Tags:           []string{"billing", "refund"},
+		Rationale:      "A customer is waiting on the refund with a deadline",
+		Evidence:       []Models.EvidenceQuote{{Quote: "issue the refund by Friday", SourceMessageTimestamp: mentionTimestamp, SourcePermalink: "https://example.slack.com/archives/C0BILLING/p1700000060"}},
+		Language:       "en",
+		Confidence:     0.9,
+		RankingScore:   42,
+		RankingReasons: []string{"priority P1", "asked directly"},
+	}
+}
+
+func TestBlockKitHeader(t *testing.T) {
+	renderers := newTestRenderers(t)
+	data := RenderDigest.NewDigestData(StoredDigest{Language: "en", DigestDate: "2023-11-15"}, false, goldenNow)
+
+	header, renderError := renderers.render(RenderDigest.TemplateHeader, data)
+	if renderError != nil {
+		t.Fatal(renderError)
+	}
+	assertGolden(t, "header", header.blocks)
+}
+
+func TestBlockKitMention(t *testing.T) {
+	renderers := newTestRenderers(t)
+	mention := newTestMention(0, "question", "P1")
+	mention.InjectionSuspected = true
+
+	unit, renderError := renderers.renderMention(RenderDigest.NewMentionData(mention, 0, "en", goldenNow), DigestOptions{Language: "en"})
+	if renderError != nil {
+		t.Fatal(renderError)
+	}
+	assertGolden(t, "mention", unit.blocks)
+}
+
+func TestBlockKitCategoryGrouping(t *testing.T) {
+	renderers := newTestRenderers(t)
+	responses := []GenAiResponse{
+		newTestMention(0, "question", "P1"),
+		newTestMention(1, "incident", "P0"),
+		newTestMention(2, "question", "P2"),
+		newTestMention(3, "", "P3"),
+	}
+
+	units, buildUnitsError := buildDigestUnits(renderers, nil, responses, DigestOptions{Language: "en", GroupByCategory: true}, goldenNow)
+	if buildUnitsError != nil {
+		t.Fatal(buildUnitsError)
+	}
+	assertGolden(t, "category_grouping", digestPart{units: units}.blocks())
+}
+
+func TestBlockKitSplitParts(t *testing.T) {
+	t.Setenv("DIGEST_SPLIT_MODE", "")
+	renderers := newTestRenderers(t)
+	var responses []GenAiResponse
+	for i := range 14 {
+		responses = append(responses, newTestMention(i, "question", "P1"))
+	}
+	overview := &DigestOverview{
+		Headline:    "Refunds are waiting on you",
+		TopActions:  []Models.OverviewAction{{Action: "Issue the refund of invoice 4700", ThreadIndex: 0, MentionPermalink: responses[0].MentionPermalink}},
+		OverallLoad: "heavy",
+	}
+
+	parts, threaded, splitDigestError := splitDigest(renderers, overview, responses, DigestOptions{Language: "en"}, goldenNow, true)
+	if splitDigestError != nil {
+		t.Fatal(splitDigestError)
+	}
+	if !threaded || len(parts) < 2 {
+		t.Fatalf("expected the digest to be split into a thread, got %d parts, threaded %v", len(parts), threaded)
+	}
+
+	var partBlocks [][]slack.Block
+	for _, part := range parts {
+		if !partFits(part, true) {
+			t.Errorf("a part of %d blocks does not fit in a message", len(part.blocks()))
+		}
+		partBlocks = append(partBlocks, part.blocks())
+	}
+	assertGolden(t, "split_parts", partBlocks)
+}
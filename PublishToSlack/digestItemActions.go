@@ -0,0 +1,91 @@
+package PublishToSlack
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"slack-tag-summariser/Localisation"
+	"slack-tag-summariser/Models"
+
+	"github.com/slack-go/slack"
+)
+
+// action IDs of the buttons under each mention of the digest, see HandleSlackInteraction
+const (
+	ActionDigestItemDone           = "digest_item_done"
+	ActionDigestItemSnoozeTomorrow = "digest_item_snooze_tomorrow"
+	ActionDigestItemSnoozeWeek     = "digest_item_snooze_week"
+	ActionDigestItemNotRelevant    = "digest_item_not_relevant"
+)
+
+const maxButtonTextLength = 75
+
+// the value of every button is the channel and the timestamp of the mention e.g. "C123:1700000000.000100"
+func digestItemValue(r GenAiResponse) string {
+	return DigestItemKey(r.MentionChannelId, r.MentionTimestamp)
+}
+
+// ParseDigestItemValue returns the channel ID and the mention timestamp of a button value
+func ParseDigestItemValue(value string) (string, string, bool) {
+	channelId, mentionTimestamp, found := strings.Cut(value, ":")
+	if !found || channelId == "" || mentionTimestamp == "" {
+		return "", "", false
+	}
+	return channelId, mentionTimestamp, true
+}
+
+func newDigestItemButton(actionId string, label string, value string) *slack.ButtonBlockElement {
+	return slack.NewButtonBlockElement(actionId, value, newPlainText(label, maxButtonTextLength))
+}
+
+func buildDigestItemButtons(r GenAiResponse, blockId string, language string) *slack.ActionBlock {
+	value := digestItemValue(r)
+	return slack.NewActionBlock(blockId,
+		newDigestItemButton(ActionDigestItemDone, "✅ "+Localisation.T(language, "button_done"), value).WithStyle(slack.StylePrimary),
+		newDigestItemButton(ActionDigestItemSnoozeTomorrow, "⏰ "+Localisation.T(language, "button_snooze_tomorrow"), value),
+		newDigestItemButton(ActionDigestItemSnoozeWeek, "📅 "+Localisation.T(language, "button_snooze_week"), value),
+		newDigestItemButton(ActionDigestItemNotRelevant, "🙈 "+Localisation.T(language, "button_not_relevant"), value),
+	)
+}
+
+func formatDigestItemConfirmation(item Models.DigestItem, language string, location *time.Location) string {
+	switch item.State {
+	case Models.DigestItemDone:
+		return "✅ " + Localisation.T(language, "item_done")
+	case Models.DigestItemSnoozed:
+		snoozedUntil := ""
+		if item.SnoozedUntil != nil {
+			snoozedUntil = item.SnoozedUntil.In(location).Format(time.DateOnly)
+		}
+		return "⏰ " + Localisation.T(language, "item_snoozed", snoozedUntil)
+	case Models.DigestItemNotRelevant:
+		return "🙈 " + Localisation.T(language, "item_not_relevant")
+	}
+	return ""
+}
+
+// UpdateDigestItemMessage replaces the buttons of the item in the digest message with what the user
+// chose, the rest of the message is left as it was
+func UpdateDigestItemMessage(slackClient *slack.Client, channelId string, message slack.Message, buttonsBlockId string, item Models.DigestItem, language string, location *time.Location) error {
+	confirmation := newContextBlock(buttonsBlockId, formatDigestItemConfirmation(item, language, location))
+
+	blocks := make([]slack.Block, 0, len(message.Blocks.BlockSet))
+	replaced := false
+	for _, block := range message.Blocks.BlockSet {
+		if block.ID() == buttonsBlockId {
+			block = confirmation
+			replaced = true
+		}
+		blocks = append(blocks, block)
+	}
+	if !replaced {
+		return fmt.Errorf("block %s is not in the message", buttonsBlockId)
+	}
+
+	_, _, _, updateError := slackClient.UpdateMessage(channelId, message.Timestamp,
+		slack.MsgOptionText(message.Text, false),
+		slack.MsgOptionBlocks(blocks...),
+	)
+	return updateError
+}
@@ -0,0 +1,51 @@
+package PublishToSlack
+
+import (
+	"slack-tag-summariser/Localisation"
+	"slack-tag-summariser/Models"
+
+	"github.com/slack-go/slack"
+)
+
+type DigestRunTotals = Models.DigestRunTotals
+
+// DigestNote is a digest made of the header and a single line, sent instead of the digest on a day
+// without mentions
+type DigestNote struct {
+	// localisation key of the header
+	HeaderKey string
+	// mrkdwn, already in the language of the digest
+	Text string
+}
+
+// InboxZeroNote tells the user nobody mentioned them since the last digest
+func InboxZeroNote(language string) DigestNote {
+	return DigestNote{HeaderKey: "digest_header", Text: "🎉 " + Localisation.T(language, "inbox_zero")}
+}
+
+// QuietWeekRecapNote sums up the digests of the last 7 days on a day without mentions
+func QuietWeekRecapNote(language string, totals DigestRunTotals) DigestNote {
+	text := "🌿 " + Localisation.T(language, "quiet_week_none")
+	if totals.Digests > 0 {
+		text = "🌿 " + Localisation.T(language, "quiet_week_recap", totals.Digests, totals.Mentions)
+	}
+	return DigestNote{HeaderKey: "quiet_week_header", Text: text}
+}
+
+// SendNote posts the note to the channel, the user ID for the DM. It is recorded like any other digest so
+// it is not posted twice on the same day.
+func SendNote(slackClient *slack.Client, userId string, target string, channelId string, digestOptions DigestOptions, note DigestNote) error {
+	units := []digestUnit{
+		{
+			blocks: []slack.Block{slack.NewHeaderBlock(newPlainText(Localisation.T(digestOptions.Language, note.HeaderKey), maxHeaderTextLength),
+				slack.HeaderBlockOptionBlockID("digest_header"))},
+			isHeader: true,
+		},
+		{
+			blocks: []slack.Block{slack.NewSectionBlock(newMrkdwnText(note.Text, maxSectionTextLength), nil, nil,
+				slack.SectionBlockOptionBlockID("digest_note"))},
+			text: note.Text,
+		},
+	}
+	return deliverDigestParts(slackClient, userId, target, channelId, digestOptions, []digestPart{{units: units}}, false, useBlockKit(), note.Text, nil)
+}
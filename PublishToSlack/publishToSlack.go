@@ -2,81 +2,137 @@ package PublishToSlack
 
 import (
 	"fmt"
+	"os"
 	"strings"
+	"time"
 
+	"slack-tag-summariser/Localisation"
 	"slack-tag-summariser/Models"
+	"slack-tag-summariser/RenderDigest"
 
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/slack-go/slack"
 )
 
 type GenAiResponse = Models.GenAiResponse
-
-func formatGenAiResponsesVertical(responses []GenAiResponse) string {
-	var b strings.Builder
-
-	for i, r := range responses {
-		// 1. Header with Emoji & Link
-		b.WriteString(fmt.Sprintf("🔗 *Mention Link:* <%s|Click Here> |\n", r.MentionPermalink))
-
-		// 2. Priority-based Emoji logic
-		priorityEmoji := "⚪" // Default
-		switch strings.ToUpper(r.Priority) {
-		case "P0", "P1":
-			priorityEmoji = "🚨"
-		case "P2":
-			priorityEmoji = "⚠️"
-		case "P3":
-			priorityEmoji = "🔵"
-		}
-
-		// Actionable Emoji
-		actionEmoji := "✅"
-		if strings.ToLower(r.Actionable) == "no" {
-			actionEmoji = "➖"
-		}
-
-		// 3. Status Row
-		b.WriteString(fmt.Sprintf("%s *Actionable:* %s.     %s *Priority:* `%s`\n", actionEmoji, r.Actionable, priorityEmoji, r.Priority))
-
-		// 4. Summary Section (with a nice header emoji)
-		b.WriteString("\n📝 *Summary*\n")
-		for j, s := range r.Summary {
-			b.WriteString(fmt.Sprintf("  %d. %s\n", j+1, s))
+type ActionItem = Models.ActionItem
+type DigestOverview = Models.DigestOverview
+type DigestDelivery = Models.DigestDelivery
+type StoredDigest = Models.StoredDigest
+
+func countActionable(responses []GenAiResponse) int {
+	actionableCount := 0
+	for _, r := range responses {
+		if strings.ToLower(r.Actionable) == "yes" {
+			actionableCount++
 		}
+	}
+	return actionableCount
+}
 
-		// 5. Action Required Section
-		if len(r.ActionRequired) > 0 {
-			b.WriteString("\n🛠️ *Action Required*\n")
-			for _, a := range r.ActionRequired {
-				b.WriteString(fmt.Sprintf("  • %s\n", a)) // Using bullets for actions for variety
-			}
-		}
+// formatActionItem is the mrkdwn of an action item in the App Home, the digest renders them with the
+// "action_item" template of RenderDigest
+func formatActionItem(a ActionItem, language string) string {
+	var b strings.Builder
+	b.WriteString(a.Description)
 
-		// 6. Styled Divider
-		if i < len(responses)-1 {
-			b.WriteString("\n━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n\n")
-		}
+	var details []string
+	if a.OwnerUserId != "" {
+		details = append(details, fmt.Sprintf("👤 <@%s>", a.OwnerUserId))
+	}
+	if a.RequesterUserId != "" {
+		details = append(details, Localisation.T(language, "asked_by", fmt.Sprintf("<@%s>", a.RequesterUserId)))
+	}
+	if a.DueDate != nil {
+		details = append(details, "📅 "+Localisation.T(language, "due", a.DueDate.Format("2006-01-02 15:04")))
+	} else if a.DueText != "" {
+		details = append(details, fmt.Sprintf("📅 %s", a.DueText))
+	}
+	if a.SourcePermalink != "" {
+		details = append(details, fmt.Sprintf("<%s|%s>", a.SourcePermalink, Localisation.T(language, "source")))
+	}
+	if a.Confidence < RenderDigest.LowConfidenceThreshold {
+		details = append(details, fmt.Sprintf("_%s_", Localisation.T(language, "low_confidence")))
 	}
 
+	if len(details) > 0 {
+		b.WriteString(fmt.Sprintf("\n      %s", strings.Join(details, " · ")))
+	}
 	return b.String()
 }
 
-func SendSlackDm(slackClient *slack.Client, userId string, processUserResult []GenAiResponse) (bool, error) {
-	msg := formatGenAiResponsesVertical(processUserResult)
+const cardDivider = "\n━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n\n"
+
+// DigestOptions are the preferences of the user that change how the digest is rendered and delivered
+type DigestOptions struct {
+	// the fixed labels are rendered in this language
+	Language        string
+	GroupByCategory bool
+	// number of mentions left out by the category filter of the user
+	HiddenCount int
+	// the day the digest is for (YYYY-MM-DD), each message of a digest is posted at most once per day
+	DigestDate string
+	// when nil the deliveries are not recorded and sending the digest again posts it again
+	DbPool *pgxpool.Pool
+	// leaves out the done, snooze and not relevant buttons, they only work in the DM of the user
+	NoItemButtons bool
+	// the digest already sent today, a re-run shows what changed since then, nil on the first run
+	PreviousDigest *StoredDigest
+	// the digest is rendered with the template overrides of this workspace, see RenderDigest
+	WorkspaceId string
+	// the open mentions of earlier digests, shown in their own section after the overview
+	CarryOver []Models.CarryOverItem
+}
+
+// DIGEST_FORMAT=text sends the digest as mrkdwn text instead of Block Kit
+func useBlockKit() bool {
+	return !strings.EqualFold(os.Getenv("DIGEST_FORMAT"), "text")
+}
 
-	_, _, sendSlackDmError := slackClient.PostMessage(
-		userId,
-		slack.MsgOptionText(msg, false),
-		// This is the key part to disable previews
-		slack.MsgOptionPostMessageParameters(slack.PostMessageParameters{
-			UnfurlLinks: false,
-			UnfurlMedia: false,
-		}),
-	)
+// SendSlackDm posts the digest to the user, the overview is optional and rendered at the top when present.
+// A digest too large for one message is split into a parent message and replies in its thread.
+func SendSlackDm(slackClient *slack.Client, userId string, digestOptions DigestOptions, overview *DigestOverview, processUserResult []GenAiResponse) (bool, error) {
+	renderers, renderersError := newSlackRenderers(digestOptions.WorkspaceId)
+	if renderersError != nil {
+		return false, renderersError
+	}
+	blockKit := useBlockKit()
+	parts, threaded, splitDigestError := splitDigest(renderers, overview, processUserResult, digestOptions, time.Now(), blockKit)
+	if splitDigestError != nil {
+		return false, splitDigestError
+	}
 
-	if sendSlackDmError != nil {
+	notificationText := buildNotificationText(processUserResult, digestOptions.Language)
+	changeUnits, changeUnitsError := buildChangeUnits(renderers, digestOptions.PreviousDigest, processUserResult, digestOptions, time.Now())
+	if changeUnitsError != nil {
+		return false, changeUnitsError
+	}
+	if sendSlackDmError := deliverDigestParts(slackClient, userId, Models.DeliveryTargetSlackDm, userId, digestOptions, parts, threaded, blockKit, notificationText, changeUnits); sendSlackDmError != nil {
 		return false, sendSlackDmError
 	}
 
 	return true, nil
 }
+
+// SendSlackChannel posts the digest of the user to a channel the bot is a member of. The buttons are
+// left out as everyone in the channel would act on the items of the user.
+func SendSlackChannel(slackClient *slack.Client, userId string, channelId string, digestOptions DigestOptions, overview *DigestOverview, processUserResult []GenAiResponse) error {
+	digestOptions.NoItemButtons = true
+	renderers, renderersError := newSlackRenderers(digestOptions.WorkspaceId)
+	if renderersError != nil {
+		return renderersError
+	}
+	blockKit := useBlockKit()
+	parts, threaded, splitDigestError := splitDigest(renderers, overview, processUserResult, digestOptions, time.Now(), blockKit)
+	if splitDigestError != nil {
+		return splitDigestError
+	}
+
+	notificationText := buildNotificationText(processUserResult, digestOptions.Language)
+	changeUnits, changeUnitsError := buildChangeUnits(renderers, digestOptions.PreviousDigest, processUserResult, digestOptions, time.Now())
+	if changeUnitsError != nil {
+		return changeUnitsError
+	}
+	target := Models.DeliveryTargetSlackChannel + ":" + channelId
+	return deliverDigestParts(slackClient, userId, target, channelId, digestOptions, parts, threaded, blockKit, notificationText, changeUnits)
+}
@@ -0,0 +1,453 @@
+package PublishToSlack
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"slack-tag-summariser/Localisation"
+	"slack-tag-summariser/RenderDigest"
+	"slack-tag-summariser/Repo"
+
+	"github.com/slack-go/slack"
+)
+
+// limits of a single slack message, a digest that does not fit is split across several messages
+const (
+	maxBlocksPerMessage = 50
+	// slack does not document a size limit for blocks, this keeps well clear of the request limits
+	maxBlocksPayloadBytes = 24000
+	// slack truncates longer texts and recommends staying under 4000 characters
+	maxMessageTextLength = 4000
+
+	maxRateLimitRetries = 3
+)
+
+// digestUnit is the smallest piece of a digest that is never split, either the header, the
+// overview, a single mention or the footer, rendered both as blocks and as mrkdwn text
+type digestUnit struct {
+	blocks []slack.Block
+	text   string
+	// the digest header is followed by the next unit without a divider
+	isHeader bool
+}
+
+type digestPart struct {
+	units []digestUnit
+}
+
+func (part digestPart) blocks() []slack.Block {
+	var blocks []slack.Block
+	for i, unit := range part.units {
+		if i > 0 && !part.units[i-1].isHeader {
+			blocks = append(blocks, slack.NewDividerBlock())
+		}
+		blocks = append(blocks, unit.blocks...)
+	}
+	return blocks
+}
+
+func (part digestPart) text() string {
+	var b strings.Builder
+	for i, unit := range part.units {
+		if unit.text == "" {
+			continue
+		}
+		if b.Len() > 0 {
+			if part.units[i-1].isHeader {
+				b.WriteString("\n\n")
+			} else {
+				b.WriteString(cardDivider)
+			}
+		}
+		b.WriteString(unit.text)
+	}
+	return b.String()
+}
+
+// buildDigestUnits lays out the whole digest in order: header, overview, the open mentions of earlier
+// digests, the mentions (in one section per category when grouped) and the footer
+func buildDigestUnits(renderers slackRenderers, overview *DigestOverview, responses []GenAiResponse, digestOptions DigestOptions, now time.Time) ([]digestUnit, error) {
+	data := RenderDigest.NewDigestData(StoredDigest{
+		Language:    digestOptions.Language,
+		DigestDate:  digestOptions.DigestDate,
+		Overview:    overview,
+		Responses:   responses,
+		HiddenCount: digestOptions.HiddenCount,
+		CarryOver:   digestOptions.CarryOver,
+	}, digestOptions.GroupByCategory, now)
+
+	header, renderError := renderers.render(RenderDigest.TemplateHeader, data)
+	if renderError != nil {
+		return nil, renderError
+	}
+	header.isHeader = true
+	units := []digestUnit{header}
+
+	if overview != nil {
+		overviewUnit, renderError := renderers.render(RenderDigest.TemplateOverview, data)
+		if renderError != nil {
+			return nil, renderError
+		}
+		units = append(units, overviewUnit)
+	}
+
+	if len(data.CarryOver) > 0 {
+		carryOverUnit, renderError := renderers.renderCarryOver(data, digestOptions)
+		if renderError != nil {
+			return nil, renderError
+		}
+		units = append(units, carryOverUnit)
+	}
+
+	if digestOptions.GroupByCategory {
+		for _, category := range data.Categories {
+			for i, mention := range category.Mentions {
+				unit, renderError := renderers.renderMention(mention, digestOptions)
+				if renderError != nil {
+					return nil, renderError
+				}
+				// the category heading goes with the first mention of the category so they are never split
+				if i == 0 {
+					heading, renderError := renderers.render(RenderDigest.TemplateCategory, category)
+					if renderError != nil {
+						return nil, renderError
+					}
+					unit.blocks = append(heading.blocks, unit.blocks...)
+					unit.text = heading.text + "\n\n" + unit.text
+				}
+				units = append(units, unit)
+			}
+		}
+	} else {
+		for _, mention := range data.Mentions {
+			unit, renderError := renderers.renderMention(mention, digestOptions)
+			if renderError != nil {
+				return nil, renderError
+			}
+			units = append(units, unit)
+		}
+	}
+
+	if digestOptions.HiddenCount > 0 {
+		hiddenUnit, renderError := renderers.render(RenderDigest.TemplateHidden, data)
+		if renderError != nil {
+			return nil, renderError
+		}
+		units = append(units, hiddenUnit)
+	}
+	return units, nil
+}
+
+func partFits(part digestPart, blockKit bool) bool {
+	if !blockKit {
+		return utf8.RuneCountInString(part.text()) <= maxMessageTextLength
+	}
+	blocks := part.blocks()
+	if len(blocks) > maxBlocksPerMessage {
+		return false
+	}
+	blocksJson, jsonMarshallError := json.Marshal(blocks)
+	return jsonMarshallError == nil && len(blocksJson) <= maxBlocksPayloadBytes
+}
+
+// packDigestParts fills each part with as many units as fit, in order, a unit that does not
+// fit in a part of its own is still sent on its own and left to slack to truncate
+func packDigestParts(units []digestUnit, blockKit bool) []digestPart {
+	var parts []digestPart
+	var current digestPart
+	for _, unit := range units {
+		candidate := digestPart{units: append(append([]digestUnit{}, current.units...), unit)}
+		if len(current.units) > 0 && !partFits(candidate, blockKit) {
+			parts = append(parts, current)
+			candidate = digestPart{units: []digestUnit{unit}}
+		}
+		current = candidate
+	}
+	if len(current.units) > 0 {
+		parts = append(parts, current)
+	}
+	return parts
+}
+
+// DIGEST_SPLIT_MODE=messages posts a digest that is too long as consecutive messages, the default
+// "thread" posts a short parent message with the header and the overview and the mentions as replies
+func useThreadSplit() bool {
+	return !strings.EqualFold(os.Getenv("DIGEST_SPLIT_MODE"), "messages")
+}
+
+// splitDigest returns the parts of the digest in the order they have to be posted, and whether the
+// parts after the first one are replies in its thread
+func splitDigest(renderers slackRenderers, overview *DigestOverview, responses []GenAiResponse, digestOptions DigestOptions, now time.Time, blockKit bool) ([]digestPart, bool, error) {
+	units, buildUnitsError := buildDigestUnits(renderers, overview, responses, digestOptions, now)
+	if buildUnitsError != nil {
+		return nil, false, buildUnitsError
+	}
+
+	singlePart := digestPart{units: units}
+	if partFits(singlePart, blockKit) {
+		return []digestPart{singlePart}, false, nil
+	}
+
+	if !useThreadSplit() {
+		return packDigestParts(units, blockKit), false, nil
+	}
+
+	// the parent keeps what is read first, everything else goes to the thread
+	parentUnits := []digestUnit{units[0]}
+	rest := units[1:]
+	if overview != nil {
+		parentUnits = append(parentUnits, units[1])
+		rest = units[2:]
+	}
+	continuedText := "🧵 " + Localisation.T(digestOptions.Language, "continued_in_thread", len(responses))
+	parentUnits = append(parentUnits, digestUnit{
+		blocks: []slack.Block{newContextBlock("digest_continued", continuedText)},
+		text:   continuedText,
+	})
+
+	return append([]digestPart{{units: parentUnits}}, packDigestParts(rest, blockKit)...), true, nil
+}
+
+// retryRateLimited waits out slack rate limits instead of failing the whole digest
+func retryRateLimited(callName string, call func() error) error {
+	for attempt := 0; ; attempt++ {
+		callError := call()
+
+		var rateLimitedError *slack.RateLimitedError
+		if errors.As(callError, &rateLimitedError) && attempt < maxRateLimitRetries {
+			log.Printf("PublishToSlack:%s#Rate limited, retrying in %s", callName, rateLimitedError.RetryAfter)
+			time.Sleep(rateLimitedError.RetryAfter)
+			continue
+		}
+		return callError
+	}
+}
+
+func postMessageWithRetry(slackClient *slack.Client, channelId string, options ...slack.MsgOption) (string, string, error) {
+	var respChannel, respTimestamp string
+	postMessageError := retryRateLimited("postMessageWithRetry", func() error {
+		var callError error
+		respChannel, respTimestamp, callError = slackClient.PostMessage(channelId, options...)
+		return callError
+	})
+	return respChannel, respTimestamp, postMessageError
+}
+
+func updateMessageWithRetry(slackClient *slack.Client, channelId string, timestamp string, options ...slack.MsgOption) error {
+	return retryRateLimited("updateMessageWithRetry", func() error {
+		_, _, _, callError := slackClient.UpdateMessage(channelId, timestamp, options...)
+		return callError
+	})
+}
+
+// buildChangeUnits lays out what changed since the digest was last sent today: the mentions that are new
+// and how many are gone, nothing when the digest is the same
+func buildChangeUnits(renderers slackRenderers, previousDigest *StoredDigest, responses []GenAiResponse, digestOptions DigestOptions, now time.Time) ([]digestUnit, error) {
+	if previousDigest == nil {
+		return nil, nil
+	}
+	language := digestOptions.Language
+
+	previousKeys := make(map[string]struct{}, len(previousDigest.Responses))
+	for _, r := range previousDigest.Responses {
+		previousKeys[DigestItemKey(r.MentionChannelId, r.MentionTimestamp)] = struct{}{}
+	}
+
+	var units []digestUnit
+	currentKeys := make(map[string]struct{}, len(responses))
+	for i, r := range responses {
+		key := DigestItemKey(r.MentionChannelId, r.MentionTimestamp)
+		currentKeys[key] = struct{}{}
+		if _, existed := previousKeys[key]; existed {
+			continue
+		}
+		unit, renderError := renderers.renderMention(RenderDigest.NewMentionData(r, i, language, now), digestOptions)
+		if renderError != nil {
+			return nil, renderError
+		}
+		units = append(units, unit)
+	}
+
+	removedCount := 0
+	for key := range previousKeys {
+		if _, exists := currentKeys[key]; !exists {
+			removedCount++
+		}
+	}
+	if removedCount > 0 {
+		removedText := "_" + Localisation.T(language, "changes_removed", removedCount) + "_"
+		units = append(units, digestUnit{
+			blocks: []slack.Block{newContextBlock("changes_removed", removedText)},
+			text:   removedText,
+		})
+	}
+	if len(units) == 0 {
+		return nil, nil
+	}
+
+	changesText := "🔄 *" + Localisation.T(language, "changes_since", previousDigest.CreatedAt.In(now.Location()).Format("15:04")) + "*"
+	return append([]digestUnit{{
+		blocks:   []slack.Block{newContextBlock("changes_header", changesText)},
+		text:     changesText,
+		isHeader: true,
+	}}, units...), nil
+}
+
+// DIGEST_RERUN_MODE decides what a second run on the same day does with the digest that was already
+// posted: "update" (the default) edits the messages in place, "reply" leaves them as they are and
+// adds a thread reply with the changes
+func useRerunReply() bool {
+	return strings.EqualFold(os.Getenv("DIGEST_RERUN_MODE"), "reply")
+}
+
+func digestPartOptions(part digestPart, blockKit bool, notificationText string) []slack.MsgOption {
+	options := []slack.MsgOption{
+		slack.MsgOptionText(part.text(), false),
+		// This is the key part to disable previews
+		slack.MsgOptionPostMessageParameters(slack.PostMessageParameters{
+			UnfurlLinks: false,
+			UnfurlMedia: false,
+		}),
+	}
+	if blockKit {
+		// the text is only the notification fallback once blocks are set
+		options[0] = slack.MsgOptionText(notificationText, false)
+		options = append(options, slack.MsgOptionBlocks(part.blocks()...))
+	}
+	return options
+}
+
+// postChangesReply posts the changes since the last run in the thread of the first message of the digest
+func postChangesReply(slackClient *slack.Client, firstDelivery DigestDelivery, changeUnits []digestUnit, blockKit bool, notificationText string) error {
+	for _, changesPart := range packDigestParts(changeUnits, blockKit) {
+		options := append(digestPartOptions(changesPart, blockKit, notificationText), slack.MsgOptionTS(firstDelivery.MessageTimestamp))
+		if _, _, postMessageError := postMessageWithRetry(slackClient, firstDelivery.ChannelId, options...); postMessageError != nil {
+			return fmt.Errorf("changes since the last run: %w", postMessageError)
+		}
+	}
+	return nil
+}
+
+// hashDigestPart tells whether a part changed since it was posted, it covers everything that is sent
+func hashDigestPart(part digestPart, blockKit bool, notificationText string) string {
+	hash := sha256.New()
+	if blockKit {
+		blocksJson, _ := json.Marshal(part.blocks())
+		hash.Write(blocksJson)
+		hash.Write([]byte(notificationText))
+	} else {
+		hash.Write([]byte(part.text()))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// deliverDigestParts posts the parts in order to the channel, the user ID for the DM. Every posted part
+// is recorded for the day and the target, so when the digest is sent again after a failure the parts
+// that already went out are not posted again and the rest are still posted in order, in the same thread.
+// On a re-run the parts that changed are updated in place, or the changes are added as a thread reply,
+// see useRerunReply.
+func deliverDigestParts(slackClient *slack.Client, userId string, target string, channelId string, digestOptions DigestOptions, parts []digestPart, threaded bool, blockKit bool, notificationText string, changeUnits []digestUnit) error {
+	recordDeliveries := digestOptions.DbPool != nil && digestOptions.DigestDate != ""
+
+	deliveries := make(map[int]DigestDelivery)
+	if recordDeliveries {
+		previousDeliveries, getDeliveriesError := Repo.GetDigestDeliveries(userId, digestOptions.DigestDate, target, digestOptions.DbPool)
+		if getDeliveriesError != nil {
+			return getDeliveriesError
+		}
+		deliveries = previousDeliveries
+	}
+	updateInPlace := !useRerunReply()
+
+	// a digest that already went out in full today is left as it is in reply mode, the changes reply is
+	// all that is posted so the new mentions are not shown twice. The parts of a digest that failed
+	// half way are still posted.
+	if firstDelivery, delivered := deliveries[0]; !updateInPlace && delivered && digestOptions.PreviousDigest != nil {
+		return postChangesReply(slackClient, firstDelivery, changeUnits, blockKit, notificationText)
+	}
+
+	threadTimestamp := ""
+	for partIndex, part := range parts {
+		options := digestPartOptions(part, blockKit, notificationText)
+		contentHash := hashDigestPart(part, blockKit, notificationText)
+
+		if delivery, delivered := deliveries[partIndex]; delivered {
+			channelId = delivery.ChannelId
+			if partIndex == 0 && threaded {
+				threadTimestamp = delivery.MessageTimestamp
+			}
+			if !updateInPlace || delivery.ContentHash == contentHash {
+				log.Printf("PublishToSlack:deliverDigestParts#Part %d of the digest of %s for %s was already delivered to %s", partIndex, digestOptions.DigestDate, userId, target)
+				continue
+			}
+
+			if updateError := updateMessageWithRetry(slackClient, delivery.ChannelId, delivery.MessageTimestamp, options...); updateError != nil {
+				return fmt.Errorf("updating part %d of %d: %w", partIndex+1, len(parts), updateError)
+			}
+			delivery.ContentHash = contentHash
+			if saveDeliveryError := Repo.SaveDigestDelivery(delivery, digestOptions.DbPool); saveDeliveryError != nil {
+				log.Printf("PublishToSlack:deliverDigestParts#Error saving the update of part %d: %s", partIndex, saveDeliveryError.Error())
+			}
+			continue
+		}
+
+		if threadTimestamp != "" {
+			options = append(options, slack.MsgOptionTS(threadTimestamp))
+		}
+		respChannel, respTimestamp, postMessageError := postMessageWithRetry(slackClient, channelId, options...)
+		if postMessageError != nil {
+			return fmt.Errorf("part %d of %d: %w", partIndex+1, len(parts), postMessageError)
+		}
+		// the DM is opened on the first post, the replies need the ID of its channel
+		channelId = respChannel
+		if partIndex == 0 && threaded {
+			threadTimestamp = respTimestamp
+		}
+
+		if recordDeliveries {
+			saveDeliveryError := Repo.SaveDigestDelivery(DigestDelivery{
+				UserID:           userId,
+				DigestDate:       digestOptions.DigestDate,
+				Target:           target,
+				PartIndex:        partIndex,
+				ChannelId:        respChannel,
+				MessageTimestamp: respTimestamp,
+				ContentHash:      contentHash,
+			}, digestOptions.DbPool)
+			if saveDeliveryError != nil {
+				log.Printf("PublishToSlack:deliverDigestParts#Error saving the delivery of part %d: %s", partIndex, saveDeliveryError.Error())
+			}
+		}
+	}
+
+	if !updateInPlace {
+		return nil
+	}
+
+	// the digest got shorter since the last run, its leftover messages would repeat older content
+	for partIndex, delivery := range deliveries {
+		if partIndex < len(parts) {
+			continue
+		}
+		deleteError := retryRateLimited("deliverDigestParts", func() error {
+			_, _, callError := slackClient.DeleteMessage(delivery.ChannelId, delivery.MessageTimestamp)
+			return callError
+		})
+		if deleteError != nil {
+			log.Printf("PublishToSlack:deliverDigestParts#Error deleting part %d: %s", partIndex, deleteError.Error())
+			continue
+		}
+		if deleteDeliveryError := Repo.DeleteDigestDelivery(delivery, digestOptions.DbPool); deleteDeliveryError != nil {
+			log.Printf("PublishToSlack:deliverDigestParts#Error forgetting part %d: %s", partIndex, deleteDeliveryError.Error())
+		}
+	}
+	return nil
+}
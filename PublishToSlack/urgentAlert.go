@@ -0,0 +1,43 @@
+package PublishToSlack
+
+import (
+	"time"
+
+	"slack-tag-summariser/Localisation"
+	"slack-tag-summariser/RenderDigest"
+
+	"github.com/slack-go/slack"
+)
+
+// SendUrgentAlert sends a single mention to the user as a message of its own, with the same card and
+// buttons as in the digest. It returns the timestamp of the message.
+func SendUrgentAlert(slackClient *slack.Client, userId string, digestOptions DigestOptions, r GenAiResponse) (string, error) {
+	renderers, renderersError := newSlackRenderers(digestOptions.WorkspaceId)
+	if renderersError != nil {
+		return "", renderersError
+	}
+	language := digestOptions.Language
+
+	mentionUnit, renderError := renderers.renderMention(RenderDigest.NewMentionData(r, 0, language, time.Now()), digestOptions)
+	if renderError != nil {
+		return "", renderError
+	}
+	headerText := "🚨 " + Localisation.T(language, "urgent_header")
+	part := digestPart{units: []digestUnit{
+		{
+			blocks:   []slack.Block{slack.NewHeaderBlock(newPlainText(headerText, maxHeaderTextLength), slack.HeaderBlockOptionBlockID("urgent_header"))},
+			text:     "*" + headerText + "*",
+			isHeader: true,
+		},
+		mentionUnit,
+	}}
+
+	// the notification is all the user sees on the phone, so it carries the first line of the summary
+	notificationText := headerText
+	if len(r.Summary) > 0 {
+		notificationText += ": " + RenderDigest.PlainTextFromMrkdwn(r.Summary[0])
+	}
+
+	_, respTimestamp, postMessageError := postMessageWithRetry(slackClient, userId, digestPartOptions(part, useBlockKit(), notificationText)...)
+	return respTimestamp, postMessageError
+}
@@ -0,0 +1,262 @@
+package RankSummaries
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"slack-tag-summariser/Models"
+)
+
+type GenAiResponse = Models.GenAiResponse
+
+// base score of each LLM priority, anything unknown ranks below P2 instead of as P0
+var priorityScores = map[string]float64{
+	"P0": 100,
+	"P1": 70,
+	"P2": 40,
+	"P3": 20,
+}
+
+const unknownPriorityScore = 30
+
+const (
+	actionableBonus    = 15
+	askedDirectlyBonus = 10
+	vipSenderBonus     = 15
+
+	overdueBonus      = 30
+	dueWithinDayBonus = 25
+	dueWithin3Days    = 15
+	dueWithinWeek     = 5
+
+	// an actionable mention gains a point for every ageHoursPerPoint hours it waits, up to maxAgeBonus
+	ageHoursPerPoint = 6
+	maxAgeBonus      = 10
+
+	// every mention of the channel the user marked as not relevant lowers the score, up to maxNotRelevantPenalty
+	notRelevantPenalty    = 10
+	maxNotRelevantPenalty = 30
+)
+
+// UserFeedback is what the user told us through the buttons of earlier digests
+type UserFeedback struct {
+	// number of mentions per channel the user recently marked as not relevant
+	NotRelevantByChannel map[string]int
+}
+
+// PriorityRank orders the LLM priorities, unknown priorities go after P3
+func PriorityRank(priority string) int {
+	switch strings.ToUpper(strings.TrimSpace(priority)) {
+	case "P0":
+		return 0
+	case "P1":
+		return 1
+	case "P2":
+		return 2
+	case "P3":
+		return 3
+	}
+	return 4
+}
+
+func priorityScore(priority string) float64 {
+	if score, exists := priorityScores[strings.ToUpper(strings.TrimSpace(priority))]; exists {
+		return score
+	}
+	return unknownPriorityScore
+}
+
+func splitEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// VIP_USER_IDS is a comma separated list of slack user IDs e.g. "U123,U456"
+func getVipUserIds() map[string]struct{} {
+	vipUserIds := make(map[string]struct{})
+	for _, userId := range splitEnvList("VIP_USER_IDS") {
+		vipUserIds[userId] = struct{}{}
+	}
+	return vipUserIds
+}
+
+// CHANNEL_WEIGHTS is a comma separated list of channel:weight pairs e.g. "C123:1.5,C456:0.5",
+// channels that are not listed have a weight of 1
+func getChannelWeights() map[string]float64 {
+	channelWeights := make(map[string]float64)
+	for _, pair := range splitEnvList("CHANNEL_WEIGHTS") {
+		channelId, weightText, found := strings.Cut(pair, ":")
+		if !found {
+			continue
+		}
+		weight, parseError := strconv.ParseFloat(strings.TrimSpace(weightText), 64)
+		if parseError != nil || weight < 0 {
+			continue
+		}
+		channelWeights[strings.TrimSpace(channelId)] = weight
+	}
+	return channelWeights
+}
+
+func parseSlackTimestamp(slackTimestamp string) (time.Time, bool) {
+	seconds, _, _ := strings.Cut(slackTimestamp, ".")
+	unixSeconds, parseError := strconv.ParseInt(seconds, 10, 64)
+	if parseError != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(unixSeconds, 0), true
+}
+
+// earliestDueDate returns the closest deadline over all action items of the response
+func earliestDueDate(r GenAiResponse) (time.Time, bool) {
+	var earliest time.Time
+	found := false
+	for _, a := range r.ActionRequired {
+		if a.DueDate == nil {
+			continue
+		}
+		if !found || a.DueDate.Before(earliest) {
+			earliest = *a.DueDate
+			found = true
+		}
+	}
+	return earliest, found
+}
+
+func isVipSender(r GenAiResponse, vipUserIds map[string]struct{}) bool {
+	if _, isVip := vipUserIds[r.MentionUserId]; isVip {
+		return true
+	}
+	for _, a := range r.ActionRequired {
+		if _, isVip := vipUserIds[a.RequesterUserId]; isVip {
+			return true
+		}
+	}
+	return false
+}
+
+func formatHours(d time.Duration) string {
+	if d < 48*time.Hour {
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
+}
+
+// scoreGenAiResponse combines the LLM priority with the deterministic signals,
+// every contribution is recorded in RankingReasons so the final order can be explained
+func scoreGenAiResponse(r *GenAiResponse, now time.Time, vipUserIds map[string]struct{}, channelWeights map[string]float64, feedback UserFeedback) {
+	var reasons []string
+
+	score := priorityScore(r.Priority)
+	priorityLabel := strings.ToUpper(strings.TrimSpace(r.Priority))
+	if priorityLabel == "" {
+		priorityLabel = "no priority"
+	}
+	reasons = append(reasons, fmt.Sprintf("%s +%.0f", priorityLabel, score))
+
+	isActionable := strings.ToLower(r.Actionable) == "yes"
+	if isActionable {
+		score += actionableBonus
+		reasons = append(reasons, fmt.Sprintf("actionable +%d", actionableBonus))
+	}
+
+	if dueDate, hasDueDate := earliestDueDate(*r); hasDueDate {
+		untilDue := dueDate.Sub(now)
+		switch {
+		case untilDue < 0:
+			score += overdueBonus
+			reasons = append(reasons, fmt.Sprintf("overdue by %s +%d", formatHours(-untilDue), overdueBonus))
+		case untilDue <= 24*time.Hour:
+			score += dueWithinDayBonus
+			reasons = append(reasons, fmt.Sprintf("due in %s +%d", formatHours(untilDue), dueWithinDayBonus))
+		case untilDue <= 72*time.Hour:
+			score += dueWithin3Days
+			reasons = append(reasons, fmt.Sprintf("due in %s +%d", formatHours(untilDue), dueWithin3Days))
+		case untilDue <= 7*24*time.Hour:
+			score += dueWithinWeek
+			reasons = append(reasons, fmt.Sprintf("due in %s +%d", formatHours(untilDue), dueWithinWeek))
+		}
+	}
+
+	if mentionTime, ok := parseSlackTimestamp(r.MentionTimestamp); ok && isActionable {
+		age := now.Sub(mentionTime)
+		if ageBonus := math.Min(math.Floor(age.Hours()/ageHoursPerPoint), maxAgeBonus); ageBonus > 0 {
+			score += ageBonus
+			reasons = append(reasons, fmt.Sprintf("waiting %s +%.0f", formatHours(age), ageBonus))
+		}
+	}
+
+	if r.AskedDirectly {
+		score += askedDirectlyBonus
+		reasons = append(reasons, fmt.Sprintf("asked directly +%d", askedDirectlyBonus))
+	}
+
+	if isVipSender(*r, vipUserIds) {
+		score += vipSenderBonus
+		reasons = append(reasons, fmt.Sprintf("VIP sender +%d", vipSenderBonus))
+	}
+
+	if notRelevantCount := feedback.NotRelevantByChannel[r.MentionChannelId]; notRelevantCount > 0 {
+		penalty := min(notRelevantCount*notRelevantPenalty, maxNotRelevantPenalty)
+		score -= float64(penalty)
+		reasons = append(reasons, fmt.Sprintf("%dx not relevant in channel -%d", notRelevantCount, penalty))
+	}
+
+	if weight, hasWeight := channelWeights[r.MentionChannelId]; hasWeight && weight != 1 {
+		score *= weight
+		reasons = append(reasons, fmt.Sprintf("channel weight x%g", weight))
+	}
+
+	r.RankingScore = score
+	r.RankingReasons = reasons
+}
+
+// lessGenAiResponse is the full ordering used for the digest, ties on the score are broken by
+// priority, then the closest deadline, then the oldest mention and finally the permalink
+func lessGenAiResponse(a GenAiResponse, b GenAiResponse) bool {
+	if a.RankingScore != b.RankingScore {
+		return a.RankingScore > b.RankingScore
+	}
+
+	if rankA, rankB := PriorityRank(a.Priority), PriorityRank(b.Priority); rankA != rankB {
+		return rankA < rankB
+	}
+
+	dueA, hasDueA := earliestDueDate(a)
+	dueB, hasDueB := earliestDueDate(b)
+	if hasDueA != hasDueB {
+		return hasDueA
+	}
+	if hasDueA && !dueA.Equal(dueB) {
+		return dueA.Before(dueB)
+	}
+
+	if a.MentionTimestamp != b.MentionTimestamp {
+		return a.MentionTimestamp < b.MentionTimestamp
+	}
+	return a.MentionPermalink < b.MentionPermalink
+}
+
+// RankGenAiResponses scores every response and sorts them, most important first
+func RankGenAiResponses(responses []GenAiResponse, now time.Time, feedback UserFeedback) {
+	vipUserIds := getVipUserIds()
+	channelWeights := getChannelWeights()
+
+	for i := range responses {
+		scoreGenAiResponse(&responses[i], now, vipUserIds, channelWeights, feedback)
+	}
+
+	sort.SliceStable(responses, func(i, j int) bool {
+		return lessGenAiResponse(responses[i], responses[j])
+	})
+}
@@ -0,0 +1,224 @@
+package RedactConversations
+
+import (
+	"encoding/json"
+	"log"
+	"maps"
+	"math"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Detector finds sensitive values in a text, Label is used in the placeholder e.g. [EMAIL_1]
+type Detector interface {
+	Label() string
+	// FindAll returns the [start, end) byte ranges of every sensitive value in the text
+	FindAll(text string) [][2]int
+}
+
+type regexDetector struct {
+	label string
+	regex *regexp.Regexp
+	// optional extra check on a match, the full text is passed so the surroundings can be checked
+	validate func(text string, start int, end int) bool
+}
+
+func (d regexDetector) Label() string {
+	return d.label
+}
+
+func (d regexDetector) FindAll(text string) [][2]int {
+	var matches [][2]int
+	for _, match := range d.regex.FindAllStringIndex(text, -1) {
+		if d.validate != nil && !d.validate(text, match[0], match[1]) {
+			continue
+		}
+		matches = append(matches, [2]int{match[0], match[1]})
+	}
+	return matches
+}
+
+func NewRegexDetector(label string, pattern string) (Detector, error) {
+	regex, compileError := regexp.Compile(pattern)
+	if compileError != nil {
+		return nil, compileError
+	}
+	return regexDetector{label: label, regex: regex}, nil
+}
+
+var (
+	emailRegex   = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	phoneRegex   = regexp.MustCompile(`\+?\(?\d{1,4}\)?(?:[\s.-]?\(?\d{2,4}\)?){2,4}`)
+	isoDateRegex = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	cardRegex    = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+	// well known key formats, these are redacted even when their entropy is low
+	knownSecretRegex = regexp.MustCompile(`\b(?:AKIA[0-9A-Z]{16}|AIza[0-9A-Za-z_-]{35}|sk-[A-Za-z0-9_-]{20,}|xox[abposr]-[A-Za-z0-9-]{10,}|gh[pousr]_[A-Za-z0-9]{36,}|glpat-[A-Za-z0-9_-]{20,})\b|-----BEGIN [A-Z ]*PRIVATE KEY-----`)
+)
+
+func countDigits(value string) int {
+	digits := 0
+	for _, r := range value {
+		if unicode.IsDigit(r) {
+			digits++
+		}
+	}
+	return digits
+}
+
+// slack timestamps and version numbers look like phone numbers, a real number is not glued to other digits or dots
+func isStandaloneNumber(text string, start int, end int) bool {
+	if start > 0 && strings.ContainsAny(text[start-1:start], "0123456789.") {
+		return false
+	}
+	if end < len(text) && strings.ContainsAny(text[end:end+1], "0123456789.") {
+		return false
+	}
+	return true
+}
+
+func isPhoneNumber(text string, start int, end int) bool {
+	match := text[start:end]
+	digits := countDigits(match)
+	// a phone number needs a separator or a country code, plain long numbers are usually IDs
+	hasFormatting := strings.ContainsAny(match, " .-()+")
+	// dates like 2024-05-03 have exactly 8 digits in a 4-2-2 layout
+	isDate := isoDateRegex.MatchString(match)
+	return digits >= 7 && digits <= 15 && hasFormatting && !isDate && isStandaloneNumber(text, start, end)
+}
+
+// isLuhnValid filters out random digit sequences that only look like card numbers
+func isLuhnValid(text string, start int, end int) bool {
+	var digits []int
+	for _, r := range text[start:end] {
+		if unicode.IsDigit(r) {
+			digits = append(digits, int(r-'0'))
+		}
+	}
+
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		digit := digits[i]
+		if (len(digits)-1-i)%2 == 1 {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+	}
+	return sum%10 == 0 && isStandaloneNumber(text, start, end)
+}
+
+// entropyDetector catches pasted keys and tokens that have no well known format
+type entropyDetector struct {
+	minLength  int
+	minEntropy float64
+}
+
+var secretCandidateRegex = regexp.MustCompile(`[A-Za-z0-9+/=_-]+`)
+
+// slack markup like <@U123> or <https://...|link> is never a secret on its own, the known secret formats
+// are still found inside links
+var slackMarkupRegex = regexp.MustCompile(`<(?:[@#!]|(?:https?|mailto):)[^>]*>`)
+
+func (d entropyDetector) Label() string {
+	return "SECRET"
+}
+
+func shannonEntropy(value string) float64 {
+	counts := make(map[rune]int)
+	for _, r := range value {
+		counts[r]++
+	}
+
+	entropy := 0.0
+	length := float64(len(value))
+	for _, count := range counts {
+		probability := float64(count) / length
+		entropy -= probability * math.Log2(probability)
+	}
+	return entropy
+}
+
+// a secret mixes lower case, upper case and digits, hex hashes and words do not
+func hasMixedCharacterClasses(value string) bool {
+	var hasLower, hasUpper, hasDigit bool
+	for _, r := range value {
+		switch {
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	return hasLower && hasUpper && hasDigit
+}
+
+func (d entropyDetector) FindAll(text string) [][2]int {
+	markupRanges := slackMarkupRegex.FindAllStringIndex(text, -1)
+	isInsideMarkup := func(start int) bool {
+		for _, markupRange := range markupRanges {
+			if start >= markupRange[0] && start < markupRange[1] {
+				return true
+			}
+		}
+		return false
+	}
+
+	var matches [][2]int
+	for _, match := range secretCandidateRegex.FindAllStringIndex(text, -1) {
+		candidate := text[match[0]:match[1]]
+		if len(candidate) < d.minLength || isInsideMarkup(match[0]) {
+			continue
+		}
+		if hasMixedCharacterClasses(candidate) && shannonEntropy(candidate) >= d.minEntropy {
+			matches = append(matches, [2]int{match[0], match[1]})
+		}
+	}
+	return matches
+}
+
+// loadCustomDetectors reads the workspace specific patterns from REDACTION_PATTERNS,
+// a JSON object of label to regex e.g. {"CUSTOMER": "(?i)\\b(acme|globex)\\b"}
+func loadCustomDetectors() []Detector {
+	customPatterns := os.Getenv("REDACTION_PATTERNS")
+	if customPatterns == "" {
+		return nil
+	}
+
+	var patterns map[string]string
+	if jsonUnmarshallError := json.Unmarshal([]byte(customPatterns), &patterns); jsonUnmarshallError != nil {
+		log.Printf("RedactConversations:loadCustomDetectors#Error parsing REDACTION_PATTERNS: %s", jsonUnmarshallError.Error())
+		return nil
+	}
+
+	// the labels are sorted so the same pattern wins on every run when two of them overlap
+	var detectors []Detector
+	for _, label := range slices.Sorted(maps.Keys(patterns)) {
+		detector, detectorError := NewRegexDetector(strings.ToUpper(label), patterns[label])
+		if detectorError != nil {
+			log.Printf("RedactConversations:loadCustomDetectors#Error compiling pattern %s: %s", label, detectorError.Error())
+			continue
+		}
+		detectors = append(detectors, detector)
+	}
+	return detectors
+}
+
+// DefaultDetectors are the built in detectors followed by the custom workspace patterns,
+// earlier detectors win when two of them match overlapping text
+func DefaultDetectors() []Detector {
+	detectors := []Detector{
+		regexDetector{label: "SECRET", regex: knownSecretRegex},
+		regexDetector{label: "EMAIL", regex: emailRegex},
+		regexDetector{label: "CARD", regex: cardRegex, validate: isLuhnValid},
+		regexDetector{label: "PHONE", regex: phoneRegex, validate: isPhoneNumber},
+		entropyDetector{minLength: 24, minEntropy: 4.0},
+	}
+	return append(detectors, loadCustomDetectors()...)
+}
@@ -0,0 +1,38 @@
+package RedactConversations
+
+import (
+	"testing"
+)
+
+func TestEntropyDetectorSkipsSlackMarkup(t *testing.T) {
+	detector := entropyDetector{minLength: 24, minEntropy: 4.0}
+	tests := []struct {
+		text      string
+		wantFound bool
+	}{
+		{"see <https://example.com/files/aB3dE5fG7hJ9kL1mN3pQ5rS7tU9vW|the doc>", false},
+		{"mail <mailto:aB3dE5fG7hJ9kL1mN3pQ5rS7tU9vW@example.com>", false},
+		{"ping <@U0123ABCDEF> please", false},
+		{"the key is aB3dE5fG7hJ9kL1mN3pQ5rS7tU9vW", true},
+	}
+	for _, test := range tests {
+		if found := len(detector.FindAll(test.text)) > 0; found != test.wantFound {
+			t.Errorf("FindAll(%q) found %v, want %v", test.text, found, test.wantFound)
+		}
+	}
+}
+
+func TestLoadCustomDetectorsIsSorted(t *testing.T) {
+	t.Setenv("REDACTION_PATTERNS", `{"zeta": "acme", "alpha": "acme corp", "mid": "corp"}`)
+
+	for range 10 {
+		detectors := loadCustomDetectors()
+		var labels []string
+		for _, detector := range detectors {
+			labels = append(labels, detector.Label())
+		}
+		if len(labels) != 3 || labels[0] != "ALPHA" || labels[1] != "MID" || labels[2] != "ZETA" {
+			t.Fatalf("labels = %v, want [ALPHA MID ZETA]", labels)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package RedactConversations
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+
+	"slack-tag-summariser/Models"
+)
+
+type ConversationResponseEntry = Models.ConversationResponseEntry
+
+var placeholderRegex = regexp.MustCompile(`\[[A-Z][A-Z0-9_]*_\d+\]`)
+
+// Redactor swaps sensitive values for placeholders like [EMAIL_1] and remembers them so that
+// they can be put back into the LLM output locally, the same value always gets the same placeholder
+type Redactor struct {
+	detectors []Detector
+
+	mu           sync.Mutex
+	placeholders map[string]string // original value -> placeholder
+	originals    map[string]string // placeholder -> original value
+	counters     map[string]int
+}
+
+func NewRedactor(detectors []Detector) *Redactor {
+	return &Redactor{
+		detectors:    detectors,
+		placeholders: make(map[string]string),
+		originals:    make(map[string]string),
+		counters:     make(map[string]int),
+	}
+}
+
+func (r *Redactor) placeholderFor(label string, value string) string {
+	if placeholder, exists := r.placeholders[value]; exists {
+		return placeholder
+	}
+	r.counters[label]++
+	placeholder := fmt.Sprintf("[%s_%d]", label, r.counters[label])
+	r.placeholders[value] = placeholder
+	r.originals[placeholder] = value
+	return placeholder
+}
+
+type detectedRange struct {
+	start int
+	end   int
+	label string
+}
+
+func (r *Redactor) Redact(text string) string {
+	var ranges []detectedRange
+	for _, detector := range r.detectors {
+		for _, match := range detector.FindAll(text) {
+			ranges = append(ranges, detectedRange{start: match[0], end: match[1], label: detector.Label()})
+		}
+	}
+	if len(ranges) == 0 {
+		return text
+	}
+
+	// stable sort keeps the detector order for matches starting at the same place
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].start < ranges[j].start
+	})
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	redacted := make([]byte, 0, len(text))
+	position := 0
+	for _, detected := range ranges {
+		// overlapping matches were already covered by an earlier one
+		if detected.start < position {
+			continue
+		}
+		redacted = append(redacted, text[position:detected.start]...)
+		redacted = append(redacted, r.placeholderFor(detected.label, text[detected.start:detected.end])...)
+		position = detected.end
+	}
+	redacted = append(redacted, text[position:]...)
+
+	return string(redacted)
+}
+
+// Restore puts the original values back, placeholders this redactor did not create are left alone
+func (r *Redactor) Restore(text string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return placeholderRegex.ReplaceAllStringFunc(text, func(placeholder string) string {
+		if original, exists := r.originals[placeholder]; exists {
+			return original
+		}
+		return placeholder
+	})
+}
+
+// RedactConversation returns a copy of the conversation with every message text redacted
+func (r *Redactor) RedactConversation(conversationContext ConversationResponseEntry) ConversationResponseEntry {
+	redactedContext := conversationContext
+	redactedContext.MentionText = r.Redact(conversationContext.MentionText)
+
+	redactedContext.Messages = make([]Models.ThreadMessage, len(conversationContext.Messages))
+	for i, msg := range conversationContext.Messages {
+		msg.Text = r.Redact(msg.Text)
+		redactedContext.Messages[i] = msg
+	}
+	return redactedContext
+}
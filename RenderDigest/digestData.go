@@ -0,0 +1,287 @@
+package RenderDigest
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"slack-tag-summariser/Localisation"
+	"slack-tag-summariser/Models"
+)
+
+type GenAiResponse = Models.GenAiResponse
+type ActionItem = Models.ActionItem
+type DigestOverview = Models.DigestOverview
+
+// below this confidence the action item or the summary is marked as a guess
+const LowConfidenceThreshold = 0.5
+
+// Labels translates the fixed labels of the templates, e.g. {{.T "summary"}} or {{$.T "due" .DueText}}
+type Labels struct {
+	Language string
+}
+
+func (labels Labels) T(key string, args ...interface{}) string {
+	return Localisation.T(labels.Language, key, args...)
+}
+
+// DigestData is what TemplateDigest, TemplateHeader, TemplateOverview, TemplateCarryOver and TemplateHidden
+// are rendered with
+type DigestData struct {
+	Labels
+	DigestDate string
+	// nil when the overview could not be generated
+	Overview *DigestOverview
+	// in the order of the ranking
+	Mentions []MentionData
+	// the mentions in one group per category, only set when the digest is grouped by category
+	Categories      []CategoryData
+	MentionCount    int
+	ActionableCount int
+	// number of mentions left out by the category filter of the user
+	HiddenCount int
+	// the open mentions of earlier digests, oldest first within a priority
+	CarryOver []CarryOverData
+}
+
+// CategoryData is one category of a digest grouped by category, TemplateCategory is rendered with it
+type CategoryData struct {
+	Labels
+	// empty for the mentions without a category
+	Category string
+	Label    string
+	Mentions []MentionData
+}
+
+// MentionData is what TemplateMention is rendered with
+type MentionData struct {
+	Labels
+	Mention GenAiResponse
+	// position of the mention in the digest from 0, the Block Kit block IDs are made from it
+	Index       int
+	ActionItems []ActionItemData
+	// how long ago the user was mentioned e.g. "3h", empty when the mention has no timestamp
+	Age string
+}
+
+// CarryOverData is an open mention of an earlier digest, TemplateCarryOverItem is rendered with it
+type CarryOverData struct {
+	Labels
+	Mention GenAiResponse
+	// position in the carry over section from 0, the Block Kit block IDs are made from it
+	Index int
+	// how long ago the user was mentioned e.g. "3d", empty when the mention has no timestamp
+	Age             string
+	FirstDigestDate string
+	NewReplies      int
+}
+
+func (item CarryOverData) PriorityEmoji() string {
+	return PriorityEmoji(item.Mention.Priority)
+}
+
+// Task is what the user is waiting to do, the first action item or else the first line of the summary
+func (item CarryOverData) Task() string {
+	if len(item.Mention.ActionRequired) > 0 {
+		return item.Mention.ActionRequired[0].Description
+	}
+	if len(item.Mention.Summary) > 0 {
+		return item.Mention.Summary[0]
+	}
+	return ""
+}
+
+type ActionItemData struct {
+	Labels
+	Item ActionItem
+}
+
+func (mention MentionData) PriorityEmoji() string {
+	return PriorityEmoji(mention.Mention.Priority)
+}
+
+// ActionableEmoji and ActionableValue display the Yes/No of the LLM, it always answers in english
+func (mention MentionData) ActionableEmoji() string {
+	if strings.ToLower(mention.Mention.Actionable) == "no" {
+		return "➖"
+	}
+	return "✅"
+}
+
+func (mention MentionData) ActionableValue() string {
+	switch strings.ToLower(mention.Mention.Actionable) {
+	case "yes":
+		return mention.T("yes")
+	case "no":
+		return mention.T("no")
+	}
+	return mention.Mention.Actionable
+}
+
+func (mention MentionData) CategoryLabel() string {
+	return CategoryLabel(mention.Mention.Category, mention.Language)
+}
+
+func PriorityEmoji(priority string) string {
+	switch strings.ToUpper(priority) {
+	case "P0", "P1":
+		return "🚨"
+	case "P2":
+		return "⚠️"
+	case "P3":
+		return "🔵"
+	}
+	return "⚪"
+}
+
+func CategoryLabel(category string, language string) string {
+	if category == "" {
+		return Localisation.T(language, "category_other")
+	}
+	return Localisation.T(language, "category_"+category)
+}
+
+func parseSlackTimestamp(slackTimestamp string) (time.Time, bool) {
+	seconds, _, _ := strings.Cut(slackTimestamp, ".")
+	unixSeconds, parseError := strconv.ParseInt(seconds, 10, 64)
+	if parseError != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(unixSeconds, 0), true
+}
+
+func formatAge(age time.Duration) string {
+	switch {
+	case age < time.Hour:
+		return fmt.Sprintf("%dm", int(age.Minutes()))
+	case age < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(age.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(age.Hours()/24))
+}
+
+// NewMentionData prepares a single mention for TemplateMention, now is used for the age of the mention
+func NewMentionData(r GenAiResponse, index int, language string, now time.Time) MentionData {
+	labels := Labels{Language: language}
+	mention := MentionData{Labels: labels, Mention: r, Index: index}
+	for _, a := range r.ActionRequired {
+		mention.ActionItems = append(mention.ActionItems, ActionItemData{Labels: labels, Item: a})
+	}
+	if mentionTime, ok := parseSlackTimestamp(r.MentionTimestamp); ok {
+		mention.Age = formatAge(now.Sub(mentionTime))
+	}
+	return mention
+}
+
+// NewCarryOverData prepares an open mention of an earlier digest for TemplateCarryOverItem
+func NewCarryOverData(carried Models.CarryOverItem, index int, language string, now time.Time) CarryOverData {
+	item := CarryOverData{
+		Labels:          Labels{Language: language},
+		Mention:         carried.Response,
+		Index:           index,
+		FirstDigestDate: carried.FirstDigestDate,
+		NewReplies:      carried.NewReplies,
+	}
+	if mentionTime, ok := parseSlackTimestamp(carried.Response.MentionTimestamp); ok {
+		item.Age = formatAge(now.Sub(mentionTime))
+	}
+	return item
+}
+
+// NewDigestData prepares a digest for the templates, when grouped by category the mentions are numbered
+// in the order of the categories
+func NewDigestData(digest Models.StoredDigest, groupByCategory bool, now time.Time) DigestData {
+	labels := Labels{Language: digest.Language}
+	data := DigestData{
+		Labels:       labels,
+		DigestDate:   digest.DigestDate,
+		Overview:     digest.Overview,
+		MentionCount: len(digest.Responses),
+		HiddenCount:  digest.HiddenCount,
+	}
+	for _, r := range digest.Responses {
+		if strings.ToLower(r.Actionable) == "yes" {
+			data.ActionableCount++
+		}
+	}
+	for i, carried := range digest.CarryOver {
+		data.CarryOver = append(data.CarryOver, NewCarryOverData(carried, i, digest.Language, now))
+	}
+
+	if !groupByCategory {
+		for i, r := range digest.Responses {
+			data.Mentions = append(data.Mentions, NewMentionData(r, i, digest.Language, now))
+		}
+		return data
+	}
+
+	// the categories in the order of SummaryCategories, the ranking order is kept inside each of them
+	// and mentions without a category come last
+	for _, category := range append(slices.Clone(Models.SummaryCategories), "") {
+		group := CategoryData{Labels: labels, Category: category, Label: CategoryLabel(category, digest.Language)}
+		for _, r := range digest.Responses {
+			if r.Category == category {
+				mention := NewMentionData(r, len(data.Mentions), digest.Language, now)
+				group.Mentions = append(group.Mentions, mention)
+				data.Mentions = append(data.Mentions, mention)
+			}
+		}
+		if len(group.Mentions) > 0 {
+			data.Categories = append(data.Categories, group)
+		}
+	}
+	return data
+}
+
+// matches the slack references of the summaries: "<@U123>", "<#C123|name>" and "<https://...|label>"
+var slackReferenceRegex = regexp.MustCompile(`<([@#!]?)([^>|]+)(?:\|([^>]*))?>`)
+
+// slack escapes these three characters in message text, the references have to be replaced first
+var slackEntityReplacer = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&")
+
+// replaceSlackReferences rewrites the references with the link function and unescapes the rest of the text
+func replaceSlackReferences(text string, link func(url string, label string) string) string {
+	return slackEntityReplacer.Replace(slackReferenceRegex.ReplaceAllStringFunc(text, func(reference string) string {
+		match := slackReferenceRegex.FindStringSubmatch(reference)
+		prefix, value, label := match[1], match[2], match[3]
+		switch {
+		case prefix == "@":
+			return "@" + value
+		case prefix == "#" && label != "":
+			return "#" + label
+		case prefix == "#":
+			return "#" + value
+		case prefix == "!" && label != "":
+			return label
+		case prefix == "!":
+			return "@" + value
+		case strings.HasPrefix(value, "mailto:"):
+			return strings.TrimPrefix(value, "mailto:")
+		}
+		return link(value, label)
+	}))
+}
+
+// PlainTextFromMrkdwn turns the slack references into text an email client or a browser can show
+func PlainTextFromMrkdwn(text string) string {
+	return replaceSlackReferences(text, func(url string, label string) string {
+		if label != "" {
+			return label
+		}
+		return url
+	})
+}
+
+// MarkdownFromMrkdwn turns the slack links into markdown links, the emphasis is left as it is so the
+// *bold* of slack shows as italic
+func MarkdownFromMrkdwn(text string) string {
+	return replaceSlackReferences(text, func(url string, label string) string {
+		if label == "" {
+			return "<" + url + ">"
+		}
+		return "[" + label + "](" + url + ")"
+	})
+}
@@ -0,0 +1,91 @@
+package RenderDigest
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"slack-tag-summariser/Repo"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RunPreviewCommand renders a stored digest for review, e.g. to check the template overrides of a
+// workspace before they are used for everyone:
+//
+//	go run . preview -user U0123ABCD -format html -workspace T0123ABCD -out digest.html
+//
+// It returns the exit code of the command.
+func RunPreviewCommand(args []string, out io.Writer, dbPool *pgxpool.Pool) int {
+	flags := flag.NewFlagSet("preview", flag.ContinueOnError)
+	flags.SetOutput(out)
+
+	userId := flags.String("user", "", "user whose digest is rendered")
+	digestDate := flags.String("date", "", "day of the digest (YYYY-MM-DD), the latest one when empty")
+	format := flags.String("format", FormatMarkdown, "mrkdwn, blockkit, markdown or html")
+	workspaceId := flags.String("workspace", "", "renders with the template overrides of this workspace")
+	outPath := flags.String("out", "", "file to write the digest to (default stdout)")
+
+	if parseError := flags.Parse(args); parseError != nil {
+		return 2
+	}
+	if *userId == "" {
+		fmt.Fprintln(out, "-user is required")
+		flags.Usage()
+		return 2
+	}
+
+	renderer, rendererError := NewRenderer(*format, *workspaceId)
+	if rendererError != nil {
+		fmt.Fprintln(out, "Failed to load the templates:", rendererError)
+		return 1
+	}
+
+	storedDigest, digestExists, getDigestError := Repo.GetDigest(*userId, *digestDate, dbPool)
+	if getDigestError != nil {
+		fmt.Fprintln(out, "Failed to get the digest:", getDigestError)
+		return 1
+	}
+	if !digestExists {
+		fmt.Fprintf(out, "No digest of %s for %s\n", *userId, cmp.Or(*digestDate, "any day"))
+		return 1
+	}
+
+	// grouped like the user sees it, a missing preference renders the digest ungrouped
+	userPreferences, getPreferencesError := Repo.GetUserPreferences(*userId, dbPool)
+	if getPreferencesError != nil {
+		fmt.Fprintln(out, "Failed to get the preferences, the digest is not grouped:", getPreferencesError)
+	}
+
+	rendered, renderError := renderer.Render(TemplateDigest, NewDigestData(storedDigest, userPreferences.GroupByCategory, time.Now()))
+	if renderError != nil {
+		fmt.Fprintln(out, "Failed to render the digest:", renderError)
+		return 1
+	}
+
+	// indented so the blocks can be read and pasted into the Block Kit Builder
+	if *format == FormatBlockKit {
+		var indented bytes.Buffer
+		if indentError := json.Indent(&indented, []byte(rendered), "", "  "); indentError != nil {
+			fmt.Fprintln(out, "The blocks are not valid JSON:", indentError)
+			return 1
+		}
+		rendered = indented.String() + "\n"
+	}
+
+	if *outPath == "" {
+		fmt.Fprint(out, rendered)
+		return 0
+	}
+	if writeError := os.WriteFile(*outPath, []byte(rendered), 0o644); writeError != nil {
+		fmt.Fprintln(out, "Failed to write the digest:", writeError)
+		return 1
+	}
+	fmt.Fprintf(out, "Wrote the %s digest of %s for %s to %s\n", *format, storedDigest.DigestDate, *userId, *outPath)
+	return 0
+}
@@ -0,0 +1,30 @@
+package RenderDigest
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPreviewCommandChecksItsFlags(t *testing.T) {
+	t.Setenv("DIGEST_TEMPLATES_DIR", "")
+
+	tests := []struct {
+		args         []string
+		wantExitCode int
+		wantOutput   string
+	}{
+		{[]string{"-format", "html"}, 2, "-user is required"},
+		{[]string{"-user", "U0EVALUSER", "-format", "pdf"}, 1, `unknown format "pdf"`},
+		// the templates load before the database is needed
+		{[]string{"-user", "U0EVALUSER", "-format", "html"}, 1, "Failed to get the digest: database pool is not initialized"},
+	}
+	for _, test := range tests {
+		var out strings.Builder
+		if exitCode := RunPreviewCommand(test.args, &out, nil); exitCode != test.wantExitCode {
+			t.Errorf("preview %v exited with %d, want %d:\n%s", test.args, exitCode, test.wantExitCode, out.String())
+		}
+		if !strings.Contains(out.String(), test.wantOutput) {
+			t.Errorf("preview %v output is missing %q:\n%s", test.args, test.wantOutput, out.String())
+		}
+	}
+}
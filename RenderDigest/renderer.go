@@ -0,0 +1,210 @@
+package RenderDigest
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmlTemplate "html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	textTemplate "text/template"
+)
+
+// the formats a digest can be rendered in, each one is a template file in the templates directory
+const (
+	// slack mrkdwn, the text of the digest messages
+	FormatMrkdwn = "mrkdwn"
+	// a JSON array of Block Kit blocks, the mrkdwn templates can be included in it
+	FormatBlockKit = "blockkit"
+	FormatMarkdown = "markdown"
+	FormatHtml     = "html"
+)
+
+var Formats = []string{FormatMrkdwn, FormatBlockKit, FormatMarkdown, FormatHtml}
+
+// the templates every format defines, TemplateDigest renders the whole digest at once while slack
+// renders the other ones separately so the digest can be split across messages
+const (
+	TemplateDigest   = "digest"
+	TemplateHeader   = "header"
+	TemplateOverview = "overview"
+	// the heading of a category when the digest is grouped by category, rendered with CategoryData
+	TemplateCategory = "category"
+	// a single mention, rendered with MentionData
+	TemplateMention = "mention"
+	// the heading of the open mentions of earlier digests, rendered with DigestData
+	TemplateCarryOver = "carry_over"
+	// a single open mention of an earlier digest, rendered with CarryOverData
+	TemplateCarryOverItem = "carry_over_item"
+	// the footer with the number of mentions left out by the category filter
+	TemplateHidden = "hidden"
+)
+
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+// Renderer renders a digest in one format from the default templates and the overrides of the workspace
+type Renderer interface {
+	Format() string
+	// Render executes one of the named templates e.g. TemplateMention with a MentionData
+	Render(templateName string, data any) (string, error)
+}
+
+type textRenderer struct {
+	format   string
+	template *textTemplate.Template
+}
+
+func (renderer textRenderer) Format() string {
+	return renderer.format
+}
+
+func (renderer textRenderer) Render(templateName string, data any) (string, error) {
+	var rendered bytes.Buffer
+	if renderError := renderer.template.ExecuteTemplate(&rendered, templateName, data); renderError != nil {
+		return "", renderError
+	}
+	return rendered.String(), nil
+}
+
+// htmlRenderer escapes everything that comes from the threads, the other formats are text for slack or markdown
+type htmlRenderer struct {
+	template *htmlTemplate.Template
+}
+
+func (renderer htmlRenderer) Format() string {
+	return FormatHtml
+}
+
+func (renderer htmlRenderer) Render(templateName string, data any) (string, error) {
+	var rendered bytes.Buffer
+	if renderError := renderer.template.ExecuteTemplate(&rendered, templateName, data); renderError != nil {
+		return "", renderError
+	}
+	return rendered.String(), nil
+}
+
+// slack IDs are upper case letters and digits, anything else is not looked up on disk
+var workspaceIdRegex = regexp.MustCompile(`^[A-Z0-9]+$`)
+
+// DIGEST_TEMPLATES_DIR holds the template overrides, one directory per workspace ID with a file per
+// format e.g. "T0123ABCD/html.tmpl". An override only has to define the templates it changes.
+func getTemplateOverrides(format string, workspaceId string) (string, bool, error) {
+	templatesDir := os.Getenv("DIGEST_TEMPLATES_DIR")
+	if templatesDir == "" || !workspaceIdRegex.MatchString(workspaceId) {
+		return "", false, nil
+	}
+
+	overrides, readError := os.ReadFile(filepath.Join(templatesDir, workspaceId, format+".tmpl"))
+	if errors.Is(readError, fs.ErrNotExist) {
+		return "", false, nil
+	}
+	if readError != nil {
+		return "", false, readError
+	}
+	return string(overrides), true, nil
+}
+
+func getDefaultTemplates(format string) string {
+	templates, _ := defaultTemplates.ReadFile("templates/" + format + ".tmpl")
+	return string(templates)
+}
+
+// parseTextTemplates parses the templates of the format after the ones of the formats it builds on,
+// the overrides of each format come right after its defaults so they replace them
+func parseTextTemplates(format string, workspaceId string, baseFormats ...string) (*textTemplate.Template, error) {
+	parsedTemplate := textTemplate.New(format)
+	parsedTemplate.Funcs(templateFuncs).Funcs(textTemplate.FuncMap{
+		// include renders a named template to a string, so Block Kit can put mrkdwn into a JSON string
+		"include": func(templateName string, data any) (string, error) {
+			var included bytes.Buffer
+			includeError := parsedTemplate.ExecuteTemplate(&included, templateName, data)
+			return included.String(), includeError
+		},
+	})
+
+	for _, templateFormat := range append(baseFormats, format) {
+		if _, parseError := parsedTemplate.Parse(getDefaultTemplates(templateFormat)); parseError != nil {
+			return nil, parseError
+		}
+		overrides, hasOverrides, overridesError := getTemplateOverrides(templateFormat, workspaceId)
+		if overridesError != nil {
+			return nil, overridesError
+		}
+		if hasOverrides {
+			if _, parseError := parsedTemplate.Parse(overrides); parseError != nil {
+				return nil, fmt.Errorf("%s overrides of %s: %w", templateFormat, workspaceId, parseError)
+			}
+		}
+	}
+	return parsedTemplate, nil
+}
+
+// NewRenderer returns the renderer of the format with the template overrides of the workspace, an empty
+// workspace ID renders with the default templates
+func NewRenderer(format string, workspaceId string) (Renderer, error) {
+	switch format {
+	case FormatMrkdwn, FormatMarkdown:
+		parsedTemplate, parseError := parseTextTemplates(format, workspaceId)
+		if parseError != nil {
+			return nil, parseError
+		}
+		return textRenderer{format: format, template: parsedTemplate}, nil
+	case FormatBlockKit:
+		parsedTemplate, parseError := parseTextTemplates(format, workspaceId, FormatMrkdwn)
+		if parseError != nil {
+			return nil, parseError
+		}
+		return textRenderer{format: format, template: parsedTemplate}, nil
+	case FormatHtml:
+		parsedTemplate, parseError := htmlTemplate.New(format).Funcs(htmlTemplate.FuncMap(templateFuncs)).Parse(getDefaultTemplates(format))
+		if parseError != nil {
+			return nil, parseError
+		}
+		overrides, hasOverrides, overridesError := getTemplateOverrides(format, workspaceId)
+		if overridesError != nil {
+			return nil, overridesError
+		}
+		if hasOverrides {
+			if _, parseError = parsedTemplate.Parse(overrides); parseError != nil {
+				return nil, fmt.Errorf("%s overrides of %s: %w", format, workspaceId, parseError)
+			}
+		}
+		return htmlRenderer{template: parsedTemplate}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q, use one of %s", format, strings.Join(Formats, ", "))
+}
+
+var templateFuncs = map[string]any{
+	"add":   func(a int, b int) int { return a + b },
+	"lower": strings.ToLower,
+	"join":  strings.Join,
+	// squash puts a quote spread over several lines on one line
+	"squash": func(text string) string { return strings.Join(strings.Fields(text), " ") },
+	// joinNonEmpty joins the parts that are not empty, for lists of optional details
+	"joinNonEmpty": func(separator string, parts ...string) string {
+		var nonEmpty []string
+		for _, part := range parts {
+			if part != "" {
+				nonEmpty = append(nonEmpty, part)
+			}
+		}
+		return strings.Join(nonEmpty, separator)
+	},
+	"lowConfidence": func(confidence float64) bool { return confidence < LowConfidenceThreshold },
+	// json quotes a value for the Block Kit templates
+	"json": func(value any) (string, error) {
+		var quoted bytes.Buffer
+		encoder := json.NewEncoder(&quoted)
+		encoder.SetEscapeHTML(false)
+		encodeError := encoder.Encode(value)
+		return strings.TrimSuffix(quoted.String(), "\n"), encodeError
+	},
+	"plain":    PlainTextFromMrkdwn,
+	"markdown": MarkdownFromMrkdwn,
+}
@@ -0,0 +1,123 @@
+package RenderDigest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"slack-tag-summariser/Models"
+)
+
+func newTestDigest() Models.StoredDigest {
+	return Models.StoredDigest{
+		UserID:     "U0EVALUSER",
+		DigestDate: "2024-05-15",
+		Language:   "en",
+		Responses: []GenAiResponse{{
+			// slack escapes these in message text, the summaries keep the escaping of the thread
+			Summary:          []string{"<@U0AUTHOR1> asks to run &lt;script&gt;alert(1)&lt;/script&gt; &amp; deploy", "See <https://example.com/runbook|the runbook>"},
+			Actionable:       "Yes",
+			Priority:         "P1",
+			Category:         "question",
+			Tags:             []string{"<b>deploy</b>"},
+			Evidence:         []Models.EvidenceQuote{{Quote: `<img src=x onerror="alert(1)">`, SourcePermalink: "javascript:alert(1)"}},
+			MentionPermalink: "https://example.slack.com/archives/C0DEPLOY/p1715760000000100",
+			MentionTimestamp: "1715760000.000100",
+			Confidence:       1,
+		}},
+	}
+}
+
+func renderTestDigest(t *testing.T, format string, workspaceId string) string {
+	t.Helper()
+
+	renderer, rendererError := NewRenderer(format, workspaceId)
+	if rendererError != nil {
+		t.Fatalf("NewRenderer(%s, %q): %v", format, workspaceId, rendererError)
+	}
+	now := time.Date(2024, time.May, 15, 12, 0, 0, 0, time.UTC)
+	rendered, renderError := renderer.Render(TemplateDigest, NewDigestData(newTestDigest(), false, now))
+	if renderError != nil {
+		t.Fatalf("rendering %s: %v", format, renderError)
+	}
+	return rendered
+}
+
+func TestHtmlRendererEscapesThreadText(t *testing.T) {
+	t.Setenv("DIGEST_TEMPLATES_DIR", "")
+
+	rendered := renderTestDigest(t, FormatHtml, "")
+
+	for _, unescaped := range []string{"<script>", "<img", "<b>deploy", `href="javascript:`} {
+		if strings.Contains(rendered, unescaped) {
+			t.Errorf("the html digest contains %q from the thread:\n%s", unescaped, rendered)
+		}
+	}
+	for _, escaped := range []string{
+		"@U0AUTHOR1 asks to run &lt;script&gt;alert(1)&lt;/script&gt; &amp; deploy",
+		"See the runbook",
+		"<code>&lt;b&gt;deploy&lt;/b&gt;</code>",
+		"&lt;img src=x onerror=&#34;alert(1)&#34;&gt;",
+	} {
+		if !strings.Contains(rendered, escaped) {
+			t.Errorf("the html digest is missing %q:\n%s", escaped, rendered)
+		}
+	}
+}
+
+func TestMarkdownRendererLinksSlackReferences(t *testing.T) {
+	t.Setenv("DIGEST_TEMPLATES_DIR", "")
+
+	rendered := renderTestDigest(t, FormatMarkdown, "")
+
+	for _, expected := range []string{
+		"# 📬",
+		"@U0AUTHOR1 asks to run <script>alert(1)</script> & deploy",
+		"See [the runbook](https://example.com/runbook)",
+	} {
+		if !strings.Contains(rendered, expected) {
+			t.Errorf("the markdown digest is missing %q:\n%s", expected, rendered)
+		}
+	}
+}
+
+func TestTemplateOverridesOfTheWorkspace(t *testing.T) {
+	templatesDir := t.TempDir()
+	t.Setenv("DIGEST_TEMPLATES_DIR", templatesDir)
+
+	workspaceDir := filepath.Join(templatesDir, "T0ACME")
+	if mkdirError := os.Mkdir(workspaceDir, 0o755); mkdirError != nil {
+		t.Fatal(mkdirError)
+	}
+	override := `{{define "header"}}<h1>Acme digest of {{.DigestDate}}</h1>{{end}}`
+	if writeError := os.WriteFile(filepath.Join(workspaceDir, "html.tmpl"), []byte(override), 0o644); writeError != nil {
+		t.Fatal(writeError)
+	}
+
+	rendered := renderTestDigest(t, FormatHtml, "T0ACME")
+	if !strings.Contains(rendered, "<h1>Acme digest of 2024-05-15</h1>") {
+		t.Errorf("the header override was not used:\n%s", rendered)
+	}
+	// the templates the override does not define keep their defaults
+	if !strings.Contains(rendered, "See the runbook") {
+		t.Errorf("the default mention template is missing:\n%s", rendered)
+	}
+
+	for _, workspaceId := range []string{"", "T0OTHER", "../T0ACME", "t0acme"} {
+		if rendered := renderTestDigest(t, FormatHtml, workspaceId); strings.Contains(rendered, "Acme digest") {
+			t.Errorf("workspace %q got the overrides of T0ACME", workspaceId)
+		}
+	}
+	if _, hasOverrides, _ := getTemplateOverrides(FormatMarkdown, "T0ACME"); hasOverrides {
+		t.Error("the html overrides were used for markdown")
+	}
+
+	if writeError := os.WriteFile(filepath.Join(workspaceDir, "markdown.tmpl"), []byte(`{{define "header"}}{{.Missing`), 0o644); writeError != nil {
+		t.Fatal(writeError)
+	}
+	if _, rendererError := NewRenderer(FormatMarkdown, "T0ACME"); rendererError == nil || !strings.Contains(rendererError.Error(), "markdown overrides of T0ACME") {
+		t.Errorf("expected the broken override to be reported, got %v", rendererError)
+	}
+}
@@ -137,13 +137,13 @@ func GetInstalledUsers(dbPool *pgxpool.Pool) ([]User, error) {
 	for rows.Next() {
 		var user User
 		if err := rows.Scan(&user.UserID, &user.UserToken); err != nil {
-			fmt.Println("Error scanning user row: %v\n", err)
+			fmt.Printf("Error scanning user row: %v\n", err)
 			continue
 		}
 		decryptedToken, userTokenDecryptionErr := decrypt(user.UserToken)
 
 		if userTokenDecryptionErr != nil {
-			fmt.Println("Error decrypting token for user %s: %v\n", user.UserID, userTokenDecryptionErr)
+			fmt.Printf("Error decrypting token for user %s: %v\n", user.UserID, userTokenDecryptionErr)
 			continue // Skip this user and continue with the next one
 		}
 		user.UserToken = decryptedToken
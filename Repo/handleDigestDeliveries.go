@@ -0,0 +1,134 @@
+package Repo
+
+import (
+	"context"
+	"fmt"
+
+	"slack-tag-summariser/Models"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type DigestDelivery = Models.DigestDelivery
+
+// GetDigestDeliveries returns the parts of the digest of the day that were already posted to the target, keyed by part index
+func GetDigestDeliveries(userId string, digestDate string, target string, dbPool *pgxpool.Pool) (map[int]DigestDelivery, error) {
+	if dbPool == nil {
+		return nil, fmt.Errorf("database pool is not initialized")
+	}
+
+	query := `
+		SELECT part_index, channel_id, message_ts, content_hash FROM digest_deliveries
+		WHERE user_id = $1 AND digest_date = $2 AND target = $3`
+
+	rows, dbQueryError := dbPool.Query(context.Background(), query, userId, digestDate, target)
+	if dbQueryError != nil {
+		return nil, dbQueryError
+	}
+	defer rows.Close()
+
+	deliveries := make(map[int]DigestDelivery)
+	for rows.Next() {
+		delivery := DigestDelivery{UserID: userId, DigestDate: digestDate, Target: target}
+		if scanError := rows.Scan(&delivery.PartIndex, &delivery.ChannelId, &delivery.MessageTimestamp, &delivery.ContentHash); scanError != nil {
+			return nil, scanError
+		}
+		deliveries[delivery.PartIndex] = delivery
+	}
+	return deliveries, rows.Err()
+}
+
+// SaveDigestDelivery records a posted part, a part that was already recorded keeps its first message
+// and only gets the hash of its updated content
+func SaveDigestDelivery(delivery DigestDelivery, dbPool *pgxpool.Pool) error {
+	if dbPool == nil {
+		return fmt.Errorf("database pool is not initialized")
+	}
+
+	query := `
+		INSERT INTO digest_deliveries (user_id, digest_date, target, part_index, channel_id, message_ts, content_hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (user_id, digest_date, target, part_index) DO UPDATE
+		SET content_hash = EXCLUDED.content_hash`
+
+	_, saveDeliveryError := dbPool.Exec(context.Background(), query,
+		delivery.UserID,
+		delivery.DigestDate,
+		delivery.Target,
+		delivery.PartIndex,
+		delivery.ChannelId,
+		delivery.MessageTimestamp,
+		delivery.ContentHash,
+	)
+	return saveDeliveryError
+}
+
+// DeleteDigestDelivery forgets a part whose message was deleted because the digest got shorter
+func DeleteDigestDelivery(delivery DigestDelivery, dbPool *pgxpool.Pool) error {
+	if dbPool == nil {
+		return fmt.Errorf("database pool is not initialized")
+	}
+
+	query := `
+		DELETE FROM digest_deliveries
+		WHERE user_id = $1 AND digest_date = $2 AND target = $3 AND part_index = $4`
+
+	_, deleteDeliveryError := dbPool.Exec(context.Background(), query,
+		delivery.UserID,
+		delivery.DigestDate,
+		delivery.Target,
+		delivery.PartIndex,
+	)
+	return deleteDeliveryError
+}
+
+type DigestPublication = Models.DigestPublication
+
+// GetDigestPublications returns how the digest of the day went for each target it was published to
+func GetDigestPublications(userId string, digestDate string, dbPool *pgxpool.Pool) (map[string]DigestPublication, error) {
+	if dbPool == nil {
+		return nil, fmt.Errorf("database pool is not initialized")
+	}
+
+	query := `
+		SELECT target, status, error, updated_at FROM digest_publications
+		WHERE user_id = $1 AND digest_date = $2`
+
+	rows, dbQueryError := dbPool.Query(context.Background(), query, userId, digestDate)
+	if dbQueryError != nil {
+		return nil, dbQueryError
+	}
+	defer rows.Close()
+
+	publications := make(map[string]DigestPublication)
+	for rows.Next() {
+		publication := DigestPublication{UserID: userId, DigestDate: digestDate}
+		if scanError := rows.Scan(&publication.Target, &publication.Status, &publication.Error, &publication.UpdatedAt); scanError != nil {
+			return nil, scanError
+		}
+		publications[publication.Target] = publication
+	}
+	return publications, rows.Err()
+}
+
+// SaveDigestPublication records the latest attempt to publish the digest of the day to a target
+func SaveDigestPublication(publication DigestPublication, dbPool *pgxpool.Pool) error {
+	if dbPool == nil {
+		return fmt.Errorf("database pool is not initialized")
+	}
+
+	query := `
+		INSERT INTO digest_publications (user_id, digest_date, target, status, error)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, digest_date, target) DO UPDATE
+		SET status = EXCLUDED.status, error = EXCLUDED.error, updated_at = now()`
+
+	_, savePublicationError := dbPool.Exec(context.Background(), query,
+		publication.UserID,
+		publication.DigestDate,
+		publication.Target,
+		publication.Status,
+		publication.Error,
+	)
+	return savePublicationError
+}
@@ -0,0 +1,126 @@
+package Repo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"slack-tag-summariser/Models"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type DigestItem = Models.DigestItem
+
+// SaveDigestItems records the mentions of a digest that was sent. Items the user already acted on keep
+// their state, except snoozed items that are due: they were just shown again so they are open again.
+func SaveDigestItems(userId string, items []DigestItem, dbPool *pgxpool.Pool) error {
+	if dbPool == nil {
+		return fmt.Errorf("database pool is not initialized")
+	}
+
+	query := `
+		INSERT INTO digest_items (user_id, channel_id, mention_ts, mention_permalink, mention_user_id)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, channel_id, mention_ts) DO UPDATE SET
+			mention_permalink = EXCLUDED.mention_permalink,
+			mention_user_id = EXCLUDED.mention_user_id,
+			state = CASE WHEN digest_items.state = 'snoozed' AND digest_items.snoozed_until <= now() THEN 'open' ELSE digest_items.state END,
+			snoozed_until = CASE WHEN digest_items.state = 'snoozed' AND digest_items.snoozed_until <= now() THEN NULL ELSE digest_items.snoozed_until END,
+			updated_at = now()`
+
+	for _, item := range items {
+		_, saveItemError := dbPool.Exec(context.Background(), query,
+			userId,
+			item.ChannelId,
+			item.MentionTimestamp,
+			item.MentionPermalink,
+			item.MentionUserId,
+		)
+		if saveItemError != nil {
+			return saveItemError
+		}
+	}
+	return nil
+}
+
+// SaveDigestItemState stores what the user did with an item, the item is created when the digest
+// it was in could not be recorded
+func SaveDigestItemState(item DigestItem, dbPool *pgxpool.Pool) error {
+	if dbPool == nil {
+		return fmt.Errorf("database pool is not initialized")
+	}
+
+	query := `
+		INSERT INTO digest_items (user_id, channel_id, mention_ts, state, snoozed_until)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, channel_id, mention_ts) DO UPDATE SET
+			state = EXCLUDED.state,
+			snoozed_until = EXCLUDED.snoozed_until,
+			updated_at = now()`
+
+	_, saveStateError := dbPool.Exec(context.Background(), query,
+		item.UserID,
+		item.ChannelId,
+		item.MentionTimestamp,
+		item.State,
+		item.SnoozedUntil,
+	)
+	return saveStateError
+}
+
+// GetActedOnDigestItems returns the items of the user that are done, snoozed or not relevant
+func GetActedOnDigestItems(userId string, dbPool *pgxpool.Pool) ([]DigestItem, error) {
+	if dbPool == nil {
+		return nil, fmt.Errorf("database pool is not initialized")
+	}
+
+	query := `
+		SELECT channel_id, mention_ts, mention_permalink, mention_user_id, state, snoozed_until FROM digest_items
+		WHERE user_id = $1 AND state <> 'open'`
+
+	rows, dbQueryError := dbPool.Query(context.Background(), query, userId)
+	if dbQueryError != nil {
+		return nil, dbQueryError
+	}
+	defer rows.Close()
+
+	var items []DigestItem
+	for rows.Next() {
+		item := DigestItem{UserID: userId}
+		if scanError := rows.Scan(&item.ChannelId, &item.MentionTimestamp, &item.MentionPermalink, &item.MentionUserId, &item.State, &item.SnoozedUntil); scanError != nil {
+			return nil, scanError
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// GetNotRelevantCountsByChannel counts the items the user marked as not relevant since the given time, per channel
+func GetNotRelevantCountsByChannel(userId string, since time.Time, dbPool *pgxpool.Pool) (map[string]int, error) {
+	if dbPool == nil {
+		return nil, fmt.Errorf("database pool is not initialized")
+	}
+
+	query := `
+		SELECT channel_id, COUNT(*) FROM digest_items
+		WHERE user_id = $1 AND state = 'not_relevant' AND updated_at >= $2
+		GROUP BY channel_id`
+
+	rows, dbQueryError := dbPool.Query(context.Background(), query, userId, since)
+	if dbQueryError != nil {
+		return nil, dbQueryError
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var channelId string
+		var count int
+		if scanError := rows.Scan(&channelId, &count); scanError != nil {
+			return nil, scanError
+		}
+		counts[channelId] = count
+	}
+	return counts, rows.Err()
+}
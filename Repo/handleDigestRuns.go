@@ -0,0 +1,78 @@
+package Repo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"slack-tag-summariser/Models"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type DigestRun = Models.DigestRun
+type DigestRunTotals = Models.DigestRunTotals
+
+func SaveDigestRun(run DigestRun, dbPool *pgxpool.Pool) error {
+	if dbPool == nil {
+		return fmt.Errorf("database pool is not initialized")
+	}
+
+	query := `
+		INSERT INTO digest_runs (run_id, user_id, digest_date, outcome, detail, mention_count)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+
+	_, dbInsertError := dbPool.Exec(context.Background(), query,
+		run.RunId,
+		run.UserID,
+		run.DigestDate,
+		run.Outcome,
+		run.Detail,
+		run.MentionCount,
+	)
+	return dbInsertError
+}
+
+// GetDigestRuns returns the outcomes of the digests between from and to (YYYY-MM-DD, both inclusive),
+// newest first, optionally only the ones with the given outcome
+func GetDigestRuns(from string, to string, outcome string, dbPool *pgxpool.Pool) ([]DigestRun, error) {
+	if dbPool == nil {
+		return nil, fmt.Errorf("database pool is not initialized")
+	}
+
+	query := `
+		SELECT run_id, user_id, digest_date::TEXT, outcome, detail, mention_count, created_at FROM digest_runs
+		WHERE digest_date BETWEEN $1 AND $2 AND ($3 = '' OR outcome = $3)
+		ORDER BY created_at DESC`
+
+	rows, dbQueryError := dbPool.Query(context.Background(), query, from, to, outcome)
+	if dbQueryError != nil {
+		return nil, dbQueryError
+	}
+	defer rows.Close()
+
+	var runs []DigestRun
+	for rows.Next() {
+		var run DigestRun
+		if scanError := rows.Scan(&run.RunId, &run.UserID, &run.DigestDate, &run.Outcome, &run.Detail, &run.MentionCount, &run.CreatedAt); scanError != nil {
+			return nil, scanError
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// GetDigestRunTotals counts the digests with mentions that were sent to the user since the given time
+func GetDigestRunTotals(userId string, since time.Time, dbPool *pgxpool.Pool) (DigestRunTotals, error) {
+	var totals DigestRunTotals
+	if dbPool == nil {
+		return totals, fmt.Errorf("database pool is not initialized")
+	}
+
+	query := `
+		SELECT COUNT(*), COALESCE(SUM(mention_count), 0) FROM digest_runs
+		WHERE user_id = $1 AND outcome = 'sent' AND detail = 'digest' AND created_at >= $2`
+
+	dbQueryError := dbPool.QueryRow(context.Background(), query, userId, since).Scan(&totals.Digests, &totals.Mentions)
+	return totals, dbQueryError
+}
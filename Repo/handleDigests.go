@@ -0,0 +1,215 @@
+package Repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"slack-tag-summariser/Models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type StoredDigest = Models.StoredDigest
+
+// SaveDigest stores the digest of the day, a re-run on the same day replaces it
+func SaveDigest(digest StoredDigest, dbPool *pgxpool.Pool) error {
+	if dbPool == nil {
+		return fmt.Errorf("database pool is not initialized")
+	}
+
+	var overview []byte
+	if digest.Overview != nil {
+		var jsonMarshallError error
+		if overview, jsonMarshallError = json.Marshal(digest.Overview); jsonMarshallError != nil {
+			return jsonMarshallError
+		}
+	}
+	responses, jsonMarshallError := json.Marshal(digest.Responses)
+	if jsonMarshallError != nil {
+		return jsonMarshallError
+	}
+	if digest.Batched == nil {
+		digest.Batched = []Models.GenAiResponse{}
+	}
+	batched, jsonMarshallError := json.Marshal(digest.Batched)
+	if jsonMarshallError != nil {
+		return jsonMarshallError
+	}
+	if digest.CarryOver == nil {
+		digest.CarryOver = []Models.CarryOverItem{}
+	}
+	carryOver, jsonMarshallError := json.Marshal(digest.CarryOver)
+	if jsonMarshallError != nil {
+		return jsonMarshallError
+	}
+
+	query := `
+		INSERT INTO digests (user_id, digest_date, language, overview, responses, hidden_count, batched, carry_over)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (user_id, digest_date) DO UPDATE
+		SET language = EXCLUDED.language, overview = EXCLUDED.overview, responses = EXCLUDED.responses,
+			hidden_count = EXCLUDED.hidden_count, batched = EXCLUDED.batched, carry_over = EXCLUDED.carry_over,
+			created_at = now()`
+
+	_, saveDigestError := dbPool.Exec(context.Background(), query,
+		digest.UserID,
+		digest.DigestDate,
+		digest.Language,
+		overview,
+		responses,
+		digest.HiddenCount,
+		batched,
+		carryOver,
+	)
+	return saveDigestError
+}
+
+// GetDigest returns the digest of the day, or the latest one when the date is empty, and false when there is none
+func GetDigest(userId string, digestDate string, dbPool *pgxpool.Pool) (StoredDigest, bool, error) {
+	digest := StoredDigest{UserID: userId}
+	if dbPool == nil {
+		return digest, false, fmt.Errorf("database pool is not initialized")
+	}
+
+	query := `
+		SELECT digest_date::TEXT, language, overview, responses, hidden_count, batched, carry_over, created_at FROM digests
+		WHERE user_id = $1 AND ($2 = '' OR digest_date::TEXT = $2)
+		ORDER BY digest_date DESC
+		LIMIT 1`
+
+	var overview, responses, batched, carryOver []byte
+	dbQueryError := dbPool.QueryRow(context.Background(), query, userId, digestDate).Scan(
+		&digest.DigestDate,
+		&digest.Language,
+		&overview,
+		&responses,
+		&digest.HiddenCount,
+		&batched,
+		&carryOver,
+		&digest.CreatedAt,
+	)
+	if errors.Is(dbQueryError, pgx.ErrNoRows) {
+		return digest, false, nil
+	}
+	if dbQueryError != nil {
+		return digest, false, dbQueryError
+	}
+
+	if overview != nil {
+		digest.Overview = &Models.DigestOverview{}
+		if jsonUnmarshallError := json.Unmarshal(overview, digest.Overview); jsonUnmarshallError != nil {
+			return digest, false, jsonUnmarshallError
+		}
+	}
+	if jsonUnmarshallError := json.Unmarshal(responses, &digest.Responses); jsonUnmarshallError != nil {
+		return digest, false, jsonUnmarshallError
+	}
+	if jsonUnmarshallError := json.Unmarshal(batched, &digest.Batched); jsonUnmarshallError != nil {
+		return digest, false, jsonUnmarshallError
+	}
+	if jsonUnmarshallError := json.Unmarshal(carryOver, &digest.CarryOver); jsonUnmarshallError != nil {
+		return digest, false, jsonUnmarshallError
+	}
+	return digest, true, nil
+}
+
+// GetDigestsBetween returns the digests of the user from the first day up to the day before the last,
+// oldest first, with the mentions they showed but without their overview
+func GetDigestsBetween(userId string, fromDate string, beforeDate string, dbPool *pgxpool.Pool) ([]StoredDigest, error) {
+	if dbPool == nil {
+		return nil, fmt.Errorf("database pool is not initialized")
+	}
+
+	query := `
+		SELECT digest_date::TEXT, language, responses, carry_over, created_at FROM digests
+		WHERE user_id = $1 AND digest_date >= $2::DATE AND digest_date < $3::DATE
+		ORDER BY digest_date`
+
+	rows, dbQueryError := dbPool.Query(context.Background(), query, userId, fromDate, beforeDate)
+	if dbQueryError != nil {
+		return nil, dbQueryError
+	}
+	defer rows.Close()
+
+	var digests []StoredDigest
+	for rows.Next() {
+		digest := StoredDigest{UserID: userId}
+		var responses, carryOver []byte
+		if scanError := rows.Scan(&digest.DigestDate, &digest.Language, &responses, &carryOver, &digest.CreatedAt); scanError != nil {
+			return nil, scanError
+		}
+		if jsonUnmarshallError := json.Unmarshal(responses, &digest.Responses); jsonUnmarshallError != nil {
+			return nil, jsonUnmarshallError
+		}
+		if jsonUnmarshallError := json.Unmarshal(carryOver, &digest.CarryOver); jsonUnmarshallError != nil {
+			return nil, jsonUnmarshallError
+		}
+		digests = append(digests, digest)
+	}
+	return digests, rows.Err()
+}
+
+// GetBatchedSince returns the mentions left out of the digests of the user from the day on, oldest
+// digest first, for the weekly digest
+func GetBatchedSince(userId string, fromDate string, dbPool *pgxpool.Pool) ([]Models.GenAiResponse, error) {
+	if dbPool == nil {
+		return nil, fmt.Errorf("database pool is not initialized")
+	}
+
+	query := `
+		SELECT batched FROM digests
+		WHERE user_id = $1 AND digest_date >= $2::DATE
+		ORDER BY digest_date`
+
+	rows, dbQueryError := dbPool.Query(context.Background(), query, userId, fromDate)
+	if dbQueryError != nil {
+		return nil, dbQueryError
+	}
+	defer rows.Close()
+
+	var batchedResponses []Models.GenAiResponse
+	for rows.Next() {
+		var batched []byte
+		if scanError := rows.Scan(&batched); scanError != nil {
+			return nil, scanError
+		}
+		var digestBatched []Models.GenAiResponse
+		if jsonUnmarshallError := json.Unmarshal(batched, &digestBatched); jsonUnmarshallError != nil {
+			return nil, jsonUnmarshallError
+		}
+		batchedResponses = append(batchedResponses, digestBatched...)
+	}
+	return batchedResponses, rows.Err()
+}
+
+// GetDigestDates returns the days the user got a digest, newest first
+func GetDigestDates(userId string, limit int, dbPool *pgxpool.Pool) ([]string, error) {
+	if dbPool == nil {
+		return nil, fmt.Errorf("database pool is not initialized")
+	}
+
+	query := `
+		SELECT digest_date::TEXT FROM digests
+		WHERE user_id = $1
+		ORDER BY digest_date DESC
+		LIMIT $2`
+
+	rows, dbQueryError := dbPool.Query(context.Background(), query, userId, limit)
+	if dbQueryError != nil {
+		return nil, dbQueryError
+	}
+	defer rows.Close()
+
+	var digestDates []string
+	for rows.Next() {
+		var digestDate string
+		if scanError := rows.Scan(&digestDate); scanError != nil {
+			return nil, scanError
+		}
+		digestDates = append(digestDates, digestDate)
+	}
+	return digestDates, rows.Err()
+}
@@ -0,0 +1,105 @@
+package Repo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"slack-tag-summariser/Models"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type LlmUsage = Models.LlmUsage
+type LlmUsageReportRow = Models.LlmUsageReportRow
+
+// the report can only be grouped by these columns, the value is put in the query as is
+var llmUsageReportColumns = map[string]string{
+	"user":      "user_id",
+	"run":       "run_id",
+	"workspace": "workspace_id",
+	"model":     "model",
+	"purpose":   "purpose",
+}
+
+func SaveLlmUsage(usage LlmUsage, dbPool *pgxpool.Pool) error {
+	if dbPool == nil {
+		return fmt.Errorf("database pool is not initialized")
+	}
+
+	conversationKeys := usage.ConversationKeys
+	if conversationKeys == nil {
+		conversationKeys = []string{}
+	}
+
+	query := `
+		INSERT INTO llm_usage (run_id, workspace_id, user_id, conversation_keys, purpose, model,
+			prompt_tokens, candidate_tokens, total_tokens, latency_ms, cost_usd)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+
+	_, dbInsertError := dbPool.Exec(context.Background(), query,
+		usage.RunId,
+		usage.WorkspaceId,
+		usage.UserId,
+		conversationKeys,
+		usage.Purpose,
+		usage.Model,
+		usage.PromptTokens,
+		usage.CandidateTokens,
+		usage.TotalTokens,
+		usage.Latency.Milliseconds(),
+		usage.CostUsd,
+	)
+	return dbInsertError
+}
+
+// GetWorkspaceCostSince sums the cost of every LLM call made for the workspace since the given time
+func GetWorkspaceCostSince(workspaceId string, since time.Time, dbPool *pgxpool.Pool) (float64, error) {
+	if dbPool == nil {
+		return 0, fmt.Errorf("database pool is not initialized")
+	}
+
+	query := `
+		SELECT COALESCE(SUM(cost_usd), 0) FROM llm_usage
+		WHERE workspace_id = $1 AND created_at >= $2`
+
+	var costUsd float64
+	dbQueryError := dbPool.QueryRow(context.Background(), query, workspaceId, since).Scan(&costUsd)
+	return costUsd, dbQueryError
+}
+
+// GetLlmUsageReport totals the LLM calls made between from and to, grouped by one of
+// user, run, workspace, model or purpose and ordered by cost
+func GetLlmUsageReport(groupBy string, from time.Time, to time.Time, dbPool *pgxpool.Pool) ([]LlmUsageReportRow, error) {
+	if dbPool == nil {
+		return nil, fmt.Errorf("database pool is not initialized")
+	}
+
+	column, isValidGroup := llmUsageReportColumns[groupBy]
+	if !isValidGroup {
+		return nil, fmt.Errorf("unknown report grouping %q", groupBy)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s, COUNT(*), SUM(prompt_tokens), SUM(candidate_tokens), SUM(total_tokens), SUM(cost_usd), AVG(latency_ms)
+		FROM llm_usage
+		WHERE created_at >= $1 AND created_at < $2
+		GROUP BY %s
+		ORDER BY SUM(cost_usd) DESC`, column, column)
+
+	rows, dbQueryError := dbPool.Query(context.Background(), query, from, to)
+	if dbQueryError != nil {
+		return nil, dbQueryError
+	}
+	defer rows.Close()
+
+	var reportRows []LlmUsageReportRow
+	for rows.Next() {
+		var row LlmUsageReportRow
+		if scanError := rows.Scan(&row.Key, &row.Calls, &row.PromptTokens, &row.CandidateTokens, &row.TotalTokens, &row.CostUsd, &row.AvgLatencyMs); scanError != nil {
+			return nil, scanError
+		}
+		reportRows = append(reportRows, row)
+	}
+	return reportRows, rows.Err()
+}
@@ -0,0 +1,98 @@
+package Repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"slack-tag-summariser/Models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type GenAiResponse = Models.GenAiResponse
+type SummaryCacheEntry = Models.SummaryCacheEntry
+
+func GetCachedSummary(cacheKey string, dbPool *pgxpool.Pool) (GenAiResponse, bool, error) {
+	var cachedSummary GenAiResponse
+
+	if dbPool == nil {
+		return cachedSummary, false, fmt.Errorf("database pool is not initialized")
+	}
+
+	query := `
+		SELECT response FROM summary_cache
+		WHERE cache_key = $1 AND expires_at > now()`
+
+	var response []byte
+	dbQueryError := dbPool.QueryRow(context.Background(), query, cacheKey).Scan(&response)
+	if errors.Is(dbQueryError, pgx.ErrNoRows) {
+		return cachedSummary, false, nil
+	}
+	if dbQueryError != nil {
+		return cachedSummary, false, dbQueryError
+	}
+
+	if jsonUnmarshallError := json.Unmarshal(response, &cachedSummary); jsonUnmarshallError != nil {
+		return cachedSummary, false, jsonUnmarshallError
+	}
+	return cachedSummary, true, nil
+}
+
+// SaveCachedSummary stores the summary and invalidates any older summary of the same mention,
+// an older entry for the mention means the thread content has changed since it was cached
+func SaveCachedSummary(entry SummaryCacheEntry, ttl time.Duration, dbPool *pgxpool.Pool) error {
+	if dbPool == nil {
+		return fmt.Errorf("database pool is not initialized")
+	}
+
+	response, jsonMarshallError := json.Marshal(entry.Response)
+	if jsonMarshallError != nil {
+		return jsonMarshallError
+	}
+
+	ctx := context.Background()
+	tx, txBeginError := dbPool.Begin(ctx)
+	if txBeginError != nil {
+		return txBeginError
+	}
+	// rollback is a no-op once the transaction is committed
+	defer tx.Rollback(ctx)
+
+	invalidateQuery := `
+		DELETE FROM summary_cache
+		WHERE user_id = $1 AND channel_id = $2 AND thread_ts = $3 AND mention_ts = $4 AND cache_key <> $5`
+
+	if _, invalidateError := tx.Exec(ctx, invalidateQuery, entry.UserID, entry.ChannelId, entry.ThreadTimestamp, entry.MentionTimestamp, entry.CacheKey); invalidateError != nil {
+		return invalidateError
+	}
+
+	upsertQuery := `
+		INSERT INTO summary_cache (cache_key, user_id, channel_id, thread_ts, mention_ts, model, response, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (cache_key) DO UPDATE
+		SET model = EXCLUDED.model, response = EXCLUDED.response, created_at = now(), expires_at = EXCLUDED.expires_at`
+
+	_, upsertError := tx.Exec(ctx, upsertQuery,
+		entry.CacheKey, entry.UserID, entry.ChannelId, entry.ThreadTimestamp, entry.MentionTimestamp, entry.Model, response, time.Now().Add(ttl))
+	if upsertError != nil {
+		return upsertError
+	}
+
+	return tx.Commit(ctx)
+}
+
+func DeleteExpiredSummaries(dbPool *pgxpool.Pool) (int64, error) {
+	if dbPool == nil {
+		return 0, fmt.Errorf("database pool is not initialized")
+	}
+
+	commandTag, deleteError := dbPool.Exec(context.Background(), `DELETE FROM summary_cache WHERE expires_at <= now()`)
+	if deleteError != nil {
+		return 0, deleteError
+	}
+	return commandTag.RowsAffected(), nil
+}
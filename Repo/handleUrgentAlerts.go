@@ -0,0 +1,103 @@
+package Repo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"slack-tag-summariser/Models"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type UrgentAlert = Models.UrgentAlert
+
+// SaveUrgentAlert records a mention that was sent on its own so the next checks do not send it again
+func SaveUrgentAlert(alert UrgentAlert, dbPool *pgxpool.Pool) error {
+	if dbPool == nil {
+		return fmt.Errorf("database pool is not initialized")
+	}
+
+	query := `
+		INSERT INTO urgent_alerts (user_id, channel_id, mention_ts, message_ts)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, channel_id, mention_ts) DO NOTHING`
+
+	_, saveAlertError := dbPool.Exec(context.Background(), query,
+		alert.UserID,
+		alert.ChannelId,
+		alert.MentionTimestamp,
+		alert.MessageTimestamp,
+	)
+	return saveAlertError
+}
+
+// GetUrgentAlertsSince returns the alerts sent to the user after the time, keyed by channel:mention_ts
+func GetUrgentAlertsSince(userId string, since time.Time, dbPool *pgxpool.Pool) (map[string]UrgentAlert, error) {
+	if dbPool == nil {
+		return nil, fmt.Errorf("database pool is not initialized")
+	}
+
+	query := `
+		SELECT channel_id, mention_ts, message_ts, sent_at FROM urgent_alerts
+		WHERE user_id = $1 AND sent_at >= $2`
+
+	rows, dbQueryError := dbPool.Query(context.Background(), query, userId, since)
+	if dbQueryError != nil {
+		return nil, dbQueryError
+	}
+	defer rows.Close()
+
+	alerts := make(map[string]UrgentAlert)
+	for rows.Next() {
+		alert := UrgentAlert{UserID: userId}
+		if scanError := rows.Scan(&alert.ChannelId, &alert.MentionTimestamp, &alert.MessageTimestamp, &alert.SentAt); scanError != nil {
+			return nil, scanError
+		}
+		alerts[alert.ChannelId+":"+alert.MentionTimestamp] = alert
+	}
+	return alerts, rows.Err()
+}
+
+// SaveUrgentCheck records a mention that an urgent check summarised, so the next checks move on to
+// the mentions it did not get to
+func SaveUrgentCheck(userId string, channelId string, mentionTimestamp string, dbPool *pgxpool.Pool) error {
+	if dbPool == nil {
+		return fmt.Errorf("database pool is not initialized")
+	}
+
+	query := `
+		INSERT INTO urgent_checks (user_id, channel_id, mention_ts)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, channel_id, mention_ts) DO UPDATE SET checked_at = now()`
+
+	_, saveCheckError := dbPool.Exec(context.Background(), query, userId, channelId, mentionTimestamp)
+	return saveCheckError
+}
+
+// GetUrgentChecksSince returns the mentions of the user checked after the time, keyed by channel:mention_ts
+func GetUrgentChecksSince(userId string, since time.Time, dbPool *pgxpool.Pool) (map[string]struct{}, error) {
+	if dbPool == nil {
+		return nil, fmt.Errorf("database pool is not initialized")
+	}
+
+	query := `
+		SELECT channel_id, mention_ts FROM urgent_checks
+		WHERE user_id = $1 AND checked_at >= $2`
+
+	rows, dbQueryError := dbPool.Query(context.Background(), query, userId, since)
+	if dbQueryError != nil {
+		return nil, dbQueryError
+	}
+	defer rows.Close()
+
+	checkedMentions := make(map[string]struct{})
+	for rows.Next() {
+		var channelId, mentionTimestamp string
+		if scanError := rows.Scan(&channelId, &mentionTimestamp); scanError != nil {
+			return nil, scanError
+		}
+		checkedMentions[channelId+":"+mentionTimestamp] = struct{}{}
+	}
+	return checkedMentions, rows.Err()
+}
@@ -0,0 +1,163 @@
+package Repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"slack-tag-summariser/Models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type UserPreferences = Models.UserPreferences
+
+// GetUserPreferences returns the defaults when the user never changed anything
+func GetUserPreferences(userId string, dbPool *pgxpool.Pool) (UserPreferences, error) {
+	userPreferences := UserPreferences{UserID: userId}
+
+	if dbPool == nil {
+		return userPreferences, fmt.Errorf("database pool is not initialized")
+	}
+
+	query := `
+		SELECT language, custom_instructions, group_by_category, category_filter, empty_digest_policy, delivery_targets, priority_routes FROM user_preferences WHERE user_id = $1`
+
+	dbQueryError := dbPool.QueryRow(context.Background(), query, userId).Scan(
+		&userPreferences.Language,
+		&userPreferences.CustomInstructions,
+		&userPreferences.GroupByCategory,
+		&userPreferences.CategoryFilter,
+		&userPreferences.EmptyDigestPolicy,
+		&userPreferences.DeliveryTargets,
+		&userPreferences.PriorityRoutes,
+	)
+	if errors.Is(dbQueryError, pgx.ErrNoRows) {
+		return userPreferences, nil
+	}
+	if dbQueryError != nil {
+		return userPreferences, dbQueryError
+	}
+
+	return userPreferences, nil
+}
+
+func SaveUserLanguage(userId string, language string, dbPool *pgxpool.Pool) error {
+	if dbPool == nil {
+		return fmt.Errorf("database pool is not initialized")
+	}
+
+	query := `
+		INSERT INTO user_preferences (user_id, language)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET language = EXCLUDED.language, updated_at = now()`
+
+	_, saveLanguageError := dbPool.Exec(context.Background(), query, userId, language)
+	return saveLanguageError
+}
+
+// SaveUserCustomInstructions expects instructions that were already validated, empty clears them
+func SaveUserCustomInstructions(userId string, customInstructions string, dbPool *pgxpool.Pool) error {
+	if dbPool == nil {
+		return fmt.Errorf("database pool is not initialized")
+	}
+
+	query := `
+		INSERT INTO user_preferences (user_id, custom_instructions)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET custom_instructions = EXCLUDED.custom_instructions, updated_at = now()`
+
+	_, saveCustomInstructionsError := dbPool.Exec(context.Background(), query, userId, customInstructions)
+	return saveCustomInstructionsError
+}
+
+func SaveUserGroupByCategory(userId string, groupByCategory bool, dbPool *pgxpool.Pool) error {
+	if dbPool == nil {
+		return fmt.Errorf("database pool is not initialized")
+	}
+
+	query := `
+		INSERT INTO user_preferences (user_id, group_by_category)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET group_by_category = EXCLUDED.group_by_category, updated_at = now()`
+
+	_, saveGroupByCategoryError := dbPool.Exec(context.Background(), query, userId, groupByCategory)
+	return saveGroupByCategoryError
+}
+
+// SaveUserCategoryFilter expects known categories only, an empty filter shows every category
+func SaveUserCategoryFilter(userId string, categoryFilter []string, dbPool *pgxpool.Pool) error {
+	if dbPool == nil {
+		return fmt.Errorf("database pool is not initialized")
+	}
+	if categoryFilter == nil {
+		categoryFilter = []string{}
+	}
+
+	query := `
+		INSERT INTO user_preferences (user_id, category_filter)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET category_filter = EXCLUDED.category_filter, updated_at = now()`
+
+	_, saveCategoryFilterError := dbPool.Exec(context.Background(), query, userId, categoryFilter)
+	return saveCategoryFilterError
+}
+
+// SaveUserEmptyDigestPolicy expects one of Models.EmptyDigestPolicies
+func SaveUserEmptyDigestPolicy(userId string, emptyDigestPolicy string, dbPool *pgxpool.Pool) error {
+	if dbPool == nil {
+		return fmt.Errorf("database pool is not initialized")
+	}
+
+	query := `
+		INSERT INTO user_preferences (user_id, empty_digest_policy)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET empty_digest_policy = EXCLUDED.empty_digest_policy, updated_at = now()`
+
+	_, saveEmptyDigestPolicyError := dbPool.Exec(context.Background(), query, userId, emptyDigestPolicy)
+	return saveEmptyDigestPolicyError
+}
+
+// SaveUserDeliveryTargets expects targets that were already validated, empty delivers to the slack DM only
+func SaveUserDeliveryTargets(userId string, deliveryTargets []string, dbPool *pgxpool.Pool) error {
+	if dbPool == nil {
+		return fmt.Errorf("database pool is not initialized")
+	}
+	if deliveryTargets == nil {
+		deliveryTargets = []string{}
+	}
+
+	query := `
+		INSERT INTO user_preferences (user_id, delivery_targets)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET delivery_targets = EXCLUDED.delivery_targets, updated_at = now()`
+
+	_, saveDeliveryTargetsError := dbPool.Exec(context.Background(), query, userId, deliveryTargets)
+	return saveDeliveryTargetsError
+}
+
+// SavePriorityRoutes expects routes that were already validated, empty uses the default route of every priority
+func SavePriorityRoutes(userId string, priorityRoutes []string, dbPool *pgxpool.Pool) error {
+	if dbPool == nil {
+		return fmt.Errorf("database pool is not initialized")
+	}
+	if priorityRoutes == nil {
+		priorityRoutes = []string{}
+	}
+
+	query := `
+		INSERT INTO user_preferences (user_id, priority_routes)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET priority_routes = EXCLUDED.priority_routes, updated_at = now()`
+
+	_, savePriorityRoutesError := dbPool.Exec(context.Background(), query, userId, priorityRoutes)
+	return savePriorityRoutesError
+}
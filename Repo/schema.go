@@ -0,0 +1,146 @@
+package Repo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// schemaStatements are applied in order on startup, so every statement has to be idempotent
+var schemaStatements = []string{
+	`CREATE TABLE IF NOT EXISTS users (
+		user_id      TEXT PRIMARY KEY,
+		access_token TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS summary_cache (
+		cache_key  TEXT PRIMARY KEY,
+		user_id    TEXT NOT NULL,
+		channel_id TEXT NOT NULL,
+		thread_ts  TEXT NOT NULL,
+		model      TEXT NOT NULL,
+		response   JSONB NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		expires_at TIMESTAMPTZ NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS summary_cache_thread_idx ON summary_cache (user_id, channel_id, thread_ts)`,
+	`CREATE TABLE IF NOT EXISTS user_preferences (
+		user_id    TEXT PRIMARY KEY,
+		language   TEXT NOT NULL DEFAULT '',
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	`ALTER TABLE user_preferences ADD COLUMN IF NOT EXISTS custom_instructions TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE user_preferences ADD COLUMN IF NOT EXISTS group_by_category BOOLEAN NOT NULL DEFAULT false`,
+	`ALTER TABLE user_preferences ADD COLUMN IF NOT EXISTS category_filter TEXT[] NOT NULL DEFAULT '{}'`,
+	`CREATE TABLE IF NOT EXISTS llm_usage (
+		id                BIGSERIAL PRIMARY KEY,
+		run_id            TEXT NOT NULL,
+		workspace_id      TEXT NOT NULL,
+		user_id           TEXT NOT NULL,
+		conversation_keys TEXT[] NOT NULL DEFAULT '{}',
+		purpose           TEXT NOT NULL,
+		model             TEXT NOT NULL,
+		prompt_tokens     INTEGER NOT NULL,
+		candidate_tokens  INTEGER NOT NULL,
+		total_tokens      INTEGER NOT NULL,
+		latency_ms        INTEGER NOT NULL,
+		cost_usd          DOUBLE PRECISION NOT NULL,
+		created_at        TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	`CREATE INDEX IF NOT EXISTS llm_usage_workspace_idx ON llm_usage (workspace_id, created_at)`,
+	`CREATE INDEX IF NOT EXISTS llm_usage_run_idx ON llm_usage (run_id)`,
+	`CREATE TABLE IF NOT EXISTS digest_deliveries (
+		user_id     TEXT NOT NULL,
+		digest_date DATE NOT NULL,
+		part_index  INTEGER NOT NULL,
+		channel_id  TEXT NOT NULL,
+		message_ts  TEXT NOT NULL,
+		created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+		PRIMARY KEY (user_id, digest_date, part_index)
+	)`,
+	`CREATE TABLE IF NOT EXISTS digest_items (
+		user_id           TEXT NOT NULL,
+		channel_id        TEXT NOT NULL,
+		mention_ts        TEXT NOT NULL,
+		mention_permalink TEXT NOT NULL DEFAULT '',
+		mention_user_id   TEXT NOT NULL DEFAULT '',
+		state             TEXT NOT NULL DEFAULT 'open',
+		snoozed_until     TIMESTAMPTZ,
+		created_at        TIMESTAMPTZ NOT NULL DEFAULT now(),
+		updated_at        TIMESTAMPTZ NOT NULL DEFAULT now(),
+		PRIMARY KEY (user_id, channel_id, mention_ts)
+	)`,
+	`CREATE INDEX IF NOT EXISTS digest_items_state_idx ON digest_items (user_id, state)`,
+	`ALTER TABLE user_preferences ADD COLUMN IF NOT EXISTS empty_digest_policy TEXT NOT NULL DEFAULT ''`,
+	`CREATE TABLE IF NOT EXISTS digest_runs (
+		id            BIGSERIAL PRIMARY KEY,
+		run_id        TEXT NOT NULL,
+		user_id       TEXT NOT NULL,
+		digest_date   DATE NOT NULL,
+		outcome       TEXT NOT NULL,
+		detail        TEXT NOT NULL DEFAULT '',
+		mention_count INTEGER NOT NULL DEFAULT 0,
+		created_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	`CREATE INDEX IF NOT EXISTS digest_runs_date_idx ON digest_runs (digest_date, outcome)`,
+	`CREATE INDEX IF NOT EXISTS digest_runs_user_idx ON digest_runs (user_id, created_at)`,
+	`ALTER TABLE user_preferences ADD COLUMN IF NOT EXISTS delivery_targets TEXT[] NOT NULL DEFAULT '{}'`,
+	// the parts of a digest are recorded per slack target once a digest can go to a channel as well as the DM
+	`ALTER TABLE digest_deliveries ADD COLUMN IF NOT EXISTS target TEXT NOT NULL DEFAULT 'slack_dm'`,
+	`ALTER TABLE digest_deliveries DROP CONSTRAINT IF EXISTS digest_deliveries_pkey`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS digest_deliveries_target_idx ON digest_deliveries (user_id, digest_date, target, part_index)`,
+	`CREATE TABLE IF NOT EXISTS digest_publications (
+		user_id     TEXT NOT NULL,
+		digest_date DATE NOT NULL,
+		target      TEXT NOT NULL,
+		status      TEXT NOT NULL,
+		error       TEXT NOT NULL DEFAULT '',
+		created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+		updated_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+		PRIMARY KEY (user_id, digest_date, target)
+	)`,
+	`CREATE TABLE IF NOT EXISTS digests (
+		user_id      TEXT NOT NULL,
+		digest_date  DATE NOT NULL,
+		language     TEXT NOT NULL,
+		overview     JSONB,
+		responses    JSONB NOT NULL,
+		hidden_count INTEGER NOT NULL DEFAULT 0,
+		created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+		PRIMARY KEY (user_id, digest_date)
+	)`,
+	`ALTER TABLE digest_deliveries ADD COLUMN IF NOT EXISTS content_hash TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE user_preferences ADD COLUMN IF NOT EXISTS priority_routes TEXT[] NOT NULL DEFAULT '{}'`,
+	`ALTER TABLE digests ADD COLUMN IF NOT EXISTS batched JSONB NOT NULL DEFAULT '[]'`,
+	`CREATE TABLE IF NOT EXISTS urgent_alerts (
+		user_id    TEXT NOT NULL,
+		channel_id TEXT NOT NULL,
+		mention_ts TEXT NOT NULL,
+		message_ts TEXT NOT NULL DEFAULT '',
+		sent_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+		PRIMARY KEY (user_id, channel_id, mention_ts)
+	)`,
+	`ALTER TABLE digests ADD COLUMN IF NOT EXISTS carry_over JSONB NOT NULL DEFAULT '[]'`,
+	`ALTER TABLE summary_cache ADD COLUMN IF NOT EXISTS mention_ts TEXT NOT NULL DEFAULT ''`,
+	`CREATE INDEX IF NOT EXISTS summary_cache_mention_idx ON summary_cache (user_id, channel_id, thread_ts, mention_ts)`,
+	`CREATE TABLE IF NOT EXISTS urgent_checks (
+		user_id    TEXT NOT NULL,
+		channel_id TEXT NOT NULL,
+		mention_ts TEXT NOT NULL,
+		checked_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		PRIMARY KEY (user_id, channel_id, mention_ts)
+	)`,
+}
+
+func InitDbSchema(dbPool *pgxpool.Pool) error {
+	if dbPool == nil {
+		return fmt.Errorf("database pool is not initialized")
+	}
+
+	for _, statement := range schemaStatements {
+		if _, schemaError := dbPool.Exec(context.Background(), statement); schemaError != nil {
+			return schemaError
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package SummarizeConversations
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"slack-tag-summariser/Models"
+)
+
+type ActionItem = Models.ActionItem
+
+// used when the model does not say how sure it is
+const defaultActionItemConfidence = 0.5
+
+var slackUserIdRegex = regexp.MustCompile(`U[A-Z0-9]{6,}`)
+
+// extractSlackUserId accepts "<@U123>", "@U123" or "U123" and returns "U123"
+func extractSlackUserId(text string) string {
+	return slackUserIdRegex.FindString(text)
+}
+
+// buildMessagePermalink points the permalink of the mention at another message of the same thread
+func buildMessagePermalink(conversationContext ConversationResponseEntry, messageTimestamp string) string {
+	parsedUrl, urlParseError := url.Parse(conversationContext.MentionPermalink)
+	if urlParseError != nil || messageTimestamp == "" {
+		return conversationContext.MentionPermalink
+	}
+
+	// slack permalinks end with p + the message ts without the dot
+	parsedUrl.Path = path.Join(path.Dir(parsedUrl.Path), "p"+strings.Replace(messageTimestamp, ".", "", 1))
+
+	query := url.Values{}
+	if conversationContext.ThreadTimestamp != "" && conversationContext.ThreadTimestamp != messageTimestamp {
+		query.Set("thread_ts", conversationContext.ThreadTimestamp)
+		query.Set("cid", conversationContext.MentionChannelId)
+	}
+	parsedUrl.RawQuery = query.Encode()
+
+	return parsedUrl.String()
+}
+
+func isThreadMessageTimestamp(conversationContext ConversationResponseEntry, messageTimestamp string) bool {
+	for _, msg := range conversationContext.Messages {
+		if msg.Timestamp == messageTimestamp {
+			return true
+		}
+	}
+	return false
+}
+
+// parseActionItem turns a single entry of "action_required" into an ActionItem,
+// plain strings from older prompt versions are still accepted as a description
+func parseActionItem(rawItem interface{}, conversationContext ConversationResponseEntry) (ActionItem, bool) {
+	var item ActionItem
+
+	switch value := rawItem.(type) {
+	case string:
+		item.Description = value
+		item.Confidence = defaultActionItemConfidence
+	case map[string]interface{}:
+		item.Description, _ = value["description"].(string)
+		owner, _ := value["owner"].(string)
+		requester, _ := value["requester"].(string)
+		item.OwnerUserId = extractSlackUserId(owner)
+		item.RequesterUserId = extractSlackUserId(requester)
+		item.DueText, _ = value["due"].(string)
+		item.SourceMessageTimestamp, _ = value["source_message_ts"].(string)
+
+		confidence, hasConfidence := value["confidence"].(float64)
+		if !hasConfidence {
+			confidence = defaultActionItemConfidence
+		}
+		item.Confidence = min(max(confidence, 0), 1)
+	default:
+		return item, false
+	}
+
+	item.Description = strings.TrimSpace(item.Description)
+	if item.Description == "" {
+		return item, false
+	}
+
+	// the model can only point at messages that are really in the thread
+	if !isThreadMessageTimestamp(conversationContext, item.SourceMessageTimestamp) {
+		item.SourceMessageTimestamp = conversationContext.MentionTimestamp
+	}
+	item.SourcePermalink = buildMessagePermalink(conversationContext, item.SourceMessageTimestamp)
+
+	// deadlines are relative to when they were written, not to when the digest runs
+	if item.DueText != "" {
+		if reference, ok := parseSlackTimestamp(item.SourceMessageTimestamp); ok {
+			if dueDate, parsed := parseDueDate(item.DueText, reference.In(GetDigestLocation())); parsed {
+				item.DueDate = &dueDate
+			}
+		}
+	}
+
+	return item, true
+}
@@ -0,0 +1,36 @@
+package SummarizeConversations
+
+import (
+	"regexp"
+	"strings"
+)
+
+// phrases that turn a mention into a request instead of a cc
+var directAskRegex = regexp.MustCompile(`(?i)\b(can you|could you|would you|will you|can u|pls|please|need you|your (input|review|approval)|thoughts)\b`)
+
+var passiveMentionRegex = regexp.MustCompile(`(?i)(^|\s)(cc|fyi|//)\b`)
+
+// isAskedDirectly checks the mention text itself, the LLM priority is not involved so it can
+// be used as an independent ranking signal
+func isAskedDirectly(mentionText string, userId string) bool {
+	if userId == "" || !strings.Contains(mentionText, "<@"+userId) {
+		return false
+	}
+
+	// "cc <@U123>" and friends are informational unless the message also asks something
+	isPassive := passiveMentionRegex.MatchString(mentionText)
+	isAsking := strings.Contains(mentionText, "?") || directAskRegex.MatchString(mentionText)
+
+	return isAsking && !(isPassive && !strings.Contains(mentionText, "?"))
+}
+
+// applyConversationMetadata copies the fields that come from slack rather than from the LLM
+func applyConversationMetadata(s *GenAiResponse, conversationContext ConversationResponseEntry, userId string) {
+	s.MentionPermalink = conversationContext.MentionPermalink
+	s.MentionChannelId = conversationContext.MentionChannelId
+	s.MentionTimestamp = conversationContext.MentionTimestamp
+	s.MentionUserId = conversationContext.MentionUserId
+	s.AskedDirectly = isAskedDirectly(conversationContext.MentionText, userId)
+	s.InjectionReasons = detectPromptInjection(conversationContext)
+	s.InjectionSuspected = len(s.InjectionReasons) > 0
+}
@@ -0,0 +1,64 @@
+package SummarizeConversations
+
+import (
+	"slices"
+	"strings"
+
+	"slack-tag-summariser/Models"
+)
+
+const (
+	maxTags      = 3
+	maxTagLength = 30
+)
+
+// NormaliseCategory accepts the category in any case and with spaces or dashes instead of
+// underscores, anything that is not one of the known categories comes back empty
+func NormaliseCategory(category string) string {
+	category = strings.ToLower(strings.TrimSpace(category))
+	category = strings.NewReplacer(" ", "_", "-", "_").Replace(category)
+	if slices.Contains(Models.SummaryCategories, category) {
+		return category
+	}
+	return ""
+}
+
+// parseTags keeps at most maxTags distinct non empty tags, lower cased and without hashtags
+func parseTags(rawTags interface{}) []string {
+	tagValues, ok := rawTags.([]interface{})
+	if !ok {
+		return nil
+	}
+
+	var tags []string
+	for _, tagValue := range tagValues {
+		tag, isString := tagValue.(string)
+		if !isString {
+			continue
+		}
+		tag = strings.ToLower(strings.Join(strings.Fields(strings.TrimLeft(tag, "# ")), " "))
+		if tag == "" || len(tag) > maxTagLength || slices.Contains(tags, tag) {
+			continue
+		}
+		tags = append(tags, tag)
+		if len(tags) == maxTags {
+			break
+		}
+	}
+	return tags
+}
+
+// FilterByCategory keeps the responses whose category is in the filter, an empty filter keeps all of them
+func FilterByCategory(responses []GenAiResponse, categoryFilter []string) (kept []GenAiResponse, hiddenCount int) {
+	if len(categoryFilter) == 0 {
+		return responses, 0
+	}
+	for _, r := range responses {
+		if slices.Contains(categoryFilter, r.Category) {
+			kept = append(kept, r)
+			continue
+		}
+		hiddenCount++
+	}
+	return kept, hiddenCount
+}
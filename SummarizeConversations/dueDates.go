@@ -0,0 +1,216 @@
+package SummarizeConversations
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// deadlines without an explicit time resolve to the end of the business day
+const endOfBusinessHour = 17
+
+var (
+	isoDateRegex      = regexp.MustCompile(`\b(\d{4})-(\d{2})-(\d{2})\b`)
+	monthDayRegex     = regexp.MustCompile(`\b(january|february|march|april|may|june|july|august|september|october|november|december|jan|feb|mar|apr|jun|jul|aug|sept|sep|oct|nov|dec)\.?\s+(\d{1,2})(?:st|nd|rd|th)?\b`)
+	dayMonthRegex     = regexp.MustCompile(`\b(\d{1,2})(?:st|nd|rd|th)?\s+(january|february|march|april|may|june|july|august|september|october|november|december|jan|feb|mar|apr|jun|jul|aug|sept|sep|oct|nov|dec)\b`)
+	relativeRegex     = regexp.MustCompile(`\bin\s+(\d+|a|an|one|two|three)\s+(hour|day|week)s?\b`)
+	clockTimeRegex    = regexp.MustCompile(`\b(\d{1,2})(?::(\d{2}))?\s*(am|pm)\b|\b(\d{1,2}):(\d{2})\b`)
+	weekdayRegex      = regexp.MustCompile(`\b(next\s+)?(monday|tuesday|wednesday|thursday|friday|saturday|sunday|mon|tues|tue|wed|thurs|thu|fri|sat|sun)\b`)
+	endOfWeekRegex    = regexp.MustCompile(`\b(eow|end of (the )?week|this week)\b`)
+	endOfMonthRegex   = regexp.MustCompile(`\b(eom|end of (the )?month)\b`)
+	nextWeekRegex     = regexp.MustCompile(`\bnext week\b`)
+	tomorrowRegex     = regexp.MustCompile(`\b(tomorrow|tmrw|tmr)\b`)
+	todayRegex        = regexp.MustCompile(`\b(today|tonight|eod|cob|end of (the )?day|asap)\b`)
+	relativeAmountMap = map[string]int{"a": 1, "an": 1, "one": 1, "two": 2, "three": 3}
+)
+
+var monthsByPrefix = map[string]time.Month{
+	"jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April,
+	"may": time.May, "jun": time.June, "jul": time.July, "aug": time.August,
+	"sep": time.September, "oct": time.October, "nov": time.November, "dec": time.December,
+}
+
+var weekdaysByPrefix = map[string]time.Weekday{
+	"mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday, "thu": time.Thursday,
+	"fri": time.Friday, "sat": time.Saturday, "sun": time.Sunday,
+}
+
+// DIGEST_TIMEZONE is used to interpret phrases like "EOD" and to date the digest, defaults to UTC
+func GetDigestLocation() *time.Location {
+	location, loadLocationError := time.LoadLocation(getEnvOrDefault("DIGEST_TIMEZONE", "UTC"))
+	if loadLocationError != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// parseSlackTimestamp converts a slack ts like "1712345678.123456" to a time
+func parseSlackTimestamp(slackTimestamp string) (time.Time, bool) {
+	seconds, _, _ := strings.Cut(slackTimestamp, ".")
+	unixSeconds, parseError := strconv.ParseInt(seconds, 10, 64)
+	if parseError != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(unixSeconds, 0), true
+}
+
+func atEndOfBusiness(day time.Time) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), endOfBusinessHour, 0, 0, 0, day.Location())
+}
+
+// the first given weekday strictly after the reference day
+func upcomingWeekday(reference time.Time, weekday time.Weekday) time.Time {
+	daysAhead := (int(weekday) - int(reference.Weekday()) + 7) % 7
+	if daysAhead == 0 {
+		daysAhead = 7
+	}
+	return reference.AddDate(0, 0, daysAhead)
+}
+
+// days since monday, so that the week runs monday to sunday
+func daysSinceMonday(day time.Time) int {
+	return (int(day.Weekday()) + 6) % 7
+}
+
+// applyClockTime moves the deadline to the time of day mentioned in the phrase, if any
+func applyClockTime(phrase string, day time.Time) time.Time {
+	match := clockTimeRegex.FindStringSubmatch(phrase)
+	if match == nil {
+		return day
+	}
+
+	var hour, minute int
+	if match[1] != "" {
+		hour, _ = strconv.Atoi(match[1])
+		minute, _ = strconv.Atoi(match[2])
+		if match[3] == "pm" && hour < 12 {
+			hour += 12
+		}
+		if match[3] == "am" && hour == 12 {
+			hour = 0
+		}
+	} else {
+		hour, _ = strconv.Atoi(match[4])
+		minute, _ = strconv.Atoi(match[5])
+	}
+
+	if hour > 23 || minute > 59 {
+		return day
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, day.Location())
+}
+
+// nearest future occurrence of the month and day, relative to the reference
+func resolveMonthDay(reference time.Time, month time.Month, day int) (time.Time, bool) {
+	if day < 1 || day > 31 {
+		return time.Time{}, false
+	}
+	candidate := time.Date(reference.Year(), month, day, 0, 0, 0, 0, reference.Location())
+	if candidate.Before(atStartOfDay(reference)) {
+		candidate = candidate.AddDate(1, 0, 0)
+	}
+	return candidate, true
+}
+
+func atStartOfDay(day time.Time) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+}
+
+// parseDueDate resolves phrases like "by EOD Friday", "tomorrow 3pm" or "2024-05-03"
+// relative to the time the phrase was written
+func parseDueDate(phrase string, reference time.Time) (time.Time, bool) {
+	phrase = strings.ToLower(strings.TrimSpace(phrase))
+	if phrase == "" {
+		return time.Time{}, false
+	}
+
+	var dueDay time.Time
+	found := true
+
+	switch {
+	case isoDateRegex.MatchString(phrase):
+		match := isoDateRegex.FindStringSubmatch(phrase)
+		year, _ := strconv.Atoi(match[1])
+		month, _ := strconv.Atoi(match[2])
+		day, _ := strconv.Atoi(match[3])
+		if month < 1 || month > 12 || day < 1 || day > 31 {
+			return time.Time{}, false
+		}
+		dueDay = time.Date(year, time.Month(month), day, 0, 0, 0, 0, reference.Location())
+
+	case monthDayRegex.MatchString(phrase):
+		match := monthDayRegex.FindStringSubmatch(phrase)
+		day, _ := strconv.Atoi(match[2])
+		dueDay, found = resolveMonthDay(reference, monthsByPrefix[match[1][:3]], day)
+
+	case dayMonthRegex.MatchString(phrase):
+		match := dayMonthRegex.FindStringSubmatch(phrase)
+		day, _ := strconv.Atoi(match[1])
+		dueDay, found = resolveMonthDay(reference, monthsByPrefix[match[2][:3]], day)
+
+	case relativeRegex.MatchString(phrase):
+		match := relativeRegex.FindStringSubmatch(phrase)
+		amount, isNumber := relativeAmountMap[match[1]]
+		if !isNumber {
+			amount, _ = strconv.Atoi(match[1])
+		}
+		switch match[2] {
+		case "hour":
+			// an exact offset, not moved to the end of the day
+			return reference.Add(time.Duration(amount) * time.Hour), true
+		case "day":
+			dueDay = reference.AddDate(0, 0, amount)
+		case "week":
+			dueDay = reference.AddDate(0, 0, 7*amount)
+		}
+
+	case weekdayRegex.MatchString(phrase):
+		match := weekdayRegex.FindStringSubmatch(phrase)
+		weekday := weekdaysByPrefix[match[2][:3]]
+		if weekday == reference.Weekday() && match[1] == "" {
+			dueDay = reference
+		} else {
+			dueDay = upcomingWeekday(reference, weekday)
+			// "next friday" said on a monday means the friday of the following week
+			if match[1] != "" && daysSinceMonday(dueDay) > daysSinceMonday(reference) && dueDay.Sub(reference) < 7*24*time.Hour {
+				dueDay = dueDay.AddDate(0, 0, 7)
+			}
+		}
+
+	case nextWeekRegex.MatchString(phrase):
+		// friday of the following week
+		dueDay = reference.AddDate(0, 0, 7-daysSinceMonday(reference)+4)
+
+	case endOfWeekRegex.MatchString(phrase):
+		dueDay = reference.AddDate(0, 0, 4-daysSinceMonday(reference))
+		if dueDay.Before(atStartOfDay(reference)) {
+			dueDay = reference
+		}
+
+	case endOfMonthRegex.MatchString(phrase):
+		dueDay = time.Date(reference.Year(), reference.Month()+1, 0, 0, 0, 0, 0, reference.Location())
+
+	case tomorrowRegex.MatchString(phrase):
+		dueDay = reference.AddDate(0, 0, 1)
+
+	case todayRegex.MatchString(phrase):
+		dueDay = reference
+
+	case clockTimeRegex.MatchString(phrase):
+		// only a time was given, it is either later today or tomorrow
+		dueTime := applyClockTime(phrase, reference)
+		if dueTime.Before(reference) {
+			dueTime = dueTime.AddDate(0, 0, 1)
+		}
+		return dueTime, true
+
+	default:
+		found = false
+	}
+
+	if !found {
+		return time.Time{}, false
+	}
+	return applyClockTime(phrase, atEndOfBusiness(dueDay)), true
+}
@@ -0,0 +1,59 @@
+package SummarizeConversations
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDueDate(t *testing.T) {
+	// a wednesday morning
+	reference := time.Date(2024, time.May, 15, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		phrase string
+		want   time.Time
+	}{
+		{"by Friday", time.Date(2024, time.May, 17, 17, 0, 0, 0, time.UTC)},
+		{"this friday", time.Date(2024, time.May, 17, 17, 0, 0, 0, time.UTC)},
+		{"next friday", time.Date(2024, time.May, 24, 17, 0, 0, 0, time.UTC)},
+		{"wednesday", time.Date(2024, time.May, 15, 17, 0, 0, 0, time.UTC)},
+		{"next wednesday", time.Date(2024, time.May, 22, 17, 0, 0, 0, time.UTC)},
+		{"monday", time.Date(2024, time.May, 20, 17, 0, 0, 0, time.UTC)},
+		{"next monday", time.Date(2024, time.May, 20, 17, 0, 0, 0, time.UTC)},
+		{"mon 9am", time.Date(2024, time.May, 20, 9, 0, 0, 0, time.UTC)},
+		{"tomorrow 3pm", time.Date(2024, time.May, 16, 15, 0, 0, 0, time.UTC)},
+		{"EOD", time.Date(2024, time.May, 15, 17, 0, 0, 0, time.UTC)},
+		{"end of week", time.Date(2024, time.May, 17, 17, 0, 0, 0, time.UTC)},
+		{"next week", time.Date(2024, time.May, 24, 17, 0, 0, 0, time.UTC)},
+		{"end of month", time.Date(2024, time.May, 31, 17, 0, 0, 0, time.UTC)},
+		{"in 2 hours", time.Date(2024, time.May, 15, 12, 0, 0, 0, time.UTC)},
+		{"in three days", time.Date(2024, time.May, 18, 17, 0, 0, 0, time.UTC)},
+		{"2024-06-01", time.Date(2024, time.June, 1, 17, 0, 0, 0, time.UTC)},
+		{"May 15", time.Date(2024, time.May, 15, 17, 0, 0, 0, time.UTC)},
+		{"June 3rd", time.Date(2024, time.June, 3, 17, 0, 0, 0, time.UTC)},
+		{"May 14", time.Date(2025, time.May, 14, 17, 0, 0, 0, time.UTC)},
+		{"3 jan", time.Date(2025, time.January, 3, 17, 0, 0, 0, time.UTC)},
+		{"16:30", time.Date(2024, time.May, 15, 16, 30, 0, 0, time.UTC)},
+		{"8am", time.Date(2024, time.May, 16, 8, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		got, parsed := parseDueDate(test.phrase, reference)
+		if !parsed {
+			t.Errorf("parseDueDate(%q) was not parsed, want %s", test.phrase, test.want)
+			continue
+		}
+		if !got.Equal(test.want) {
+			t.Errorf("parseDueDate(%q) = %s, want %s", test.phrase, got, test.want)
+		}
+	}
+}
+
+func TestParseDueDateRejectsUnparseableText(t *testing.T) {
+	reference := time.Date(2024, time.May, 15, 10, 0, 0, 0, time.UTC)
+
+	for _, phrase := range []string{"", "   ", "when you get a chance", "soon-ish", "2024-13-01", "feb 32"} {
+		if got, parsed := parseDueDate(phrase, reference); parsed {
+			t.Errorf("parseDueDate(%q) = %s, want it not to be parsed", phrase, got)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package SummarizeConversations
+
+import (
+	"strings"
+
+	"slack-tag-summariser/Models"
+)
+
+type EvidenceQuote = Models.EvidenceQuote
+
+const maxEvidenceQuotes = 2
+
+// parseEvidence reads the "evidence" array, the quotes are only checked against the thread
+// once the redacted values are restored, see validateEvidence
+func parseEvidence(rawEvidence interface{}) []EvidenceQuote {
+	evidenceValues, ok := rawEvidence.([]interface{})
+	if !ok {
+		return nil
+	}
+
+	var evidence []EvidenceQuote
+	for _, evidenceValue := range evidenceValues {
+		evidenceObject, isObject := evidenceValue.(map[string]interface{})
+		if !isObject {
+			continue
+		}
+		var quote EvidenceQuote
+		quote.Quote, _ = evidenceObject["quote"].(string)
+		quote.SourceMessageTimestamp, _ = evidenceObject["source_message_ts"].(string)
+		// the model sometimes wraps the excerpt in quotation marks of its own
+		quote.Quote = strings.Trim(strings.TrimSpace(quote.Quote), "\"“”„«»")
+		if quote.Quote != "" {
+			evidence = append(evidence, quote)
+		}
+	}
+	return evidence
+}
+
+func normaliseQuoteText(text string) string {
+	return strings.ToLower(strings.Join(strings.Fields(text), " "))
+}
+
+// findQuoteSource returns the timestamp of the message the quote was copied from, the message
+// the model pointed at is tried first and then the rest of the thread in order
+func findQuoteSource(quote EvidenceQuote, conversationContext ConversationResponseEntry) (string, bool) {
+	normalisedQuote := normaliseQuoteText(quote.Quote)
+
+	for _, msg := range conversationContext.Messages {
+		if msg.Timestamp == quote.SourceMessageTimestamp && strings.Contains(normaliseQuoteText(msg.Text), normalisedQuote) {
+			return msg.Timestamp, true
+		}
+	}
+	for _, msg := range conversationContext.Messages {
+		if strings.Contains(normaliseQuoteText(msg.Text), normalisedQuote) {
+			return msg.Timestamp, true
+		}
+	}
+	if strings.Contains(normaliseQuoteText(conversationContext.MentionText), normalisedQuote) {
+		return conversationContext.MentionTimestamp, true
+	}
+	return "", false
+}
+
+// validateEvidence drops every quote that is not really in the thread, corrects the timestamp of
+// quotes attributed to the wrong message and links each quote to its message
+func validateEvidence(s *GenAiResponse, conversationContext ConversationResponseEntry) {
+	var evidence []EvidenceQuote
+	for _, quote := range s.Evidence {
+		if len(evidence) == maxEvidenceQuotes {
+			break
+		}
+		sourceTimestamp, found := findQuoteSource(quote, conversationContext)
+		if !found {
+			s.GroundingIssues = append(s.GroundingIssues, "evidence quote is not in the thread: "+truncateText(quote.Quote, maxExtractiveBulletLength))
+			continue
+		}
+		quote.SourceMessageTimestamp = sourceTimestamp
+		quote.SourcePermalink = buildMessagePermalink(conversationContext, sourceTimestamp)
+		evidence = append(evidence, quote)
+	}
+	s.Evidence = evidence
+}
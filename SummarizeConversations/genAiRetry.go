@@ -0,0 +1,246 @@
+package SummarizeConversations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+const (
+	defaultPrimaryModel  = "gemini-3-pro-preview"
+	defaultFallbackModel = "gemini-2.5-flash"
+
+	defaultMaxRetries  = 3
+	defaultCallTimeout = 60 * time.Second
+
+	baseBackoff = 1 * time.Second
+	maxBackoff  = 20 * time.Second
+
+	// the breaker opens after this many consecutive retryable failures for a model
+	// and rejects calls for that model until the cooldown has passed
+	circuitBreakerThreshold = 5
+	circuitBreakerCooldown  = 2 * time.Minute
+)
+
+var errCircuitOpen = errors.New("circuit breaker is open")
+
+// GenAiProvider is the part of the genai client the summariser needs, *genai.Models implements it
+// and the eval command swaps in recorded responses so it can run offline
+type GenAiProvider interface {
+	GenerateContent(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error)
+}
+
+func getEnvOrDefault(key string, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvIntOrDefault(key string, defaultValue int) int {
+	value, parseError := strconv.Atoi(os.Getenv(key))
+	if parseError != nil || value < 0 {
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvDurationOrDefault(key string, defaultValue time.Duration) time.Duration {
+	value, parseError := time.ParseDuration(os.Getenv(key))
+	if parseError != nil || value <= 0 {
+		return defaultValue
+	}
+	return value
+}
+
+func getPrimaryModel() string {
+	return getEnvOrDefault("GEMINI_MODEL", defaultPrimaryModel)
+}
+
+// GEMINI_FALLBACK_MODEL can be set to "none" to disable the fallback
+func getFallbackModel(primaryModel string) string {
+	fallbackModel := getEnvOrDefault("GEMINI_FALLBACK_MODEL", defaultFallbackModel)
+	if fallbackModel == "none" || fallbackModel == primaryModel {
+		return ""
+	}
+	return fallbackModel
+}
+
+type circuitBreaker struct {
+	mu                  sync.Mutex
+	consecutiveFailures int
+	openUntil           time.Time
+}
+
+var (
+	circuitBreakersMu sync.Mutex
+	circuitBreakers   = make(map[string]*circuitBreaker)
+)
+
+func getCircuitBreaker(model string) *circuitBreaker {
+	circuitBreakersMu.Lock()
+	defer circuitBreakersMu.Unlock()
+
+	breaker, exists := circuitBreakers[model]
+	if !exists {
+		breaker = &circuitBreaker{}
+		circuitBreakers[model] = breaker
+	}
+	return breaker
+}
+
+func (cb *circuitBreaker) allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	// once the cooldown is over we let calls through again (half open)
+	// a single failure after that re-opens the breaker straight away
+	return time.Now().After(cb.openUntil)
+}
+
+func (cb *circuitBreaker) recordSuccess() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.consecutiveFailures = 0
+	cb.openUntil = time.Time{}
+}
+
+func (cb *circuitBreaker) recordFailure() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.consecutiveFailures++
+	if cb.consecutiveFailures >= circuitBreakerThreshold {
+		cb.openUntil = time.Now().Add(circuitBreakerCooldown)
+	}
+}
+
+// isRetryableGenAiError tells if the error is transient i.e. rate limiting, server side errors or timeouts
+func isRetryableGenAiError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var apiError genai.APIError
+	if errors.As(err, &apiError) {
+		return apiError.Code == http.StatusTooManyRequests ||
+			apiError.Code == http.StatusRequestTimeout ||
+			apiError.Code >= http.StatusInternalServerError
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netError net.Error
+	if errors.As(err, &netError) && netError.Timeout() {
+		return true
+	}
+	return false
+}
+
+// exponential backoff with full jitter
+func getBackoffDuration(attempt int) time.Duration {
+	backoff := baseBackoff << attempt
+	if backoff > maxBackoff || backoff <= 0 {
+		backoff = maxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(backoff)) + 1)
+}
+
+// the per call timeout is capped by whatever time is left on the run context
+func getCallTimeout(ctx context.Context) time.Duration {
+	callTimeout := getEnvDurationOrDefault("GEMINI_CALL_TIMEOUT", defaultCallTimeout)
+	if deadline, hasDeadline := ctx.Deadline(); hasDeadline {
+		if remaining := time.Until(deadline); remaining < callTimeout {
+			return remaining
+		}
+	}
+	return callTimeout
+}
+
+func generateContentWithRetry(
+	ctx context.Context,
+	genAiProvider GenAiProvider,
+	model string,
+	contents []*genai.Content,
+	config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error) {
+
+	breaker := getCircuitBreaker(model)
+	maxRetries := getEnvIntOrDefault("GEMINI_MAX_RETRIES", defaultMaxRetries)
+
+	var lastError error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if !breaker.allow() {
+			return nil, fmt.Errorf("model %s: %w", model, errCircuitOpen)
+		}
+
+		callCtx, cancel := context.WithTimeout(ctx, getCallTimeout(ctx))
+		genAiResult, genAiError := genAiProvider.GenerateContent(callCtx, model, contents, config)
+		cancel()
+
+		if genAiError == nil {
+			breaker.recordSuccess()
+			return genAiResult, nil
+		}
+		lastError = genAiError
+
+		// the run itself is over, there is no point in retrying
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		if !isRetryableGenAiError(genAiError) {
+			return nil, genAiError
+		}
+		breaker.recordFailure()
+
+		if attempt == maxRetries {
+			break
+		}
+
+		backoff := getBackoffDuration(attempt)
+		log.Printf("SummarizeConversations:generateContentWithRetry#Attempt %d for model %s failed, retrying in %s: %s", attempt+1, model, backoff, genAiError.Error())
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return nil, fmt.Errorf("model %s failed after %d attempts: %w", model, maxRetries+1, lastError)
+}
+
+// generateContentWithFallback tries the primary model first and, if it keeps failing
+// with transient errors or its breaker is open, falls back to the secondary model
+func generateContentWithFallback(
+	ctx context.Context,
+	genAiProvider GenAiProvider,
+	primaryModel string,
+	contents []*genai.Content,
+	config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error) {
+
+	genAiResult, primaryError := generateContentWithRetry(ctx, genAiProvider, primaryModel, contents, config)
+	if primaryError == nil {
+		return genAiResult, nil
+	}
+
+	fallbackModel := getFallbackModel(primaryModel)
+	if fallbackModel == "" || ctx.Err() != nil ||
+		!(isRetryableGenAiError(primaryError) || errors.Is(primaryError, errCircuitOpen)) {
+		return nil, primaryError
+	}
+
+	log.Printf("SummarizeConversations:generateContentWithFallback#Primary model %s failed, falling back to %s: %s", primaryModel, fallbackModel, primaryError.Error())
+
+	return generateContentWithRetry(ctx, genAiProvider, fallbackModel, contents, config)
+}
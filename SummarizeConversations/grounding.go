@@ -0,0 +1,207 @@
+package SummarizeConversations
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"slack-tag-summariser/Localisation"
+)
+
+// matches "<@U123>" and "<@U123|name>", bare IDs are left alone as they cannot be told apart
+// from codes like "UX2024ABCD"
+var userReferenceRegex = regexp.MustCompile(`<@(U[A-Z0-9]{6,})(?:\|[^>]*)?>`)
+
+// tokens of the summary that have to be copied from the thread: numbers, versions, ticket
+// and error codes, file names and identifiers, channels and acronyms
+var keyTermRegex = regexp.MustCompile(`#?[\p{L}\p{N}]+(?:[-_./:][\p{L}\p{N}]+)*`)
+
+var sentenceEndRegex = regexp.MustCompile(`[.!?]\s+$`)
+
+const (
+	ungroundedMentionPenalty = 0.15
+	// the whole confidence is lost to this share when none of the key terms are in the thread
+	ungroundedTermsWeight = 0.5
+	// an action item pointing at terms that are not in the thread is capped at this confidence
+	ungroundedActionItemConfidence = 0.3
+)
+
+// groundingSource is the text of the thread the LLM output is checked against
+type groundingSource struct {
+	userIds map[string]struct{}
+	// lower cased text of every message of the thread
+	text string
+	// proper nouns can only be checked when the summary is written in the language of the thread
+	checkProperNouns bool
+}
+
+func newGroundingSource(conversationContext ConversationResponseEntry, summaryLanguage string, userId string) groundingSource {
+	source := groundingSource{userIds: make(map[string]struct{})}
+
+	texts := []string{conversationContext.MentionText}
+	addUserId := func(id string) {
+		if id != "" {
+			source.userIds[id] = struct{}{}
+		}
+	}
+	addUserId(userId)
+	addUserId(conversationContext.MentionUserId)
+	for _, msg := range conversationContext.Messages {
+		addUserId(msg.User)
+		texts = append(texts, msg.Text)
+	}
+	for _, text := range texts {
+		for _, id := range slackUserIdRegex.FindAllString(text, -1) {
+			addUserId(id)
+		}
+	}
+
+	source.text = strings.ToLower(strings.Join(texts, "\n"))
+
+	threadLanguage := Localisation.DetectLanguage(texts)
+	source.checkProperNouns = summaryLanguage == Localisation.DefaultLanguage &&
+		(threadLanguage == "" || threadLanguage == Localisation.DefaultLanguage)
+	return source
+}
+
+func (source groundingSource) hasUserId(userId string) bool {
+	_, exists := source.userIds[userId]
+	return exists
+}
+
+// groundUserReferences rewrites every user mention of the text to the "<@U123>" format and drops the
+// ones that are not part of the thread, it returns the IDs that were dropped
+func (source groundingSource) groundUserReferences(text string) (string, []string) {
+	var droppedIds []string
+	grounded := userReferenceRegex.ReplaceAllStringFunc(text, func(reference string) string {
+		userId := userReferenceRegex.FindStringSubmatch(reference)[1]
+		if !source.hasUserId(userId) {
+			droppedIds = append(droppedIds, userId)
+			return ""
+		}
+		return "<@" + userId + ">"
+	})
+
+	if len(droppedIds) > 0 {
+		grounded = strings.Join(strings.Fields(grounded), " ")
+	}
+	return grounded, droppedIds
+}
+
+func isKeyTerm(term string, afterSentenceEnd bool, checkProperNouns bool) bool {
+	if strings.HasPrefix(term, "#") {
+		return true
+	}
+
+	letters, digits, upper := 0, 0, 0
+	for _, r := range term {
+		switch {
+		case unicode.IsDigit(r):
+			digits++
+		case unicode.IsLetter(r):
+			letters++
+			if unicode.IsUpper(r) {
+				upper++
+			}
+		}
+	}
+
+	switch {
+	case digits >= 2 || (digits > 0 && letters > 0):
+		// numbers, versions, dates and codes like JIRA-123
+		return true
+	case strings.ContainsAny(term, "_./:") && letters > 0:
+		// file names, paths and identifiers
+		return true
+	case letters >= 2 && upper == letters:
+		// acronyms like SLA or API
+		return true
+	case checkProperNouns && !afterSentenceEnd && letters >= 3 && upper > 0 && unicode.IsUpper([]rune(term)[0]):
+		return true
+	}
+	return false
+}
+
+// ungroundedKeyTerms returns the key terms of the text that cannot be found in the thread
+func (source groundingSource) ungroundedKeyTerms(text string) (keyTerms []string, ungrounded []string) {
+	// user mentions are checked on their own
+	text = userReferenceRegex.ReplaceAllString(text, " ")
+
+	for _, bounds := range keyTermRegex.FindAllStringIndex(text, -1) {
+		term := text[bounds[0]:bounds[1]]
+		afterSentenceEnd := bounds[0] == 0 || sentenceEndRegex.MatchString(text[:bounds[0]])
+		if !isKeyTerm(term, afterSentenceEnd, source.checkProperNouns) {
+			continue
+		}
+		keyTerms = append(keyTerms, term)
+		if !strings.Contains(source.text, strings.ToLower(strings.TrimPrefix(term, "#"))) {
+			ungrounded = append(ungrounded, term)
+		}
+	}
+	return keyTerms, ungrounded
+}
+
+// groundGenAiResponse checks the LLM output against the thread it was written from. User mentions
+// are normalised to "<@U123>" and the ones not in the thread are dropped, key terms that do not
+// appear in the thread are flagged and the result gets a confidence between 0 and 1.
+func groundGenAiResponse(s *GenAiResponse, conversationContext ConversationResponseEntry, userId string) {
+	source := newGroundingSource(conversationContext, s.Language, userId)
+	s.GroundingIssues = nil
+
+	var droppedIds []string
+	var keyTermCount, ungroundedTermCount int
+
+	for i, summaryText := range s.Summary {
+		groundedText, dropped := source.groundUserReferences(summaryText)
+		s.Summary[i] = groundedText
+		droppedIds = append(droppedIds, dropped...)
+
+		keyTerms, ungroundedTerms := source.ungroundedKeyTerms(groundedText)
+		keyTermCount += len(keyTerms)
+		ungroundedTermCount += len(ungroundedTerms)
+		for _, term := range ungroundedTerms {
+			s.GroundingIssues = append(s.GroundingIssues, fmt.Sprintf("summary mentions %q which is not in the thread", term))
+		}
+	}
+
+	groundedRationale, droppedFromRationale := source.groundUserReferences(s.Rationale)
+	s.Rationale = groundedRationale
+	droppedIds = append(droppedIds, droppedFromRationale...)
+
+	for i := range s.ActionRequired {
+		a := &s.ActionRequired[i]
+
+		groundedDescription, dropped := source.groundUserReferences(a.Description)
+		a.Description = groundedDescription
+		droppedIds = append(droppedIds, dropped...)
+
+		if a.OwnerUserId != "" && !source.hasUserId(a.OwnerUserId) {
+			droppedIds = append(droppedIds, a.OwnerUserId)
+			a.OwnerUserId = ""
+		}
+		if a.RequesterUserId != "" && !source.hasUserId(a.RequesterUserId) {
+			droppedIds = append(droppedIds, a.RequesterUserId)
+			a.RequesterUserId = ""
+		}
+
+		keyTerms, ungroundedTerms := source.ungroundedKeyTerms(a.Description)
+		keyTermCount += len(keyTerms)
+		ungroundedTermCount += len(ungroundedTerms)
+		if len(ungroundedTerms) > 0 {
+			s.GroundingIssues = append(s.GroundingIssues, fmt.Sprintf("action %q mentions %s which is not in the thread", a.Description, strings.Join(ungroundedTerms, ", ")))
+			a.Confidence = math.Min(a.Confidence, ungroundedActionItemConfidence)
+		}
+	}
+
+	for _, droppedId := range droppedIds {
+		s.GroundingIssues = append(s.GroundingIssues, fmt.Sprintf("user %s is not in the thread", droppedId))
+	}
+
+	confidence := 1 - ungroundedMentionPenalty*float64(len(droppedIds))
+	if keyTermCount > 0 {
+		confidence -= ungroundedTermsWeight * float64(ungroundedTermCount) / float64(keyTermCount)
+	}
+	s.Confidence = math.Round(min(max(confidence, 0), 1)*100) / 100
+}
@@ -0,0 +1,84 @@
+package SummarizeConversations
+
+import (
+	"slices"
+	"testing"
+
+	"slack-tag-summariser/Models"
+)
+
+func newGroundingTestConversation() ConversationResponseEntry {
+	return ConversationResponseEntry{
+		MentionText:      "<@U0EVALUSER> can you deploy build UX2024ABCD to staging?",
+		MentionUserId:    "U0AUTHOR1",
+		MentionTimestamp: "1700000000.000100",
+		Messages: []Models.ThreadMessage{
+			{Text: "<@U0EVALUSER> can you deploy build UX2024ABCD to staging?", Timestamp: "1700000000.000100", User: "U0AUTHOR1"},
+			{Text: "<@U0REVIEWER> will check it afterwards", Timestamp: "1700000060.000100", User: "U0AUTHOR1"},
+		},
+	}
+}
+
+func TestGroundUserReferences(t *testing.T) {
+	source := newGroundingSource(newGroundingTestConversation(), "en", "U0EVALUSER")
+
+	tests := []struct {
+		text        string
+		want        string
+		wantDropped []string
+	}{
+		{"<@U0AUTHOR1> asks for a deploy", "<@U0AUTHOR1> asks for a deploy", nil},
+		{"<@U0AUTHOR1|alice> asks for a deploy", "<@U0AUTHOR1> asks for a deploy", nil},
+		{"<@U0REVIEWER> checks it afterwards", "<@U0REVIEWER> checks it afterwards", nil},
+		// bare IDs are not mentions, build numbers and codes look just like them
+		{"Deploy build UX2024ABCD to staging", "Deploy build UX2024ABCD to staging", nil},
+		{"Deploy build @UX2024ABCD to staging", "Deploy build @UX2024ABCD to staging", nil},
+		{"Tracked as UX2099WXYZ", "Tracked as UX2099WXYZ", nil},
+		{"<@U0STRANGER> asks for a deploy", "asks for a deploy", []string{"U0STRANGER"}},
+		{"Ask <@U0STRANGER|bob> and <@U0AUTHOR1> about it", "Ask and <@U0AUTHOR1> about it", []string{"U0STRANGER"}},
+	}
+	for _, test := range tests {
+		got, dropped := source.groundUserReferences(test.text)
+		if got != test.want {
+			t.Errorf("groundUserReferences(%q) = %q, want %q", test.text, got, test.want)
+		}
+		if !slices.Equal(dropped, test.wantDropped) {
+			t.Errorf("groundUserReferences(%q) dropped %v, want %v", test.text, dropped, test.wantDropped)
+		}
+	}
+}
+
+func TestGroundGenAiResponse(t *testing.T) {
+	response := GenAiResponse{
+		Language:  "en",
+		Summary:   []string{"<@U0AUTHOR1> asks to deploy build UX2024ABCD to staging", "<@U0STRANGER> approved it"},
+		Rationale: "<@U0AUTHOR1> asked directly",
+		ActionRequired: []ActionItem{
+			{Description: "Deploy build UX2024ABCD to staging", OwnerUserId: "U0EVALUSER", RequesterUserId: "U0STRANGER", Confidence: 0.9},
+		},
+	}
+
+	groundGenAiResponse(&response, newGroundingTestConversation(), "U0EVALUSER")
+
+	if response.Summary[0] != "<@U0AUTHOR1> asks to deploy build UX2024ABCD to staging" {
+		t.Errorf("a grounded summary line was changed to %q", response.Summary[0])
+	}
+	if response.Summary[1] != "approved it" {
+		t.Errorf("the user outside the thread was not stripped: %q", response.Summary[1])
+	}
+
+	actionItem := response.ActionRequired[0]
+	if actionItem.Description != "Deploy build UX2024ABCD to staging" || actionItem.Confidence != 0.9 {
+		t.Errorf("a grounded action item was changed: %+v", actionItem)
+	}
+	if actionItem.OwnerUserId != "U0EVALUSER" || actionItem.RequesterUserId != "" {
+		t.Errorf("owner/requester = %q/%q, want the requester outside the thread to be dropped", actionItem.OwnerUserId, actionItem.RequesterUserId)
+	}
+
+	if len(response.GroundingIssues) != 2 {
+		t.Errorf("expected an issue for each reference to U0STRANGER, got %v", response.GroundingIssues)
+	}
+	if response.Confidence != 0.7 {
+		t.Errorf("confidence = %.2f, want 0.7 after two dropped references", response.Confidence)
+	}
+}
@@ -0,0 +1,202 @@
+package SummarizeConversations
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"slack-tag-summariser/Models"
+	"slack-tag-summariser/Repo"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"google.golang.org/genai"
+)
+
+type LlmUsage = Models.LlmUsage
+
+// LlmUsageStats adds up the usage of every LLM call of a run, the cost is kept in micro dollars
+// so it can be summed atomically
+type LlmUsageStats struct {
+	Calls           atomic.Int64
+	PromptTokens    atomic.Int64
+	CandidateTokens atomic.Int64
+	CostMicroUsd    atomic.Int64
+}
+
+func (usageStats *LlmUsageStats) CostUsd() float64 {
+	return float64(usageStats.CostMicroUsd.Load()) / 1e6
+}
+
+// modelPrice is in US dollars per million tokens
+type modelPrice struct {
+	Input  float64
+	Output float64
+}
+
+var defaultModelPrices = map[string]modelPrice{
+	"gemini-3-pro-preview":  {Input: 2.00, Output: 12.00},
+	"gemini-2.5-pro":        {Input: 1.25, Output: 10.00},
+	"gemini-2.5-flash":      {Input: 0.30, Output: 2.50},
+	"gemini-2.5-flash-lite": {Input: 0.10, Output: 0.40},
+}
+
+// LLM_PRICES overrides or extends the price table, it is a comma separated list of
+// model:input:output prices in dollars per million tokens e.g. "gemini-2.5-flash:0.30:2.50"
+func getModelPrices() map[string]modelPrice {
+	modelPrices := make(map[string]modelPrice)
+	for model, price := range defaultModelPrices {
+		modelPrices[model] = price
+	}
+
+	for _, entry := range strings.Split(getEnvOrDefault("LLM_PRICES", ""), ",") {
+		fields := strings.Split(strings.TrimSpace(entry), ":")
+		if len(fields) != 3 {
+			continue
+		}
+		inputPrice, inputParseError := strconv.ParseFloat(fields[1], 64)
+		outputPrice, outputParseError := strconv.ParseFloat(fields[2], 64)
+		if inputParseError != nil || outputParseError != nil || inputPrice < 0 || outputPrice < 0 {
+			continue
+		}
+		modelPrices[fields[0]] = modelPrice{Input: inputPrice, Output: outputPrice}
+	}
+	return modelPrices
+}
+
+// estimateCostUsd uses the longest model name in the price table the model starts with,
+// so versioned names like "gemini-2.5-flash-001" are priced as their base model
+func estimateCostUsd(model string, promptTokens int, candidateTokens int) float64 {
+	var price modelPrice
+	matchedLength := -1
+	for pricedModel, pricedModelPrice := range getModelPrices() {
+		if strings.HasPrefix(model, pricedModel) && len(pricedModel) > matchedLength {
+			price = pricedModelPrice
+			matchedLength = len(pricedModel)
+		}
+	}
+	if matchedLength < 0 {
+		log.Printf("SummarizeConversations:estimateCostUsd#No price for model %s, its cost is counted as 0", model)
+		return 0
+	}
+	return (float64(promptTokens)*price.Input + float64(candidateTokens)*price.Output) / 1e6
+}
+
+// conversationKey identifies a conversation in the usage records
+func conversationKey(conversationContext ConversationResponseEntry) string {
+	threadTimestamp := conversationContext.ThreadTimestamp
+	if threadTimestamp == "" {
+		threadTimestamp = conversationContext.MentionTimestamp
+	}
+	return conversationContext.MentionChannelId + ":" + threadTimestamp
+}
+
+func recordGenAiUsage(
+	genAiResult *genai.GenerateContentResponse,
+	requestedModel string,
+	latency time.Duration,
+	purpose string,
+	conversationKeys []string,
+	summarizeOptions SummarizeOptions) {
+
+	usage := LlmUsage{
+		RunId:            summarizeOptions.RunId,
+		WorkspaceId:      summarizeOptions.WorkspaceId,
+		UserId:           summarizeOptions.UserId,
+		ConversationKeys: conversationKeys,
+		Purpose:          purpose,
+		// the response names the model that actually answered, which can be the fallback
+		Model:   genAiResult.ModelVersion,
+		Latency: latency,
+	}
+	if usage.Model == "" {
+		usage.Model = requestedModel
+	}
+	if genAiResult.UsageMetadata != nil {
+		usage.PromptTokens = int(genAiResult.UsageMetadata.PromptTokenCount)
+		usage.CandidateTokens = int(genAiResult.UsageMetadata.CandidatesTokenCount + genAiResult.UsageMetadata.ThoughtsTokenCount)
+		usage.TotalTokens = int(genAiResult.UsageMetadata.TotalTokenCount)
+	}
+	usage.CostUsd = estimateCostUsd(usage.Model, usage.PromptTokens, usage.CandidateTokens)
+
+	if summarizeOptions.UsageStats != nil {
+		summarizeOptions.UsageStats.Calls.Add(1)
+		summarizeOptions.UsageStats.PromptTokens.Add(int64(usage.PromptTokens))
+		summarizeOptions.UsageStats.CandidateTokens.Add(int64(usage.CandidateTokens))
+		summarizeOptions.UsageStats.CostMicroUsd.Add(int64(usage.CostUsd * 1e6))
+	}
+
+	if summarizeOptions.DbPool == nil {
+		return
+	}
+	if saveUsageError := Repo.SaveLlmUsage(usage, summarizeOptions.DbPool); saveUsageError != nil {
+		log.Printf("SummarizeConversations:recordGenAiUsage#Error saving LLM usage: %s", saveUsageError.Error())
+	}
+}
+
+// generateContentWithUsage is generateContentWithFallback plus the token, latency and cost accounting
+func generateContentWithUsage(
+	ctx context.Context,
+	genAiProvider GenAiProvider,
+	contents []*genai.Content,
+	config *genai.GenerateContentConfig,
+	purpose string,
+	conversationKeys []string,
+	summarizeOptions SummarizeOptions) (*genai.GenerateContentResponse, error) {
+
+	model := summarizeOptions.getModel()
+	startedAt := time.Now()
+	genAiResult, genAiError := generateContentWithFallback(ctx, genAiProvider, model, contents, config)
+	if genAiError != nil {
+		return nil, genAiError
+	}
+
+	recordGenAiUsage(genAiResult, model, time.Since(startedAt), purpose, conversationKeys, summarizeOptions)
+	return genAiResult, nil
+}
+
+// getWorkspaceMonthlyBudget reads WORKSPACE_MONTHLY_BUDGETS, a comma separated list of
+// workspace:dollars pairs e.g. "T123:50,T456:20", workspaces that are not listed use
+// DEFAULT_MONTHLY_BUDGET_USD, 0 means no budget
+func getWorkspaceMonthlyBudget(workspaceId string) float64 {
+	for _, pair := range strings.Split(getEnvOrDefault("WORKSPACE_MONTHLY_BUDGETS", ""), ",") {
+		pairWorkspaceId, budgetText, found := strings.Cut(strings.TrimSpace(pair), ":")
+		if !found || pairWorkspaceId != workspaceId {
+			continue
+		}
+		if budget, parseError := strconv.ParseFloat(budgetText, 64); parseError == nil && budget >= 0 {
+			return budget
+		}
+	}
+
+	budget, parseError := strconv.ParseFloat(getEnvOrDefault("DEFAULT_MONTHLY_BUDGET_USD", "0"), 64)
+	if parseError != nil || budget < 0 {
+		return 0
+	}
+	return budget
+}
+
+// GetBudgetModel returns the cheaper model a workspace is degraded to once it has spent its
+// monthly budget, BUDGET_MODEL defaults to the fallback model, empty means the budget is fine
+func GetBudgetModel(workspaceId string, now time.Time, dbPool *pgxpool.Pool) string {
+	budget := getWorkspaceMonthlyBudget(workspaceId)
+	if budget <= 0 || workspaceId == "" {
+		return ""
+	}
+
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	monthCost, getCostError := Repo.GetWorkspaceCostSince(workspaceId, monthStart, dbPool)
+	if getCostError != nil {
+		log.Printf("SummarizeConversations:GetBudgetModel#Error getting the cost of workspace %s: %s", workspaceId, getCostError.Error())
+		return ""
+	}
+	if monthCost < budget {
+		return ""
+	}
+
+	budgetModel := getEnvOrDefault("BUDGET_MODEL", defaultFallbackModel)
+	log.Printf("SummarizeConversations:GetBudgetModel#Workspace %s spent $%.2f of its $%.2f budget, using %s", workspaceId, monthCost, budget, budgetModel)
+	return budgetModel
+}
@@ -0,0 +1,106 @@
+package SummarizeConversations
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"slack-tag-summariser/Localisation"
+)
+
+const (
+	untrustedDataStartDelimiter = "<untrusted_thread_data>"
+	untrustedDataEndDelimiter   = "</untrusted_thread_data>"
+
+	// in extractive mode every bullet is cut to this many characters
+	maxExtractiveBulletLength = 200
+)
+
+type injectionPattern struct {
+	reason string
+	regex  *regexp.Regexp
+}
+
+// injectionPatterns are phrases that address the model instead of the people in the thread
+var injectionPatterns = []injectionPattern{
+	{"asks to ignore previous instructions", regexp.MustCompile(`(?i)\b(ignore|disregard|forget|override)\s+(all\s+|any\s+)?(of\s+)?(the\s+|your\s+)?(previous|prior|above|earlier|system|original)\s+(instructions|rules|prompts?|messages|context)`)},
+	{"tries to change the role of the model", regexp.MustCompile(`(?i)\b(you are now|from now on you|act as an?|pretend to be|new instructions|system prompt|developer mode|jailbreak)\b`)},
+	{"dictates the priority or actionable label", regexp.MustCompile(`(?i)\b(mark|classify|label|flag|set|rate)\s+(this|it|the thread|this thread)?\s*(as|to)?\s*(p[0-3]|non-?actionable|not actionable)\b|\b(priority|actionable)\s*[:=]\s*"?(p[0-3]|yes|no)\b`)},
+	{"dictates the output of the model", regexp.MustCompile(`(?i)\b(output|return|respond with|reply with|print)\s+(only\s+)?(the\s+)?(following\s+)?json\b|"(summary|action_required|actionable|priority)"\s*:`)},
+	{"contains chat role markers or prompt delimiters", regexp.MustCompile(`(?im)^\s*(system|assistant|developer)\s*:|</?untrusted_thread_data>|<\|(im_start|im_end|system)\|>`)},
+}
+
+// detectPromptInjection returns why the thread looks like it tries to steer the model, nil when it does not
+func detectPromptInjection(conversationContext ConversationResponseEntry) []string {
+	texts := []string{conversationContext.MentionText}
+	for _, msg := range conversationContext.Messages {
+		texts = append(texts, msg.Text)
+	}
+
+	var reasons []string
+	for _, pattern := range injectionPatterns {
+		for _, text := range texts {
+			if pattern.regex.MatchString(text) {
+				reasons = append(reasons, pattern.reason)
+				break
+			}
+		}
+	}
+	return reasons
+}
+
+// neutraliseDelimiters stops thread content from closing the untrusted data block early
+func neutraliseDelimiters(text string) string {
+	text = strings.ReplaceAll(text, untrustedDataStartDelimiter, "<untrusted-thread-data>")
+	return strings.ReplaceAll(text, untrustedDataEndDelimiter, "</untrusted-thread-data>")
+}
+
+// PROMPT_INJECTION_MODE=extractive replaces the LLM summary of flagged threads with a safe extractive one,
+// the default "flag" still summarises them with the hardened prompt and only marks them
+func isExtractiveInjectionMode() bool {
+	return strings.EqualFold(getEnvOrDefault("PROMPT_INJECTION_MODE", "flag"), "extractive")
+}
+
+func truncateText(text string, maxLength int) string {
+	text = normaliseText(text)
+	if utf8.RuneCountInString(text) <= maxLength {
+		return text
+	}
+	return string([]rune(text)[:maxLength-1]) + "…"
+}
+
+// buildExtractiveSummary quotes the thread instead of interpreting it, so nothing written in the
+// thread can influence the labels, the user is asked to review it when they were asked directly.
+// The bullets are written in the language of the digest like the LLM summaries.
+func buildExtractiveSummary(conversationContext ConversationResponseEntry, userId string, language string) GenAiResponse {
+	var s GenAiResponse
+	applyConversationMetadata(&s, conversationContext, userId)
+	s.Language = language
+
+	s.Summary = append(s.Summary, Localisation.T(language, "extractive_notice"))
+	s.Summary = append(s.Summary, Localisation.T(language, "extractive_mention", truncateText(conversationContext.MentionText, maxExtractiveBulletLength)))
+
+	if messageCount := len(conversationContext.Messages); messageCount > 0 {
+		lastMessage := conversationContext.Messages[messageCount-1]
+		if lastMessage.Timestamp != conversationContext.MentionTimestamp {
+			s.Summary = append(s.Summary, Localisation.T(language, "extractive_latest_reply", truncateText(lastMessage.Text, maxExtractiveBulletLength)))
+		}
+	}
+
+	// quotes of the thread are grounded by definition
+	s.Confidence = 1
+	s.Actionable = "No"
+	s.Priority = "P2"
+	if s.AskedDirectly {
+		s.Actionable = "Yes"
+		s.Priority = "P1"
+		s.ActionRequired = append(s.ActionRequired, ActionItem{
+			Description:            Localisation.T(language, "extractive_action"),
+			OwnerUserId:            userId,
+			SourceMessageTimestamp: conversationContext.MentionTimestamp,
+			SourcePermalink:        conversationContext.MentionPermalink,
+			Confidence:             1,
+		})
+	}
+	return s
+}
@@ -0,0 +1,153 @@
+package SummarizeConversations
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"slack-tag-summariser/Repo"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const defaultSummaryCacheTtl = 72 * time.Hour
+
+// bump this whenever the response parsing or the prompt layout changes in a way
+// that makes previously cached summaries unusable
+const promptSchemaVersion = "7"
+
+type SummaryCacheStats struct {
+	Hits   atomic.Int64
+	Misses atomic.Int64
+}
+
+type SummarizeOptions struct {
+	// the mentioned user the summary is written for
+	UserId string
+	// when nil the summary cache is not used
+	DbPool     *pgxpool.Pool
+	CacheStats *SummaryCacheStats
+	// language the summary should be written in, empty means detect it from the thread
+	Language string
+	// already validated with ValidateCustomInstructions
+	CustomInstructions string
+	// overrides GEMINI_MODEL when set
+	Model string
+	// overrides prompt.txt when set, used to compare prompt versions
+	PromptPath string
+	// every LLM call is recorded against the run and the workspace of the user
+	RunId       string
+	WorkspaceId string
+	UsageStats  *LlmUsageStats
+}
+
+func (summarizeOptions SummarizeOptions) getModel() string {
+	if summarizeOptions.Model != "" {
+		return summarizeOptions.Model
+	}
+	return getPrimaryModel()
+}
+
+func getSummaryCacheTtl() time.Duration {
+	return getEnvDurationOrDefault("SUMMARY_CACHE_TTL", defaultSummaryCacheTtl)
+}
+
+func getPromptVersion(promptPath string) string {
+	promptContext, promptReadError := readPromptFile(promptPath)
+	if promptReadError != nil {
+		return promptSchemaVersion
+	}
+	promptHash := sha256.Sum256(promptContext)
+	return promptSchemaVersion + "-" + hex.EncodeToString(promptHash[:6])
+}
+
+func normaliseText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// buildSummaryCacheKey hashes everything that can change the summary, any new reply in the thread changes the key.
+// The prompt is written around the mention, so two mentions in the same thread have keys of their own.
+func buildSummaryCacheKey(conversationContext ConversationResponseEntry, model string, summarizeOptions SummarizeOptions, language string) string {
+	hasher := sha256.New()
+
+	// custom instructions are part of the prompt, changing them has to produce new summaries
+	keyParts := []string{
+		getPromptVersion(summarizeOptions.PromptPath),
+		model,
+		summarizeOptions.UserId,
+		language,
+		summarizeOptions.CustomInstructions,
+		conversationContext.MentionChannelId,
+		conversationContext.ThreadTimestamp,
+		conversationContext.MentionTimestamp,
+		normaliseText(conversationContext.MentionText),
+	}
+	for _, keyPart := range keyParts {
+		hasher.Write([]byte(keyPart))
+		hasher.Write([]byte{0})
+	}
+	for _, msg := range conversationContext.Messages {
+		hasher.Write([]byte(msg.Timestamp))
+		hasher.Write([]byte{0})
+		hasher.Write([]byte(normaliseText(msg.Text)))
+		hasher.Write([]byte{0})
+	}
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+func getCachedSummary(cacheKey string, summarizeOptions SummarizeOptions) (GenAiResponse, bool) {
+	if summarizeOptions.DbPool == nil {
+		return GenAiResponse{}, false
+	}
+
+	cachedSummary, found, getCachedSummaryError := Repo.GetCachedSummary(cacheKey, summarizeOptions.DbPool)
+	if getCachedSummaryError != nil {
+		log.Printf("SummarizeConversations:getCachedSummary#Error reading summary cache: %s", getCachedSummaryError.Error())
+		found = false
+	}
+
+	if summarizeOptions.CacheStats != nil {
+		if found {
+			summarizeOptions.CacheStats.Hits.Add(1)
+		} else {
+			summarizeOptions.CacheStats.Misses.Add(1)
+		}
+	}
+	return cachedSummary, found
+}
+
+// answeredByModel tells whether the response came from the requested model, the model version of the
+// response can carry a "models/" prefix and is empty for providers that do not report it
+func answeredByModel(modelVersion string, requestedModel string) bool {
+	return modelVersion == "" || strings.TrimPrefix(modelVersion, "models/") == requestedModel
+}
+
+func saveCachedSummary(cacheKey string, model string, conversationContext ConversationResponseEntry, summary GenAiResponse, summarizeOptions SummarizeOptions) {
+	if summarizeOptions.DbPool == nil {
+		return
+	}
+	// the key is built from the requested model, a summary of the fallback model must not be served as its result
+	if !answeredByModel(model, summarizeOptions.getModel()) {
+		return
+	}
+	if model == "" {
+		model = summarizeOptions.getModel()
+	}
+
+	cacheEntry := Repo.SummaryCacheEntry{
+		CacheKey:         cacheKey,
+		UserID:           summarizeOptions.UserId,
+		ChannelId:        conversationContext.MentionChannelId,
+		ThreadTimestamp:  conversationContext.ThreadTimestamp,
+		MentionTimestamp: conversationContext.MentionTimestamp,
+		Model:            model,
+		Response:         summary,
+	}
+
+	if saveCachedSummaryError := Repo.SaveCachedSummary(cacheEntry, getSummaryCacheTtl(), summarizeOptions.DbPool); saveCachedSummaryError != nil {
+		log.Printf("SummarizeConversations:saveCachedSummary#Error writing summary cache: %s", saveCachedSummaryError.Error())
+	}
+}
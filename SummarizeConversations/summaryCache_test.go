@@ -0,0 +1,50 @@
+package SummarizeConversations
+
+import (
+	"testing"
+
+	"slack-tag-summariser/Models"
+)
+
+func TestBuildSummaryCacheKeyDiffersPerMention(t *testing.T) {
+	conversationContext := ConversationResponseEntry{
+		MentionChannelId: "C1",
+		MentionTimestamp: "1700000000.000100",
+		MentionText:      "<@U1> can you review this?",
+		ThreadTimestamp:  "1700000000.000100",
+		Messages: []Models.ThreadMessage{
+			{Timestamp: "1700000000.000100", Text: "<@U1> can you review this?"},
+			{Timestamp: "1700000100.000100", Text: "<@U1> and the deploy too"},
+		},
+	}
+	summarizeOptions := SummarizeOptions{UserId: "U1"}
+
+	firstKey := buildSummaryCacheKey(conversationContext, "gemini-2.5-flash", summarizeOptions, "en")
+	if firstKey != buildSummaryCacheKey(conversationContext, "gemini-2.5-flash", summarizeOptions, "en") {
+		t.Fatal("the key of the same mention changed")
+	}
+
+	secondMention := conversationContext
+	secondMention.MentionTimestamp = "1700000100.000100"
+	secondMention.MentionText = "<@U1> and the deploy too"
+	if firstKey == buildSummaryCacheKey(secondMention, "gemini-2.5-flash", summarizeOptions, "en") {
+		t.Fatal("two mentions in the same thread share a key")
+	}
+}
+
+func TestAnsweredByModel(t *testing.T) {
+	tests := []struct {
+		modelVersion string
+		want         bool
+	}{
+		{"gemini-2.5-flash", true},
+		{"models/gemini-2.5-flash", true},
+		{"", true},
+		{"gemini-2.5-flash-lite", false},
+	}
+	for _, test := range tests {
+		if got := answeredByModel(test.modelVersion, "gemini-2.5-flash"); got != test.want {
+			t.Errorf("answeredByModel(%q) = %v, want %v", test.modelVersion, got, test.want)
+		}
+	}
+}
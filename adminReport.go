@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"slack-tag-summariser/Models"
+	"slack-tag-summariser/Repo"
+	"slack-tag-summariser/SummarizeConversations"
+	"strings"
+	"time"
+)
+
+// verifyAdminRequest expects the ADMIN_API_TOKEN as a bearer token, the admin endpoints
+// are disabled while the token is not set
+func verifyAdminRequest(r *http.Request) bool {
+	adminToken := os.Getenv("ADMIN_API_TOKEN")
+	if adminToken == "" {
+		return false
+	}
+	requestToken, hasBearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return hasBearer && subtle.ConstantTimeCompare([]byte(requestToken), []byte(adminToken)) == 1
+}
+
+// HandleAdminUsageReport returns the LLM tokens and cost as JSON
+// e.g. GET /admin/usage?group=workspace&from=2024-05-01&to=2024-06-01
+// group is one of user, run, workspace, model or purpose and defaults to user,
+// the period defaults to the current month, to is exclusive
+func HandleAdminUsageReport(w http.ResponseWriter, r *http.Request) {
+	if !verifyAdminRequest(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	groupBy := query.Get("group")
+	switch groupBy {
+	case "":
+		groupBy = "user"
+	case "user", "run", "workspace", "model", "purpose":
+	default:
+		http.Error(w, "Invalid group, use user, run, workspace, model or purpose", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := now
+	if fromText := query.Get("from"); fromText != "" {
+		parsedFrom, parseError := time.Parse(time.DateOnly, fromText)
+		if parseError != nil {
+			http.Error(w, "Invalid from date, use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		from = parsedFrom
+	}
+	if toText := query.Get("to"); toText != "" {
+		parsedTo, parseError := time.Parse(time.DateOnly, toText)
+		if parseError != nil {
+			http.Error(w, "Invalid to date, use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		to = parsedTo
+	}
+
+	reportRows, reportError := Repo.GetLlmUsageReport(groupBy, from, to, dbPool)
+	if reportError != nil {
+		log.Println("Failed to get the LLM usage report:", reportError)
+		http.Error(w, "Failed to get the usage report", http.StatusInternalServerError)
+		return
+	}
+
+	var totalCostUsd float64
+	for _, row := range reportRows {
+		totalCostUsd += row.CostUsd
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"group":          groupBy,
+		"from":           from.Format(time.DateOnly),
+		"to":             to.Format(time.RFC3339),
+		"total_cost_usd": totalCostUsd,
+		"rows":           reportRows,
+	})
+}
+
+// HandleAdminDigestRuns returns the outcome of the digest of every user as JSON, so a day without
+// mentions (skipped) can be told apart from a broken one (failed)
+// e.g. GET /admin/runs?from=2024-05-01&to=2024-05-07&outcome=failed
+// the period defaults to today in the digest timezone, both dates are inclusive,
+// outcome is one of sent, skipped or failed and defaults to all of them
+func HandleAdminDigestRuns(w http.ResponseWriter, r *http.Request) {
+	if !verifyAdminRequest(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	outcome := query.Get("outcome")
+	switch outcome {
+	case "", Models.DigestRunSent, Models.DigestRunSkipped, Models.DigestRunFailed:
+	default:
+		http.Error(w, "Invalid outcome, use sent, skipped or failed", http.StatusBadRequest)
+		return
+	}
+
+	today := time.Now().In(SummarizeConversations.GetDigestLocation()).Format(time.DateOnly)
+	dates := map[string]string{"from": today, "to": today}
+	for _, key := range []string{"from", "to"} {
+		dateText := query.Get(key)
+		if dateText == "" {
+			continue
+		}
+		if _, parseError := time.Parse(time.DateOnly, dateText); parseError != nil {
+			http.Error(w, "Invalid "+key+" date, use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		dates[key] = dateText
+	}
+
+	digestRuns, getRunsError := Repo.GetDigestRuns(dates["from"], dates["to"], outcome, dbPool)
+	if getRunsError != nil {
+		log.Println("Failed to get the digest runs:", getRunsError)
+		http.Error(w, "Failed to get the digest runs", http.StatusInternalServerError)
+		return
+	}
+
+	outcomeCounts := map[string]int{Models.DigestRunSent: 0, Models.DigestRunSkipped: 0, Models.DigestRunFailed: 0}
+	for _, digestRun := range digestRuns {
+		outcomeCounts[digestRun.Outcome]++
+	}
+	if digestRuns == nil {
+		digestRuns = []Models.DigestRun{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"from":     dates["from"],
+		"to":       dates["to"],
+		"outcomes": outcomeCounts,
+		"runs":     digestRuns,
+	})
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"slack-tag-summariser/Models"
+	"slack-tag-summariser/PublishToSlack"
+	"slack-tag-summariser/Repo"
+	"slack-tag-summariser/SummarizeConversations"
+
+	"github.com/slack-go/slack"
+)
+
+// how many previous days the history selector of the App Home offers
+const maxHomeHistoryDays = 30
+
+// publishAppHome renders the App Home of the user from the stored digests, the latest one when
+// the digest date is empty, the pipeline is never run for it
+func publishAppHome(slackBotApi *slack.Client, userId string, digestDate string) error {
+	userPreferences, getUserPreferencesError := Repo.GetUserPreferences(userId, dbPool)
+	if getUserPreferencesError != nil {
+		return getUserPreferencesError
+	}
+
+	digestDates, getDigestDatesError := Repo.GetDigestDates(userId, maxHomeHistoryDays, dbPool)
+	if getDigestDatesError != nil {
+		return getDigestDatesError
+	}
+
+	home := PublishToSlack.AppHome{
+		Preferences: userPreferences,
+		DigestDates: digestDates,
+		ItemStates:  make(map[string]Models.DigestItem),
+		Location:    SummarizeConversations.GetDigestLocation(),
+	}
+
+	storedDigest, digestExists, getDigestError := Repo.GetDigest(userId, digestDate, dbPool)
+	if getDigestError != nil {
+		return getDigestError
+	}
+	if digestExists {
+		home.Digest = &storedDigest
+	}
+
+	digestItems, getDigestItemsError := Repo.GetActedOnDigestItems(userId, dbPool)
+	if getDigestItemsError != nil {
+		return getDigestItemsError
+	}
+	for _, item := range digestItems {
+		home.ItemStates[PublishToSlack.DigestItemKey(item.ChannelId, item.MentionTimestamp)] = item
+	}
+
+	return PublishToSlack.PublishAppHome(slackBotApi, userId, PublishToSlack.BuildAppHomeView(home))
+}
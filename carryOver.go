@@ -0,0 +1,151 @@
+package main
+
+import (
+	"log"
+	"os"
+	"slack-tag-summariser/GetConversations"
+	"slack-tag-summariser/Models"
+	"slack-tag-summariser/PublishToSlack"
+	"slack-tag-summariser/RankSummaries"
+	"slack-tag-summariser/Repo"
+	"slack-tag-summariser/SummarizeConversations"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// at most this many open mentions are carried over, the most urgent first
+const maxCarryOverItems = 10
+
+// CARRY_OVER_DAYS is how many days after its first digest an open mention is still carried over, 14 by default
+func getCarryOverDays() int {
+	carryOverDays, parseError := strconv.Atoi(os.Getenv("CARRY_OVER_DAYS"))
+	if parseError != nil || carryOverDays < 0 {
+		return 14
+	}
+	return carryOverDays
+}
+
+// parseSlackTimestampTime reads the time of a slack timestamp e.g. "1700000000.000100"
+func parseSlackTimestampTime(slackTimestamp string) (time.Time, bool) {
+	seconds, _, _ := strings.Cut(slackTimestamp, ".")
+	unixSeconds, parseError := strconv.ParseInt(seconds, 10, 64)
+	if parseError != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(unixSeconds, 0), true
+}
+
+type carryOverCandidate struct {
+	item Models.CarryOverItem
+	// when the mention was last in a digest, the replies after it are new
+	lastShownAt time.Time
+}
+
+// checkCarryOverThread reads the thread of the mention again, the mention is resolved once the user replied
+// in it after being mentioned. A thread that cannot be read keeps the mention open.
+func checkCarryOverThread(slackApi *slack.Client, userId string, candidate carryOverCandidate) (Models.CarryOverItem, bool) {
+	r := candidate.item.Response
+	// the thread of the mention is found from its permalink, like for the snoozed mentions
+	conversation := GetConversations.GetConversation(slackApi, slack.SearchMessage{
+		Type:      "message",
+		Channel:   slack.CtxChannel{ID: r.MentionChannelId},
+		User:      r.MentionUserId,
+		Timestamp: r.MentionTimestamp,
+		Permalink: r.MentionPermalink,
+	})
+
+	item := candidate.item
+	item.NewReplies = 0
+	mentionTime, _ := parseSlackTimestampTime(r.MentionTimestamp)
+	for _, message := range conversation.Messages {
+		messageTime, ok := parseSlackTimestampTime(message.Timestamp)
+		if !ok || !messageTime.After(mentionTime) {
+			continue
+		}
+		if message.User == userId {
+			return item, false
+		}
+		if messageTime.After(candidate.lastShownAt) {
+			item.NewReplies++
+		}
+	}
+	return item, true
+}
+
+// getCarryOverItems returns the actionable mentions of the earlier digests that are still open, the user
+// neither acted on them with the buttons nor replied in their thread. The mentions found again today are
+// left out as they are in the digest anyway.
+func getCarryOverItems(slackApi *slack.Client, userId string, digestDate string, todaysMentions []slack.SearchMessage, digestItems []Models.DigestItem, now time.Time) []Models.CarryOverItem {
+	carryOverDays := getCarryOverDays()
+	if carryOverDays == 0 {
+		return nil
+	}
+	fromDate := now.In(SummarizeConversations.GetDigestLocation()).AddDate(0, 0, -carryOverDays).Format(time.DateOnly)
+	earlierDigests, getDigestsError := Repo.GetDigestsBetween(userId, fromDate, digestDate, dbPool)
+	if getDigestsError != nil {
+		log.Println("Failed to get the earlier digests:", getDigestsError, "for user:", userId)
+		return nil
+	}
+
+	skippedKeys := make(map[string]struct{})
+	for _, item := range digestItems {
+		skippedKeys[PublishToSlack.DigestItemKey(item.ChannelId, item.MentionTimestamp)] = struct{}{}
+	}
+	for _, mention := range todaysMentions {
+		skippedKeys[PublishToSlack.DigestItemKey(mention.Channel.ID, mention.Timestamp)] = struct{}{}
+	}
+
+	// the newest summary of each mention is kept, with the day it was first shown and when it was shown last
+	var candidateKeys []string
+	candidates := make(map[string]*carryOverCandidate)
+	addCandidate := func(r Models.GenAiResponse, firstDigestDate string, shownAt time.Time) {
+		key := PublishToSlack.DigestItemKey(r.MentionChannelId, r.MentionTimestamp)
+		if _, skipped := skippedKeys[key]; skipped || r.MentionChannelId == "" || r.MentionTimestamp == "" || strings.ToLower(r.Actionable) != "yes" {
+			return
+		}
+		candidate, exists := candidates[key]
+		if !exists {
+			candidate = &carryOverCandidate{item: Models.CarryOverItem{FirstDigestDate: firstDigestDate}}
+			candidates[key] = candidate
+			candidateKeys = append(candidateKeys, key)
+		}
+		candidate.item.Response = r
+		candidate.item.FirstDigestDate = min(candidate.item.FirstDigestDate, firstDigestDate)
+		candidate.lastShownAt = shownAt
+	}
+	for _, digest := range earlierDigests {
+		for _, r := range digest.Responses {
+			addCandidate(r, digest.DigestDate, digest.CreatedAt)
+		}
+		for _, carried := range digest.CarryOver {
+			addCandidate(carried.Response, carried.FirstDigestDate, digest.CreatedAt)
+		}
+	}
+
+	// the most urgent first, the oldest first within a priority
+	slices.SortStableFunc(candidateKeys, func(a string, b string) int {
+		return RankSummaries.PriorityRank(candidates[a].item.Response.Priority) - RankSummaries.PriorityRank(candidates[b].item.Response.Priority)
+	})
+
+	var carryOverItems []Models.CarryOverItem
+	for _, key := range candidateKeys {
+		candidate := candidates[key]
+		// the carried over mentions stay within the window of their first digest
+		if candidate.item.FirstDigestDate < fromDate {
+			continue
+		}
+		item, open := checkCarryOverThread(slackApi, userId, *candidate)
+		if !open {
+			continue
+		}
+		carryOverItems = append(carryOverItems, item)
+		if len(carryOverItems) == maxCarryOverItems {
+			break
+		}
+	}
+	return carryOverItems
+}
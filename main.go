@@ -2,16 +2,24 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"slack-tag-summariser/EvalSummaries"
 	"slack-tag-summariser/GetConversations"
 	"slack-tag-summariser/GetMentions"
+	"slack-tag-summariser/Localisation"
 	"slack-tag-summariser/Models"
+	"slack-tag-summariser/PublishDigest"
 	"slack-tag-summariser/PublishToSlack"
+	"slack-tag-summariser/RankSummaries"
+	"slack-tag-summariser/RenderDigest"
 	"slack-tag-summariser/Repo"
 	"slack-tag-summariser/SummarizeConversations"
+	"strings"
 	"sync"
 	"time"
 
@@ -27,14 +35,231 @@ var dbPool *pgxpool.Pool
 
 type GenAiResponse = Models.GenAiResponse
 
-func processUser(slackApi *slack.Client, slackBotApi *slack.Client, genAiClient *genai.Client, ctx context.Context, userId string) (bool, error) {
+// processUser sends the digest of the day to the user, the returned run says whether something was
+// sent and is recorded by the caller together with the error
+func processUser(slackApi *slack.Client, slackBotApi *slack.Client, genAiClient *genai.Client, ctx context.Context, userId string, runId string, cacheStats *SummarizeConversations.SummaryCacheStats, usageStats *SummarizeConversations.LlmUsageStats) (Models.DigestRun, error) {
+	digestRun := Models.DigestRun{
+		RunId:      runId,
+		UserID:     userId,
+		DigestDate: time.Now().In(SummarizeConversations.GetDigestLocation()).Format(time.DateOnly),
+	}
 
 	// GET mentions for the user in the last day
 	mentions, getMentionsError := GetMentions.GetMentions(slackApi, userId)
 
 	if getMentionsError != nil {
-		return false, getMentionsError
+		return digestRun, getMentionsError
+	}
+
+	// mentions marked as done or not relevant are left out and snoozed ones come back once they are due
+	digestItems, getDigestItemsError := Repo.GetActedOnDigestItems(userId, dbPool)
+	if getDigestItemsError != nil {
+		log.Println("Failed to get digest items:", getDigestItemsError, "for user:", userId)
+	}
+	mentions = GetMentions.ApplyDigestItems(mentions, digestItems, time.Now())
+
+	// a failed lookup falls back to the defaults, it should not cost the user their digest
+	userPreferences, getUserPreferencesError := Repo.GetUserPreferences(userId, dbPool)
+	if getUserPreferencesError != nil {
+		log.Println("Failed to get user preferences:", getUserPreferencesError, "for user:", userId)
+	}
+
+	// the priority routes of the user decide which mentions make it into the digest, the mentions held
+	// back for the weekly digest of the last days come back on the day of the quiet week recap
+	routingPolicy := PublishDigest.NewRoutingPolicy(userPreferences.PriorityRoutes)
+	weeklyDigest := time.Now().In(SummarizeConversations.GetDigestLocation()).Weekday() == getQuietWeekRecapDay()
+	var heldResponses []GenAiResponse
+	if weeklyDigest {
+		heldResponses = getHeldWeeklyResponses(userId, routingPolicy, digestItems, time.Now())
+	}
+
+	// the actionable mentions of earlier digests stay in a "still waiting on you" section until they are resolved,
+	// even once they are too old to be found by the search
+	carryOverItems := getCarryOverItems(slackApi, userId, digestRun.DigestDate, mentions, digestItems, time.Now())
+
+	if len(mentions) == 0 && len(heldResponses) == 0 && len(carryOverItems) == 0 {
+		return sendEmptyDigest(ctx, slackBotApi, userId, userPreferences, digestRun)
+	}
+
+	summarizeOptions := newSummarizeOptions(slackApi, ctx, userId, runId, userPreferences, cacheStats, usageStats)
+	genAiResponses := summarizeMentions(slackApi, genAiClient, ctx, mentions, summarizeOptions)
+
+	// the category filter of the user is applied before ranking so the overview only covers what is shown
+	genAiResponses, hiddenCount := SummarizeConversations.FilterByCategory(genAiResponses, userPreferences.CategoryFilter)
+
+	// there were mentions, so nothing to show means the summaries failed and not a quiet day
+	if len(mentions) > 0 && len(genAiResponses) == 0 && hiddenCount == 0 {
+		return digestRun, fmt.Errorf("none of the %d mentions could be summarised", len(mentions))
+	}
+
+	// the held mentions were filtered when they were batched, the ones found again today are summarised again
+	summarisedKeys := make(map[string]struct{}, len(genAiResponses))
+	for _, genAiResponse := range genAiResponses {
+		summarisedKeys[PublishToSlack.DigestItemKey(genAiResponse.MentionChannelId, genAiResponse.MentionTimestamp)] = struct{}{}
+	}
+	for _, heldResponse := range heldResponses {
+		if _, summarised := summarisedKeys[PublishToSlack.DigestItemKey(heldResponse.MentionChannelId, heldResponse.MentionTimestamp)]; !summarised {
+			genAiResponses = append(genAiResponses, heldResponse)
+		}
+	}
+
+	// channels the user keeps marking as not relevant rank lower
+	notRelevantByChannel, getNotRelevantError := Repo.GetNotRelevantCountsByChannel(userId, time.Now().Add(-notRelevantFeedbackWindow), dbPool)
+	if getNotRelevantError != nil {
+		log.Println("Failed to get not relevant feedback:", getNotRelevantError, "for user:", userId)
 	}
+
+	// rank the GenAI responses before sending it to the user
+	// the LLM priority is combined with deadlines, mention age, VIP senders, channel weights and the feedback of the user
+	RankSummaries.RankGenAiResponses(genAiResponses, time.Now(), RankSummaries.UserFeedback{NotRelevantByChannel: notRelevantByChannel})
+
+	// the batched mentions are only listed in the App Home, the urgent ones were already sent on their own
+	// and are in the digest as well
+	genAiResponses, batchedResponses := routingPolicy.SplitDigest(genAiResponses, weeklyDigest)
+
+	// without a preference the digest uses the language most of the threads were in
+	digestLanguage := userPreferences.Language
+	if digestLanguage == "" {
+		var summaryLanguages []string
+		for _, genAiResponse := range genAiResponses {
+			summaryLanguages = append(summaryLanguages, genAiResponse.Language)
+		}
+		digestLanguage = Localisation.DominantLanguage(summaryLanguages)
+	}
+
+	// a day with only batched mentions does not notify the user, they are still kept for the App Home
+	// and the weekly digest
+	if len(genAiResponses) == 0 && len(batchedResponses) > 0 && len(carryOverItems) == 0 {
+		digestRun.Outcome = Models.DigestRunSkipped
+		digestRun.Detail = "batched"
+		saveDigestError := Repo.SaveDigest(Models.StoredDigest{
+			UserID:      userId,
+			DigestDate:  digestRun.DigestDate,
+			Language:    digestLanguage,
+			HiddenCount: hiddenCount,
+			Batched:     batchedResponses,
+		}, dbPool)
+		if saveDigestError != nil {
+			return digestRun, saveDigestError
+		}
+		if publishHomeError := publishAppHome(slackBotApi, userId, ""); publishHomeError != nil {
+			log.Println("Failed to publish the App Home:", publishHomeError, "for user:", userId)
+		}
+		return digestRun, nil
+	}
+
+	// second stage call over all the summaries for the "today at a glance" section
+	// the digest is still sent without it if it fails
+	digestOverview, digestOverviewError := SummarizeConversations.SummarizeDigestOverview(genAiResponses, digestLanguage, genAiClient.Models, ctx, summarizeOptions)
+	if digestOverviewError != nil {
+		log.Println("Digest overview failed:", digestOverviewError, "for user:", userId)
+	}
+
+	// a re-run on the same day updates the digest already sent, the previous one is needed for the changes since then
+	var previousDigest *Models.StoredDigest
+	storedDigest, digestExists, getDigestError := Repo.GetDigest(userId, digestRun.DigestDate, dbPool)
+	if getDigestError != nil {
+		log.Println("Failed to get the previous digest:", getDigestError, "for user:", userId)
+	} else if digestExists {
+		previousDigest = &storedDigest
+	}
+
+	// finally we have the summaries for the user now we need to publish them to every target the user chose
+	publishers := PublishDigest.NewPublishers(userPreferences.DeliveryTargets, slackBotApi)
+	sentCount, publishErr := PublishDigest.PublishToTargets(ctx, publishers, PublishDigest.Digest{
+		UserID: userId,
+		Options: PublishToSlack.DigestOptions{
+			Language:        digestLanguage,
+			GroupByCategory: userPreferences.GroupByCategory,
+			HiddenCount:     hiddenCount,
+			DigestDate:      digestRun.DigestDate,
+			DbPool:          dbPool,
+			PreviousDigest:  previousDigest,
+			WorkspaceId:     summarizeOptions.WorkspaceId,
+			CarryOver:       carryOverItems,
+		},
+		Overview:  digestOverview,
+		Responses: genAiResponses,
+	}, dbPool)
+
+	if sentCount == 0 {
+		return digestRun, publishErr
+	}
+	// the failed targets are recorded on their own, the digest still reached the user
+	if publishErr != nil {
+		log.Println("Failed to publish the digest to some targets:", publishErr, "for user:", userId)
+	}
+	digestRun.Outcome = Models.DigestRunSent
+	digestRun.Detail = "digest"
+	digestRun.MentionCount = len(genAiResponses)
+
+	// kept so the App Home and the history can show the digest without running the pipeline again
+	saveDigestError := Repo.SaveDigest(Models.StoredDigest{
+		UserID:      userId,
+		DigestDate:  digestRun.DigestDate,
+		Language:    digestLanguage,
+		Overview:    digestOverview,
+		Responses:   genAiResponses,
+		HiddenCount: hiddenCount,
+		Batched:     batchedResponses,
+		CarryOver:   carryOverItems,
+	}, dbPool)
+	if saveDigestError != nil {
+		log.Println("Failed to save the digest:", saveDigestError, "for user:", userId)
+	} else if publishHomeError := publishAppHome(slackBotApi, userId, ""); publishHomeError != nil {
+		log.Println("Failed to publish the App Home:", publishHomeError, "for user:", userId)
+	}
+
+	// the buttons of the digest act on these items, snoozed items that were shown again are open again
+	var sentItems []Models.DigestItem
+	for _, genAiResponse := range genAiResponses {
+		if genAiResponse.MentionChannelId == "" || genAiResponse.MentionTimestamp == "" {
+			continue
+		}
+		sentItems = append(sentItems, Models.DigestItem{
+			ChannelId:        genAiResponse.MentionChannelId,
+			MentionTimestamp: genAiResponse.MentionTimestamp,
+			MentionPermalink: genAiResponse.MentionPermalink,
+			MentionUserId:    genAiResponse.MentionUserId,
+		})
+	}
+	if saveItemsError := Repo.SaveDigestItems(userId, sentItems, dbPool); saveItemsError != nil {
+		log.Println("Failed to save digest items:", saveItemsError, "for user:", userId)
+	}
+	return digestRun, nil
+}
+
+// newSummarizeOptions is how the mentions of the user are summarised, the workspace decides the budget
+func newSummarizeOptions(slackApi *slack.Client, ctx context.Context, userId string, runId string, userPreferences Models.UserPreferences, cacheStats *SummarizeConversations.SummaryCacheStats, usageStats *SummarizeConversations.LlmUsageStats) SummarizeConversations.SummarizeOptions {
+	summarizeOptions := SummarizeConversations.SummarizeOptions{
+		UserId:     userId,
+		DbPool:     dbPool,
+		CacheStats: cacheStats,
+		Language:   userPreferences.Language,
+		// instructions are validated again in case the limits changed since they were saved
+		CustomInstructions: validatedCustomInstructions(userPreferences.CustomInstructions, userId),
+		RunId:              runId,
+		UsageStats:         usageStats,
+	}
+
+	// the LLM cost is tracked per workspace, without it the usage is still recorded but no budget applies
+	authTestResponse, authTestError := slackApi.AuthTestContext(ctx)
+	if authTestError != nil {
+		log.Println("Failed to get the workspace:", authTestError, "for user:", userId)
+	} else {
+		summarizeOptions.WorkspaceId = authTestResponse.TeamID
+	}
+
+	// a workspace over its monthly budget is summarised with the cheaper model until the month is over
+	if budgetModel := SummarizeConversations.GetBudgetModel(summarizeOptions.WorkspaceId, time.Now(), dbPool); budgetModel != "" {
+		summarizeOptions.Model = budgetModel
+	}
+	return summarizeOptions
+}
+
+// summarizeMentions gets the thread of every mention and summarises them, the mentions that could not
+// be summarised are left out
+func summarizeMentions(slackApi *slack.Client, genAiClient *genai.Client, ctx context.Context, mentions []slack.SearchMessage, summarizeOptions SummarizeConversations.SummarizeOptions) []GenAiResponse {
 	// make a channel to save the threads for each mention to get asynchronously
 	conversationsChan := make(chan ConversationResponseEntry, len(mentions))
 	// initialise a wait group to wait for all the go routines to finish
@@ -69,41 +294,173 @@ func processUser(slackApi *slack.Client, slackBotApi *slack.Client, genAiClient
 	// initialise a wait group to wait for all the go routines to finish GenAIResponse
 	var completeGenAiResponse sync.WaitGroup
 
-	// iterate through the channel and process the AI response
-	for conversationContext := range conversationsChan {
-		// increase the counter for the wait group as we are starting a new go routine
-		completeGenAiResponse.Add(1)
-		go func(cc ConversationResponseEntry, genAiClient *genai.Client, ctx context.Context) {
-			// done is added to decrement the count the wait group once the go routine is done executing
-			defer completeGenAiResponse.Done()
+	if SummarizeConversations.IsBatchingEnabled() {
+		// small threads share LLM requests, anything that fails in a batch is retried on its own
+		var conversationContexts []ConversationResponseEntry
+		for conversationContext := range conversationsChan {
+			conversationContexts = append(conversationContexts, conversationContext)
+		}
+		genAiResponses = SummarizeConversations.SummarizeConversationsInBatches(conversationContexts, genAiClient.Models, ctx, summarizeOptions)
+	} else {
+		// iterate through the channel and process the AI response
+		for conversationContext := range conversationsChan {
+			// increase the counter for the wait group as we are starting a new go routine
+			completeGenAiResponse.Add(1)
+			go func(cc ConversationResponseEntry, genAiClient *genai.Client, ctx context.Context) {
+				// done is added to decrement the count the wait group once the go routine is done executing
+				defer completeGenAiResponse.Done()
+
+				// we will get the GenAI response for each conversation context
+				genAiResponse, genAiResponseError := SummarizeConversations.SummarizeSingleConversation(cc, genAiClient.Models, ctx, summarizeOptions)
+
+				// a failed summary should not end up as an empty card in the DM
+				if genAiResponseError != nil {
+					log.Println("Summarize conversation failed:", genAiResponseError, "for mention:", cc.MentionPermalink)
+					return
+				}
+
+				// save the genAi response in the channel
+				genAiSummaryChan <- genAiResponse
+			}(conversationContext, genAiClient, ctx)
+		}
 
-			// we will get the GenAI response for each conversation context
-			genAiResponse := SummarizeConversations.SummarizeSingleConversation(cc, genAiClient, ctx)
+		completeGenAiResponse.Wait()
+		close(genAiSummaryChan)
 
-			// save the genAi response in the channel
-			genAiSummaryChan <- genAiResponse
-		}(conversationContext, genAiClient, ctx)
+		// iterate the genAiSummaryChan to get the summaries for each conversation
+		// save it in the genAiResponses slice
+		for genAiSummary := range genAiSummaryChan {
+			genAiResponses = append(genAiResponses, genAiSummary)
+		}
 	}
+	return genAiResponses
+}
 
-	completeGenAiResponse.Wait()
-	close(genAiSummaryChan)
+// getHeldWeeklyResponses returns the mentions of the last week that were held back for the weekly digest
+// and that the user did not act on since, the newest summary of each
+func getHeldWeeklyResponses(userId string, routingPolicy PublishDigest.RoutingPolicy, digestItems []Models.DigestItem, now time.Time) []GenAiResponse {
+	fromDate := now.In(SummarizeConversations.GetDigestLocation()).AddDate(0, 0, -7).Format(time.DateOnly)
+	batchedResponses, getBatchedError := Repo.GetBatchedSince(userId, fromDate, dbPool)
+	if getBatchedError != nil {
+		log.Println("Failed to get the batched mentions:", getBatchedError, "for user:", userId)
+		return nil
+	}
 
-	// iterate the genAiSummaryChan to get the summaries for each conversation
-	// save it in the genAiResponses slice
-	for genAiSummary := range genAiSummaryChan {
-		genAiResponses = append(genAiResponses, genAiSummary)
+	actedOnKeys := make(map[string]struct{}, len(digestItems))
+	for _, item := range digestItems {
+		if item.State == Models.DigestItemSnoozed && (item.SnoozedUntil == nil || !item.SnoozedUntil.After(now)) {
+			continue
+		}
+		actedOnKeys[PublishToSlack.DigestItemKey(item.ChannelId, item.MentionTimestamp)] = struct{}{}
+	}
+
+	var heldResponses []GenAiResponse
+	for i := len(batchedResponses) - 1; i >= 0; i-- {
+		batchedResponse := batchedResponses[i]
+		key := PublishToSlack.DigestItemKey(batchedResponse.MentionChannelId, batchedResponse.MentionTimestamp)
+		if _, actedOn := actedOnKeys[key]; actedOn || routingPolicy.Route(batchedResponse) != Models.PriorityRouteWeekly {
+			continue
+		}
+		// a mention found on two days was batched twice
+		actedOnKeys[key] = struct{}{}
+		heldResponses = append(heldResponses, batchedResponse)
+	}
+	return heldResponses
+}
+
+// QUIET_WEEK_RECAP_DAY is the weekday the quiet week recap is sent on, Friday by default
+func getQuietWeekRecapDay() time.Weekday {
+	recapDay := os.Getenv("QUIET_WEEK_RECAP_DAY")
+	for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+		if strings.EqualFold(weekday.String(), recapDay) {
+			return weekday
+		}
 	}
+	return time.Friday
+}
+
+// publishDigestNote sends the note to every target the user chose, like the digest it would replace
+func publishDigestNote(ctx context.Context, slackBotApi *slack.Client, userId string, userPreferences Models.UserPreferences, digestOptions PublishToSlack.DigestOptions, note PublishToSlack.DigestNote) error {
+	publishers := PublishDigest.NewPublishers(userPreferences.DeliveryTargets, slackBotApi)
+	sentCount, publishError := PublishDigest.PublishToTargets(ctx, publishers, PublishDigest.Digest{
+		UserID:  userId,
+		Options: digestOptions,
+		Note:    &note,
+	}, dbPool)
+	if sentCount == 0 {
+		return publishError
+	}
+	if publishError != nil {
+		log.Println("Failed to publish the note to some targets:", publishError, "for user:", userId)
+	}
+	return nil
+}
+
+// sendEmptyDigest follows the empty digest policy of the user on a day without mentions
+func sendEmptyDigest(ctx context.Context, slackBotApi *slack.Client, userId string, userPreferences Models.UserPreferences, digestRun Models.DigestRun) (Models.DigestRun, error) {
+	digestOptions := PublishToSlack.DigestOptions{
+		Language:   userPreferences.Language,
+		DigestDate: digestRun.DigestDate,
+		DbPool:     dbPool,
+	}
+	if digestOptions.Language == "" {
+		digestOptions.Language = Localisation.DefaultLanguage
+	}
+
+	digestRun.Outcome = Models.DigestRunSkipped
+	digestRun.Detail = "no_mentions"
+
+	emptyDigestPolicy := userPreferences.EmptyDigestPolicy
+	if emptyDigestPolicy == "" {
+		emptyDigestPolicy = Models.DefaultEmptyDigestPolicy
+	}
+
+	switch emptyDigestPolicy {
+	case Models.EmptyDigestSkip:
+		return digestRun, nil
 
-	// sort the GenAI responses by priority before sending it to the user
-	SummarizeConversations.SortGenAiResponsesByPriority(genAiResponses)
+	case Models.EmptyDigestInboxZero:
+		if publishNoteError := publishDigestNote(ctx, slackBotApi, userId, userPreferences, digestOptions, PublishToSlack.InboxZeroNote(digestOptions.Language)); publishNoteError != nil {
+			return digestRun, publishNoteError
+		}
+		digestRun.Outcome = Models.DigestRunSent
+		digestRun.Detail = Models.EmptyDigestInboxZero
+		return digestRun, nil
+
+	case Models.EmptyDigestQuietWeek:
+		now := time.Now().In(SummarizeConversations.GetDigestLocation())
+		if now.Weekday() != getQuietWeekRecapDay() {
+			return digestRun, nil
+		}
+		weekTotals, getTotalsError := Repo.GetDigestRunTotals(userId, now.AddDate(0, 0, -7), dbPool)
+		if getTotalsError != nil {
+			return digestRun, getTotalsError
+		}
+		recapNote := PublishToSlack.QuietWeekRecapNote(digestOptions.Language, weekTotals)
+		if publishRecapError := publishDigestNote(ctx, slackBotApi, userId, userPreferences, digestOptions, recapNote); publishRecapError != nil {
+			return digestRun, publishRecapError
+		}
+		digestRun.Outcome = Models.DigestRunSent
+		digestRun.Detail = Models.EmptyDigestQuietWeek
+		return digestRun, nil
+
+	default:
+		// a policy that is not known anymore sends nothing rather than guessing
+		log.Println("Unknown empty digest policy:", emptyDigestPolicy, "for user:", userId)
+		return digestRun, nil
+	}
+}
 
-	// finally we have the summaries for the user now we need to publish it to them in slack DM
-	sendSlackDmRes, sendSlackDmErr := PublishToSlack.SendSlackDm(slackBotApi, userId, genAiResponses)
+// how far back the "not relevant" buttons count towards the ranking
+const notRelevantFeedbackWindow = 30 * 24 * time.Hour
 
-	if sendSlackDmErr != nil {
-		return false, sendSlackDmErr
+func validatedCustomInstructions(customInstructions string, userId string) string {
+	validInstructions, validationError := SummarizeConversations.ValidateCustomInstructions(customInstructions)
+	if validationError != nil {
+		log.Println("Ignoring invalid custom instructions:", validationError, "for user:", userId)
+		return ""
 	}
-	return sendSlackDmRes, nil
+	return validInstructions
 }
 
 func HandleSlackRedirect(w http.ResponseWriter, r *http.Request) {
@@ -160,6 +517,13 @@ func HandleSlackRedirect(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprint(w, "<h1>Success!</h1><p>The summarizer is now active for your account.</p>")
 }
 
+// newRunId starts with the time of the run so the IDs sort in the usage report
+func newRunId(startedAt time.Time) string {
+	randomSuffix := make([]byte, 4)
+	_, _ = rand.Read(randomSuffix)
+	return startedAt.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(randomSuffix)
+}
+
 func handleDailyCronTrigger() {
 
 	slackBotToken := os.Getenv("SLACK_BOT_TOKEN")
@@ -168,7 +532,14 @@ func handleDailyCronTrigger() {
 
 	//Gemini setup
 	geminiApiKey = os.Getenv("GEMINI_API_KEY")
-	ctx := context.Background()
+
+	// every LLM call of the run derives its timeout from this context
+	runTimeout, runTimeoutParseError := time.ParseDuration(os.Getenv("DIGEST_RUN_TIMEOUT"))
+	if runTimeoutParseError != nil || runTimeout <= 0 {
+		runTimeout = 30 * time.Minute
+	}
+	ctx, cancelRun := context.WithTimeout(context.Background(), runTimeout)
+	defer cancelRun()
 
 	genAiClient, genAiError := genai.NewClient(ctx, &genai.ClientConfig{
 		APIKey:  geminiApiKey,
@@ -186,23 +557,60 @@ func handleDailyCronTrigger() {
 		return
 	}
 
+	// drop expired summaries so the cache table does not grow forever
+	if _, deleteExpiredError := Repo.DeleteExpiredSummaries(dbPool); deleteExpiredError != nil {
+		log.Println("Failed to delete expired summaries:", deleteExpiredError)
+	}
+	var cacheStats SummarizeConversations.SummaryCacheStats
+	var usageStats SummarizeConversations.LlmUsageStats
+	runId := newRunId(time.Now())
+
+	// wait for every user before the run context is cancelled
+	var completeUsers sync.WaitGroup
+
 	for _, user := range installedUsers {
 
 		accessToken := user.UserToken
 		userId := user.UserID
 		slackApi := slack.New(accessToken)
 
+		completeUsers.Add(1)
 		go func(userId string, slackApi *slack.Client, slackBotApi *slack.Client, ctx context.Context) {
-			_, processUserErr := processUser(slackApi, slackBotApi, genAiClient, ctx, userId)
+			defer completeUsers.Done()
+			digestRun, processUserErr := processUser(slackApi, slackBotApi, genAiClient, ctx, userId, runId, &cacheStats, &usageStats)
 			if processUserErr != nil {
 				log.Println("Scheduled Process User Error:", processUserErr, "for user:", userId)
+				digestRun.Outcome = Models.DigestRunFailed
+				digestRun.Detail = processUserErr.Error()
+			}
+			// recorded so an empty day can be told apart from a broken one, see /admin/runs
+			if saveRunError := Repo.SaveDigestRun(digestRun, dbPool); saveRunError != nil {
+				log.Println("Failed to save the digest run:", saveRunError, "for user:", userId)
 			}
 		}(userId, slackApi, slackBotApi, ctx)
 	}
+	completeUsers.Wait()
+
+	log.Println("Summary cache hits:", cacheStats.Hits.Load(), "misses:", cacheStats.Misses.Load())
+	log.Printf("LLM usage for run %s: %d calls, %d prompt tokens, %d candidate tokens, $%.4f", runId,
+		usageStats.Calls.Load(), usageStats.PromptTokens.Load(), usageStats.CandidateTokens.Load(), usageStats.CostUsd())
 }
 
 func main() {
 
+	// `go run . eval ...` scores the summariser against recorded fixtures instead of starting the server
+	if len(os.Args) > 1 && os.Args[1] == "eval" {
+		os.Exit(EvalSummaries.RunEvalCommand(os.Args[2:], os.Stdout))
+	}
+
+	// `go run . preview ...` renders a stored digest with the templates of a workspace for review
+	if len(os.Args) > 1 && os.Args[1] == "preview" {
+		if dbInitialisationError := Repo.InitDbPool(&dbPool); dbInitialisationError != nil {
+			log.Fatal("Failed to initialise DB:", dbInitialisationError)
+		}
+		os.Exit(RenderDigest.RunPreviewCommand(os.Args[2:], os.Stdout, dbPool))
+	}
+
 	//err := godotenv.Load()
 	//if err != nil {
 	//	log.Fatal("Error loading .env file")
@@ -216,6 +624,10 @@ func main() {
 		log.Fatal("Failed to initialise DB:", dbInitialisationError)
 	}
 
+	if dbSchemaError := Repo.InitDbSchema(dbPool); dbSchemaError != nil {
+		log.Fatal("Failed to initialise DB schema:", dbSchemaError)
+	}
+
 	c := cron.New()
 	_, cronInitialiseErr := c.AddFunc("0 8 * * *", func() {
 		handleDailyCronTrigger()
@@ -224,9 +636,24 @@ func main() {
 	if cronInitialiseErr != nil {
 		log.Fatal("Failed to schedule cron job:", cronInitialiseErr)
 	}
+
+	// urgent mentions are sent on their own between two digests, see PublishDigest.RoutingPolicy
+	if urgentCheckInterval, urgentChecksEnabled := getUrgentCheckInterval(); urgentChecksEnabled {
+		_, urgentCronInitialiseErr := c.AddFunc(fmt.Sprintf("@every %s", urgentCheckInterval), func() {
+			handleUrgentCronTrigger(urgentCheckInterval)
+		})
+		if urgentCronInitialiseErr != nil {
+			log.Fatal("Failed to schedule the urgent check:", urgentCronInitialiseErr)
+		}
+	}
 	c.Start()
 
 	http.HandleFunc("/slack/oauth/callback", HandleSlackRedirect)
+	http.HandleFunc("/slack/commands", HandleSlackCommand)
+	http.HandleFunc("/slack/interactions", HandleSlackInteraction)
+	http.HandleFunc("/slack/events", HandleSlackEvent)
+	http.HandleFunc("/admin/usage", HandleAdminUsageReport)
+	http.HandleFunc("/admin/runs", HandleAdminDigestRuns)
 
 	// Health endpoint
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slack-tag-summariser/Localisation"
+	"slack-tag-summariser/Models"
+	"slack-tag-summariser/PublishDigest"
+	"slack-tag-summariser/Repo"
+	"slack-tag-summariser/SummarizeConversations"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/slack-go/slack"
+)
+
+// verifySlackRequest checks the signing secret of a request coming from slack
+// the body is put back on the request so it can still be parsed afterwards
+func verifySlackRequest(r *http.Request) error {
+	verifier, verifierError := slack.NewSecretsVerifier(r.Header, os.Getenv("SLACK_SIGNING_SECRET"))
+	if verifierError != nil {
+		return verifierError
+	}
+
+	body, readBodyError := io.ReadAll(r.Body)
+	if readBodyError != nil {
+		return readBodyError
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	if _, writeError := verifier.Write(body); writeError != nil {
+		return writeError
+	}
+	return verifier.Ensure()
+}
+
+const slashCommandHelp = "Usage:\n" +
+	"• `language` shows the language of your digest\n" +
+	"• `language <code>` sets it, one of: %s\n" +
+	"• `language auto` writes each summary in the language of its thread\n" +
+	"• `instructions` shows your custom instructions\n" +
+	"• `instructions set <text>` sets them e.g. `instructions set always flag anything about billing as P0`\n" +
+	"• `instructions clear` removes them\n" +
+	"• `group category` shows your digest in one section per category, `group none` turns it off\n" +
+	"• `filter <category> ...` only shows these categories, one or more of: %s\n" +
+	"• `filter all` shows every category again\n" +
+	"• `empty` shows what happens on a day without mentions\n" +
+	"• `empty skip` sends nothing (the default), `empty inbox_zero` sends a short note, `empty quiet_week` sends a recap of the week once a week\n" +
+	"• `deliver` shows where your digest is delivered\n" +
+	"• `deliver <target> ...` delivers it to one or more of: `dm`, a channel like `#team-digest`, an email address or `webhook:<https url>` on a public host\n" +
+	"• `priority` shows how the mentions of each priority reach you\n" +
+	"• `priority <P0-P3> <route>` changes it e.g. `priority P2 weekly`, the route is one of: `immediate` sends actionable mentions on their own right away when the urgent checks are on, `digest`, `silent` only lists them in the App Home, `weekly` keeps them for the digest of the quiet week recap day\n" +
+	"• `priority reset` goes back to the defaults"
+
+func handleLanguageCommand(userId string, args []string) string {
+	if len(args) == 0 {
+		userPreferences, getUserPreferencesError := Repo.GetUserPreferences(userId, dbPool)
+		if getUserPreferencesError != nil {
+			log.Println("Failed to get user preferences:", getUserPreferencesError)
+			return "Something went wrong while reading your settings, please try again."
+		}
+		if userPreferences.Language == "" {
+			return "Your digest language is detected from each thread (`auto`)."
+		}
+		return fmt.Sprintf("Your digest is written in %s (`%s`).", Localisation.LanguageName(userPreferences.Language), userPreferences.Language)
+	}
+
+	language := ""
+	if !strings.EqualFold(args[0], "auto") {
+		language = Localisation.NormaliseLanguage(args[0])
+		if language == "" {
+			return fmt.Sprintf("`%s` is not supported, use one of: %s or `auto`.", args[0], strings.Join(Localisation.SupportedLanguages(), ", "))
+		}
+	}
+
+	if saveLanguageError := Repo.SaveUserLanguage(userId, language, dbPool); saveLanguageError != nil {
+		log.Println("Failed to save user language:", saveLanguageError)
+		return "Something went wrong while saving your settings, please try again."
+	}
+
+	if language == "" {
+		return "Done! Each summary will be written in the language of its thread."
+	}
+	return fmt.Sprintf("Done! Your digest will be written in %s.", Localisation.LanguageName(language))
+}
+
+// handleInstructionsCommand gets the raw text after "instructions" so that line breaks are kept
+func handleInstructionsCommand(userId string, text string) string {
+	text = strings.TrimSpace(text)
+	subcommand, customInstructions := text, ""
+	if spaceIndex := strings.IndexFunc(text, unicode.IsSpace); spaceIndex >= 0 {
+		subcommand, customInstructions = text[:spaceIndex], text[spaceIndex:]
+	}
+
+	switch strings.ToLower(subcommand) {
+	case "":
+		userPreferences, getUserPreferencesError := Repo.GetUserPreferences(userId, dbPool)
+		if getUserPreferencesError != nil {
+			log.Println("Failed to get user preferences:", getUserPreferencesError)
+			return "Something went wrong while reading your settings, please try again."
+		}
+		if userPreferences.CustomInstructions == "" {
+			return "You have no custom instructions."
+		}
+		return fmt.Sprintf("Your custom instructions:\n>>>%s", userPreferences.CustomInstructions)
+
+	case "set", "clear":
+		if strings.EqualFold(subcommand, "clear") {
+			customInstructions = ""
+		} else if strings.TrimSpace(customInstructions) == "" {
+			return "Please add the instructions after `set`."
+		}
+
+		validInstructions, validationError := SummarizeConversations.ValidateCustomInstructions(customInstructions)
+		if validationError != nil {
+			return fmt.Sprintf("Your instructions were not saved: %s.", validationError.Error())
+		}
+
+		if saveError := Repo.SaveUserCustomInstructions(userId, validInstructions, dbPool); saveError != nil {
+			log.Println("Failed to save custom instructions:", saveError)
+			return "Something went wrong while saving your settings, please try again."
+		}
+
+		if validInstructions == "" {
+			return "Done! Your custom instructions were removed."
+		}
+		return "Done! Your custom instructions will be used from the next digest."
+	}
+
+	return fmt.Sprintf("Unknown option `%s`, use `instructions`, `instructions set <text>` or `instructions clear`.", subcommand)
+}
+
+func handleGroupCommand(userId string, args []string) string {
+	if len(args) == 0 {
+		userPreferences, getUserPreferencesError := Repo.GetUserPreferences(userId, dbPool)
+		if getUserPreferencesError != nil {
+			log.Println("Failed to get user preferences:", getUserPreferencesError)
+			return "Something went wrong while reading your settings, please try again."
+		}
+		if userPreferences.GroupByCategory {
+			return "Your digest is grouped by category."
+		}
+		return "Your digest is not grouped, the most important mentions come first."
+	}
+
+	var groupByCategory bool
+	switch strings.ToLower(args[0]) {
+	case "category":
+		groupByCategory = true
+	case "none":
+		groupByCategory = false
+	default:
+		return fmt.Sprintf("Unknown option `%s`, use `group category` or `group none`.", args[0])
+	}
+
+	if saveError := Repo.SaveUserGroupByCategory(userId, groupByCategory, dbPool); saveError != nil {
+		log.Println("Failed to save digest grouping:", saveError)
+		return "Something went wrong while saving your settings, please try again."
+	}
+
+	if groupByCategory {
+		return "Done! Your digest will be grouped by category."
+	}
+	return "Done! Your digest will no longer be grouped."
+}
+
+func handleFilterCommand(userId string, args []string) string {
+	if len(args) == 0 {
+		userPreferences, getUserPreferencesError := Repo.GetUserPreferences(userId, dbPool)
+		if getUserPreferencesError != nil {
+			log.Println("Failed to get user preferences:", getUserPreferencesError)
+			return "Something went wrong while reading your settings, please try again."
+		}
+		if len(userPreferences.CategoryFilter) == 0 {
+			return "Your digest shows every category."
+		}
+		return fmt.Sprintf("Your digest only shows: %s.", strings.Join(userPreferences.CategoryFilter, ", "))
+	}
+
+	var categoryFilter []string
+	if !(len(args) == 1 && strings.EqualFold(args[0], "all")) {
+		for _, arg := range args {
+			// "filter review_request, incident" works as well as "filter review_request incident"
+			for _, rawCategory := range strings.Split(arg, ",") {
+				if strings.TrimSpace(rawCategory) == "" {
+					continue
+				}
+				category := SummarizeConversations.NormaliseCategory(rawCategory)
+				if category == "" {
+					return fmt.Sprintf("`%s` is not a category, use one or more of: %s or `all`.", rawCategory, strings.Join(Models.SummaryCategories, ", "))
+				}
+				if !slices.Contains(categoryFilter, category) {
+					categoryFilter = append(categoryFilter, category)
+				}
+			}
+		}
+	}
+
+	if saveError := Repo.SaveUserCategoryFilter(userId, categoryFilter, dbPool); saveError != nil {
+		log.Println("Failed to save category filter:", saveError)
+		return "Something went wrong while saving your settings, please try again."
+	}
+
+	if len(categoryFilter) == 0 {
+		return "Done! Your digest will show every category."
+	}
+	return fmt.Sprintf("Done! Your digest will only show: %s.", strings.Join(categoryFilter, ", "))
+}
+
+var emptyDigestPolicyDescriptions = map[string]string{
+	Models.EmptyDigestSkip:      "nothing is sent",
+	Models.EmptyDigestInboxZero: "you get a short inbox zero note",
+	Models.EmptyDigestQuietWeek: "you get a recap of the week once a week",
+}
+
+func handleEmptyCommand(userId string, args []string) string {
+	if len(args) == 0 {
+		userPreferences, getUserPreferencesError := Repo.GetUserPreferences(userId, dbPool)
+		if getUserPreferencesError != nil {
+			log.Println("Failed to get user preferences:", getUserPreferencesError)
+			return "Something went wrong while reading your settings, please try again."
+		}
+		// a policy that is not known anymore is treated like no policy at all when the digest runs
+		emptyDigestPolicy := userPreferences.EmptyDigestPolicy
+		if !slices.Contains(Models.EmptyDigestPolicies, emptyDigestPolicy) {
+			emptyDigestPolicy = Models.DefaultEmptyDigestPolicy
+		}
+		return fmt.Sprintf("On a day without mentions %s (`%s`).", emptyDigestPolicyDescriptions[emptyDigestPolicy], emptyDigestPolicy)
+	}
+
+	emptyDigestPolicy := strings.ToLower(args[0])
+	if !slices.Contains(Models.EmptyDigestPolicies, emptyDigestPolicy) {
+		return fmt.Sprintf("Unknown option `%s`, use one of: %s.", args[0], strings.Join(Models.EmptyDigestPolicies, ", "))
+	}
+
+	if saveError := Repo.SaveUserEmptyDigestPolicy(userId, emptyDigestPolicy, dbPool); saveError != nil {
+		log.Println("Failed to save empty digest policy:", saveError)
+		return "Something went wrong while saving your settings, please try again."
+	}
+	return fmt.Sprintf("Done! On a day without mentions %s.", emptyDigestPolicyDescriptions[emptyDigestPolicy])
+}
+
+func handleDeliverCommand(userId string, args []string) string {
+	if len(args) == 0 {
+		userPreferences, getUserPreferencesError := Repo.GetUserPreferences(userId, dbPool)
+		if getUserPreferencesError != nil {
+			log.Println("Failed to get user preferences:", getUserPreferencesError)
+			return "Something went wrong while reading your settings, please try again."
+		}
+		if len(userPreferences.DeliveryTargets) == 0 {
+			return "Your digest is delivered as a DM."
+		}
+		return fmt.Sprintf("Your digest is delivered to: %s.", strings.Join(userPreferences.DeliveryTargets, ", "))
+	}
+
+	var deliveryTargets []string
+	for _, arg := range args {
+		deliveryTarget, parseError := PublishDigest.ParseDeliveryTarget(arg)
+		if parseError != nil {
+			return fmt.Sprintf("Your delivery targets were not saved: %s.", parseError.Error())
+		}
+		if !slices.Contains(deliveryTargets, deliveryTarget) {
+			deliveryTargets = append(deliveryTargets, deliveryTarget)
+		}
+	}
+
+	// only the DM is the same as the default
+	if len(deliveryTargets) == 1 && deliveryTargets[0] == Models.DeliveryTargetSlackDm {
+		deliveryTargets = nil
+	}
+	if saveError := Repo.SaveUserDeliveryTargets(userId, deliveryTargets, dbPool); saveError != nil {
+		log.Println("Failed to save delivery targets:", saveError)
+		return "Something went wrong while saving your settings, please try again."
+	}
+
+	if len(deliveryTargets) == 0 {
+		return "Done! Your digest will be delivered as a DM."
+	}
+	return fmt.Sprintf("Done! Your digest will be delivered to: %s. For a channel, invite the app to it first.", strings.Join(deliveryTargets, ", "))
+}
+
+var priorityRouteDescriptions = map[string]string{
+	Models.PriorityRouteImmediate: "sent on their own right away when actionable, and in the digest",
+	Models.PriorityRouteDigest:    "in the daily digest",
+	Models.PriorityRouteSilent:    "only listed in the App Home",
+	Models.PriorityRouteWeekly:    "kept for the weekly digest",
+}
+
+func describePriorityRoutes(routingPolicy PublishDigest.RoutingPolicy) string {
+	var lines []string
+	for _, priority := range Models.Priorities {
+		route := routingPolicy.PriorityRoute(priority)
+		lines = append(lines, fmt.Sprintf("• %s: %s (`%s`)", priority, priorityRouteDescriptions[route], route))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func handlePriorityCommand(userId string, args []string) string {
+	userPreferences, getUserPreferencesError := Repo.GetUserPreferences(userId, dbPool)
+	if getUserPreferencesError != nil {
+		log.Println("Failed to get user preferences:", getUserPreferencesError)
+		return "Something went wrong while reading your settings, please try again."
+	}
+
+	if len(args) == 0 {
+		return "Your mentions reach you like this:\n" + describePriorityRoutes(PublishDigest.NewRoutingPolicy(userPreferences.PriorityRoutes))
+	}
+
+	var priorityRoutes []string
+	if !strings.EqualFold(args[0], "reset") {
+		if len(args) != 2 {
+			return "Use `priority <P0-P3> <route>` e.g. `priority P2 weekly`."
+		}
+		priorityRoute, parseError := PublishDigest.ParsePriorityRoute(args[0], args[1])
+		if parseError != nil {
+			return fmt.Sprintf("Your priority route was not saved: %s.", parseError.Error())
+		}
+		// the new route replaces the one of the same priority
+		priority, _, _ := strings.Cut(priorityRoute, ":")
+		for _, savedRoute := range userPreferences.PriorityRoutes {
+			if !strings.HasPrefix(savedRoute, priority+":") {
+				priorityRoutes = append(priorityRoutes, savedRoute)
+			}
+		}
+		priorityRoutes = append(priorityRoutes, priorityRoute)
+	}
+
+	if saveError := Repo.SavePriorityRoutes(userId, priorityRoutes, dbPool); saveError != nil {
+		log.Println("Failed to save priority routes:", saveError)
+		return "Something went wrong while saving your settings, please try again."
+	}
+	return "Done! Your mentions will reach you like this:\n" + describePriorityRoutes(PublishDigest.NewRoutingPolicy(priorityRoutes))
+}
+
+// HandleSlackCommand serves the slash command of the app, the text is the subcommand followed by its arguments
+func HandleSlackCommand(w http.ResponseWriter, r *http.Request) {
+	if verifyError := verifySlackRequest(r); verifyError != nil {
+		log.Println("Slash command verification failed:", verifyError)
+		http.Error(w, "Invalid request signature", http.StatusUnauthorized)
+		return
+	}
+
+	command, parseError := slack.SlashCommandParse(r)
+	if parseError != nil {
+		http.Error(w, "Invalid slash command", http.StatusBadRequest)
+		return
+	}
+
+	var response string
+	args := strings.Fields(command.Text)
+	switch {
+	case len(args) > 0 && strings.EqualFold(args[0], "language"):
+		response = handleLanguageCommand(command.UserID, args[1:])
+	case len(args) > 0 && strings.EqualFold(args[0], "instructions"):
+		response = handleInstructionsCommand(command.UserID, strings.TrimSpace(command.Text)[len(args[0]):])
+	case len(args) > 0 && strings.EqualFold(args[0], "group"):
+		response = handleGroupCommand(command.UserID, args[1:])
+	case len(args) > 0 && strings.EqualFold(args[0], "filter"):
+		response = handleFilterCommand(command.UserID, args[1:])
+	case len(args) > 0 && strings.EqualFold(args[0], "empty"):
+		response = handleEmptyCommand(command.UserID, args[1:])
+	case len(args) > 0 && strings.EqualFold(args[0], "deliver"):
+		response = handleDeliverCommand(command.UserID, args[1:])
+	case len(args) > 0 && strings.EqualFold(args[0], "priority"):
+		response = handlePriorityCommand(command.UserID, args[1:])
+	default:
+		response = fmt.Sprintf(slashCommandHelp, strings.Join(Localisation.SupportedLanguages(), ", "), strings.Join(Models.SummaryCategories, ", "))
+	}
+
+	// a plain text response is shown to the user only
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, response)
+}
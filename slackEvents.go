@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+)
+
+// HandleSlackEvent serves the Events API of the app, for now only to render the App Home when it is opened
+func HandleSlackEvent(w http.ResponseWriter, r *http.Request) {
+	if verifyError := verifySlackRequest(r); verifyError != nil {
+		log.Println("Event verification failed:", verifyError)
+		http.Error(w, "Invalid request signature", http.StatusUnauthorized)
+		return
+	}
+
+	body, readBodyError := io.ReadAll(r.Body)
+	if readBodyError != nil {
+		http.Error(w, "Invalid event", http.StatusBadRequest)
+		return
+	}
+
+	// the signature was checked above, the deprecated verification token is not used
+	event, parseError := slackevents.ParseEvent(json.RawMessage(body), slackevents.OptionNoVerifyToken())
+	if parseError != nil {
+		http.Error(w, "Invalid event", http.StatusBadRequest)
+		return
+	}
+
+	switch event.Type {
+	case slackevents.URLVerification:
+		var challenge slackevents.ChallengeResponse
+		if unmarshalError := json.Unmarshal(body, &challenge); unmarshalError != nil {
+			http.Error(w, "Invalid challenge", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(challenge.Challenge))
+		return
+
+	case slackevents.CallbackEvent:
+		if appHomeOpened, isAppHomeOpened := event.InnerEvent.Data.(*slackevents.AppHomeOpenedEvent); isAppHomeOpened && appHomeOpened.Tab == "home" {
+			slackBotApi := slack.New(os.Getenv("SLACK_BOT_TOKEN"))
+			if publishError := publishAppHome(slackBotApi, appHomeOpened.User, ""); publishError != nil {
+				log.Println("Failed to publish the App Home:", publishError, "for user:", appHomeOpened.User)
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
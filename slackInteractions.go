@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"slack-tag-summariser/Localisation"
+	"slack-tag-summariser/Models"
+	"slack-tag-summariser/PublishToSlack"
+	"slack-tag-summariser/Repo"
+	"slack-tag-summariser/SummarizeConversations"
+	"slices"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// snoozeUntil is the start of the day after the given number of days in the digest timezone,
+// so the item is back in the first digest of that day
+func snoozeUntil(now time.Time, days int) time.Time {
+	location := SummarizeConversations.GetDigestLocation()
+	localNow := now.In(location)
+	return time.Date(localNow.Year(), localNow.Month(), localNow.Day()+days, 0, 0, 0, 0, location)
+}
+
+// digestItemFromAction maps a button of the digest to the state of its item, false for any other action
+func digestItemFromAction(userId string, action *slack.BlockAction, now time.Time) (Models.DigestItem, bool) {
+	channelId, mentionTimestamp, isDigestItem := PublishToSlack.ParseDigestItemValue(action.Value)
+	if !isDigestItem {
+		return Models.DigestItem{}, false
+	}
+
+	item := Models.DigestItem{UserID: userId, ChannelId: channelId, MentionTimestamp: mentionTimestamp}
+	switch action.ActionID {
+	case PublishToSlack.ActionDigestItemDone:
+		item.State = Models.DigestItemDone
+	case PublishToSlack.ActionDigestItemNotRelevant:
+		item.State = Models.DigestItemNotRelevant
+	case PublishToSlack.ActionDigestItemSnoozeTomorrow, PublishToSlack.ActionDigestItemSnoozeWeek:
+		days := 1
+		if action.ActionID == PublishToSlack.ActionDigestItemSnoozeWeek {
+			days = 7
+		}
+		until := snoozeUntil(now, days)
+		item.State = Models.DigestItemSnoozed
+		item.SnoozedUntil = &until
+	default:
+		return Models.DigestItem{}, false
+	}
+	return item, true
+}
+
+// HandleSlackInteraction serves the buttons of the digest: the state of the item is saved and the
+// buttons in the message are replaced with what the user chose
+func HandleSlackInteraction(w http.ResponseWriter, r *http.Request) {
+	if verifyError := verifySlackRequest(r); verifyError != nil {
+		log.Println("Interaction verification failed:", verifyError)
+		http.Error(w, "Invalid request signature", http.StatusUnauthorized)
+		return
+	}
+
+	var callback slack.InteractionCallback
+	if parseError := json.Unmarshal([]byte(r.FormValue("payload")), &callback); parseError != nil {
+		http.Error(w, "Invalid interaction payload", http.StatusBadRequest)
+		return
+	}
+
+	// slack only needs the request to be acknowledged, anything that is not a digest button is ignored
+	if callback.Type != slack.InteractionTypeBlockActions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	userId := callback.User.ID
+	userPreferences, getUserPreferencesError := Repo.GetUserPreferences(userId, dbPool)
+	if getUserPreferencesError != nil {
+		log.Println("Failed to get user preferences:", getUserPreferencesError, "for user:", userId)
+	}
+	language := userPreferences.Language
+	if language == "" {
+		language = Localisation.DefaultLanguage
+	}
+
+	// the App Home is published again instead of updating a message
+	if callback.View.Type == slack.VTHomeTab {
+		handleAppHomeInteraction(callback, userPreferences)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	channelId := callback.Container.ChannelID
+	if channelId == "" {
+		channelId = callback.Channel.ID
+	}
+	if callback.Message.Timestamp == "" {
+		callback.Message.Timestamp = callback.Container.MessageTs
+	}
+	slackBotApi := slack.New(os.Getenv("SLACK_BOT_TOKEN"))
+
+	for _, action := range callback.ActionCallback.BlockActions {
+		item, isDigestItem := digestItemFromAction(userId, action, time.Now())
+		if !isDigestItem {
+			continue
+		}
+
+		if saveStateError := Repo.SaveDigestItemState(item, dbPool); saveStateError != nil {
+			log.Println("Failed to save the digest item state:", saveStateError, "for user:", userId)
+			http.Error(w, "Failed to save the digest item", http.StatusInternalServerError)
+			return
+		}
+
+		// the state is saved at this point, a message that cannot be updated only keeps showing the buttons
+		updateError := PublishToSlack.UpdateDigestItemMessage(slackBotApi, channelId, callback.Message, action.BlockID, item,
+			language, SummarizeConversations.GetDigestLocation())
+		if updateError != nil {
+			log.Println("Failed to update the digest message:", updateError, "for user:", userId)
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleAppHomeInteraction applies the settings and the item buttons of the App Home and publishes it again
+func handleAppHomeInteraction(callback slack.InteractionCallback, userPreferences Models.UserPreferences) {
+	userId := callback.User.ID
+	digestDate := callback.View.PrivateMetadata
+
+	for _, action := range callback.ActionCallback.BlockActions {
+		var saveError error
+		switch action.ActionID {
+		case PublishToSlack.ActionHomeSelectDate:
+			digestDate = action.SelectedOption.Value
+		case PublishToSlack.ActionHomeToggleGroup:
+			saveError = Repo.SaveUserGroupByCategory(userId, !userPreferences.GroupByCategory, dbPool)
+		case PublishToSlack.ActionHomeLanguage:
+			language := Localisation.NormaliseLanguage(action.SelectedOption.Value)
+			saveError = Repo.SaveUserLanguage(userId, language, dbPool)
+		case PublishToSlack.ActionHomeEmptyPolicy:
+			if slices.Contains(Models.EmptyDigestPolicies, action.SelectedOption.Value) {
+				saveError = Repo.SaveUserEmptyDigestPolicy(userId, action.SelectedOption.Value, dbPool)
+			}
+		default:
+			if item, isDigestItem := digestItemFromAction(userId, action, time.Now()); isDigestItem {
+				saveError = Repo.SaveDigestItemState(item, dbPool)
+			}
+		}
+		if saveError != nil {
+			log.Println("Failed to save the App Home action", action.ActionID, ":", saveError, "for user:", userId)
+		}
+	}
+
+	slackBotApi := slack.New(os.Getenv("SLACK_BOT_TOKEN"))
+	if publishError := publishAppHome(slackBotApi, userId, digestDate); publishError != nil {
+		log.Println("Failed to publish the App Home:", publishError, "for user:", userId)
+	}
+}
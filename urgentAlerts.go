@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"slack-tag-summariser/GetMentions"
+	"slack-tag-summariser/Localisation"
+	"slack-tag-summariser/PublishDigest"
+	"slack-tag-summariser/PublishToSlack"
+	"slack-tag-summariser/Repo"
+	"slack-tag-summariser/SummarizeConversations"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+	"google.golang.org/genai"
+)
+
+// at most this many new mentions of a user are summarised by a single urgent check, the checked ones are
+// recorded so the next check summarises the rest, whatever is still left when it leaves the window waits
+// for the digest
+const maxUrgentMentionsPerCheck = 10
+
+// URGENT_CHECK_INTERVAL is how often the mentions are checked for the ones sent on their own e.g. "15m",
+// off by default so everything waits for the daily digest. Every check summarises the new mentions of
+// every user whose routes send a priority on its own, which is P0 by default, so with a 15 minute
+// interval a mention can cost an LLM call before the digest summarises it from the cache. A value
+// below a minute or that is not a duration leaves the checks off.
+func getUrgentCheckInterval() (time.Duration, bool) {
+	urgentCheckInterval := os.Getenv("URGENT_CHECK_INTERVAL")
+	if urgentCheckInterval == "" || strings.EqualFold(urgentCheckInterval, "off") {
+		return 0, false
+	}
+	interval, parseError := time.ParseDuration(urgentCheckInterval)
+	if parseError != nil || interval < time.Minute {
+		log.Println("Urgent checks are off, URGENT_CHECK_INTERVAL is not a duration of a minute or more:", urgentCheckInterval)
+		return 0, false
+	}
+	return interval, true
+}
+
+// processUrgentMentions sends the mentions found since the time that the priority routes of the user send
+// on their own, and returns how many were sent. The mentions that are not urgent wait for the digest,
+// their summaries are cached so the digest does not pay for them again.
+func processUrgentMentions(slackApi *slack.Client, slackBotApi *slack.Client, genAiClient *genai.Client, ctx context.Context, userId string, runId string, since time.Time, cacheStats *SummarizeConversations.SummaryCacheStats, usageStats *SummarizeConversations.LlmUsageStats) (int, error) {
+	userPreferences, getUserPreferencesError := Repo.GetUserPreferences(userId, dbPool)
+	if getUserPreferencesError != nil {
+		return 0, getUserPreferencesError
+	}
+	routingPolicy := PublishDigest.NewRoutingPolicy(userPreferences.PriorityRoutes)
+	if !routingPolicy.HasImmediate() {
+		return 0, nil
+	}
+
+	// the alerts come on top of the digest, a workspace over its budget only gets the digest. The model is
+	// only set by newSummarizeOptions once the budget is spent.
+	summarizeOptions := newSummarizeOptions(slackApi, ctx, userId, runId, userPreferences, cacheStats, usageStats)
+	if summarizeOptions.Model != "" {
+		log.Println("Skipping the urgent check, the workspace is over its budget, for user:", userId)
+		return 0, nil
+	}
+
+	mentions, getMentionsError := GetMentions.GetMentionsSince(slackApi, userId, since)
+	if getMentionsError != nil {
+		return 0, getMentionsError
+	}
+
+	// the window of the checks overlaps, a mention is checked once and not at all when the user already acted on it
+	skippedKeys := make(map[string]struct{})
+	alerts, getAlertsError := Repo.GetUrgentAlertsSince(userId, since.Add(-24*time.Hour), dbPool)
+	if getAlertsError != nil {
+		return 0, getAlertsError
+	}
+	for key := range alerts {
+		skippedKeys[key] = struct{}{}
+	}
+	checkedMentions, getChecksError := Repo.GetUrgentChecksSince(userId, since.Add(-24*time.Hour), dbPool)
+	if getChecksError != nil {
+		return 0, getChecksError
+	}
+	for key := range checkedMentions {
+		skippedKeys[key] = struct{}{}
+	}
+	digestItems, getDigestItemsError := Repo.GetActedOnDigestItems(userId, dbPool)
+	if getDigestItemsError != nil {
+		return 0, getDigestItemsError
+	}
+	for _, item := range digestItems {
+		skippedKeys[PublishToSlack.DigestItemKey(item.ChannelId, item.MentionTimestamp)] = struct{}{}
+	}
+
+	var newMentions []slack.SearchMessage
+	for _, mention := range mentions {
+		if _, skipped := skippedKeys[PublishToSlack.DigestItemKey(mention.Channel.ID, mention.Timestamp)]; !skipped {
+			newMentions = append(newMentions, mention)
+		}
+	}
+	if len(newMentions) == 0 {
+		return 0, nil
+	}
+	if len(newMentions) > maxUrgentMentionsPerCheck {
+		log.Println("Checking", maxUrgentMentionsPerCheck, "of", len(newMentions), "new mentions for urgent ones, for user:", userId)
+		newMentions = newMentions[:maxUrgentMentionsPerCheck]
+	}
+
+	genAiResponses := summarizeMentions(slackApi, genAiClient, ctx, newMentions, summarizeOptions)
+	for _, genAiResponse := range genAiResponses {
+		if saveCheckError := Repo.SaveUrgentCheck(userId, genAiResponse.MentionChannelId, genAiResponse.MentionTimestamp, dbPool); saveCheckError != nil {
+			log.Println("Failed to record the urgent check of mention:", genAiResponse.MentionTimestamp, "error:", saveCheckError)
+		}
+	}
+	genAiResponses, _ = SummarizeConversations.FilterByCategory(genAiResponses, userPreferences.CategoryFilter)
+
+	urgentResponses := routingPolicy.Immediate(genAiResponses)
+	if len(urgentResponses) == 0 {
+		return 0, nil
+	}
+
+	alertLanguage := userPreferences.Language
+	if alertLanguage == "" {
+		var summaryLanguages []string
+		for _, urgentResponse := range urgentResponses {
+			summaryLanguages = append(summaryLanguages, urgentResponse.Language)
+		}
+		alertLanguage = Localisation.DominantLanguage(summaryLanguages)
+	}
+
+	return PublishDigest.PublishUrgentAlerts(slackBotApi, userId, PublishToSlack.DigestOptions{
+		Language:    alertLanguage,
+		WorkspaceId: summarizeOptions.WorkspaceId,
+	}, urgentResponses, dbPool)
+}
+
+// handleUrgentCronTrigger checks the mentions of every user since the last checks, the window is twice
+// the interval as the search takes a while to find new messages
+func handleUrgentCronTrigger(interval time.Duration) {
+	slackBotApi := slack.New(os.Getenv("SLACK_BOT_TOKEN"))
+
+	// a check must be over before the next one starts
+	ctx, cancelCheck := context.WithTimeout(context.Background(), interval)
+	defer cancelCheck()
+
+	genAiClient, genAiError := genai.NewClient(ctx, &genai.ClientConfig{
+		APIKey:  os.Getenv("GEMINI_API_KEY"),
+		Backend: genai.BackendGeminiAPI,
+	})
+	if genAiError != nil {
+		log.Println("Failed to create the GenAI client for the urgent check:", genAiError)
+		return
+	}
+
+	installedUsers, getUsersError := Repo.GetInstalledUsers(dbPool)
+	if getUsersError != nil {
+		log.Println("Failed to get installed users from database:", getUsersError)
+		return
+	}
+
+	var cacheStats SummarizeConversations.SummaryCacheStats
+	var usageStats SummarizeConversations.LlmUsageStats
+	runId := newRunId(time.Now())
+	since := time.Now().Add(-2 * interval)
+
+	var completeUsers sync.WaitGroup
+	for _, user := range installedUsers {
+		completeUsers.Add(1)
+		go func(userId string, slackApi *slack.Client) {
+			defer completeUsers.Done()
+			sentCount, processUrgentError := processUrgentMentions(slackApi, slackBotApi, genAiClient, ctx, userId, runId, since, &cacheStats, &usageStats)
+			if processUrgentError != nil {
+				log.Println("Urgent check error:", processUrgentError, "for user:", userId)
+			}
+			if sentCount > 0 {
+				log.Println("Sent", sentCount, "urgent alerts to user:", userId)
+			}
+		}(user.UserID, slack.New(user.UserToken))
+	}
+	completeUsers.Wait()
+
+	if usageStats.Calls.Load() > 0 {
+		log.Printf("LLM usage for urgent check %s: %d calls, %d prompt tokens, %d candidate tokens, $%.4f", runId,
+			usageStats.Calls.Load(), usageStats.PromptTokens.Load(), usageStats.CandidateTokens.Load(), usageStats.CostUsd())
+	}
+}